@@ -0,0 +1,56 @@
+// Command backfill-reservations gives users created before email reservations
+// existed a reservation for their email. Run it once against each stage after
+// deploying, with the same DYNAMODB_TABLE as the Lambdas.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/repo/dynamo"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	cfg, err := config.New()
+	if err != nil {
+		return err
+	}
+
+	if cfg.DYNAMODB_TABLE == "" {
+		return errors.New("DYNAMODB_TABLE is required")
+	}
+
+	// Cursors are never issued here, so any secret will do
+	r, err := dynamo.New(cfg.DYNAMODB_TABLE, dynamodb.New(session.Must(session.NewSession())), []byte("backfill"))
+	if err != nil {
+		return err
+	}
+
+	result, err := r.BackfillEmailReservations(context.Background())
+	fmt.Printf("Reserved emails for %d users\n", result.Reserved)
+	if err != nil {
+		return err
+	}
+
+	if len(result.Conflicts) > 0 {
+		fmt.Println("These users share an email with another user, and must be given a new email by hand:")
+		for _, id := range result.Conflicts {
+			fmt.Println(id)
+		}
+		return fmt.Errorf("%d users could not be given a reservation", len(result.Conflicts))
+	}
+
+	return nil
+}
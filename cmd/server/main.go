@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/server"
+	"go.uber.org/zap"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	inst, err := crud.New()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = inst.Logger.Sync() }()
+
+	cfg := inst.Config
+	srv := &http.Server{
+		Addr:              cfg.ServerAddr,
+		Handler:           server.New(inst),
+		ReadHeaderTimeout: milliseconds(cfg.ServerReadTimeoutMS),
+		ReadTimeout:       milliseconds(cfg.ServerReadTimeoutMS),
+		WriteTimeout:      milliseconds(cfg.ServerWriteTimeoutMS),
+		IdleTimeout:       milliseconds(cfg.ServerIdleTimeoutMS),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() {
+		inst.Logger.Info("Listening", zap.String("addr", cfg.ServerAddr), zap.String("backend", cfg.RepoBackend))
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Stop accepting connections and give in-flight requests time to finish
+	inst.Logger.Info("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), milliseconds(cfg.ServerShutdownTimeoutMS))
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return inst.Close(shutdownCtx)
+}
+
+func milliseconds(ms int) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
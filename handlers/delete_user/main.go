@@ -8,16 +8,21 @@ import (
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/crestenstclair/crud/internal/crud"
 	"github.com/crestenstclair/crud/internal/handlers"
+	"github.com/crestenstclair/crud/internal/middleware"
+	"github.com/crestenstclair/crud/internal/transport"
 )
 
-var inst *crud.Crud
+var (
+	inst    *crud.Crud
+	handler = middleware.Chain(handlers.DeleteUser, middleware.Defaults()...)
+)
 
 func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	return handlers.DeleteUser(ctx, request, inst)
+	return handler(ctx, request, inst)
 }
 
 func main() {
-	lambda.Start(Handler)
+	lambda.Start(transport.Adapt(Handler))
 }
 
 func init() {
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/handlers"
+	"github.com/crestenstclair/crud/internal/middleware"
+	"github.com/crestenstclair/crud/internal/transport"
+)
+
+var (
+	inst    *crud.Crud
+	handler = middleware.Chain(handlers.PatchUser, middleware.Defaults()...)
+)
+
+func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return handler(ctx, request, inst)
+}
+
+func main() {
+	lambda.Start(transport.Adapt(Handler))
+}
+
+func init() {
+	tmp, err := crud.New()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	inst = tmp
+}
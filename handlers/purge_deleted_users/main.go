@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/handlers"
+)
+
+var inst *crud.Crud
+
+// Handler is invoked by an EventBridge schedule, whose event carries nothing
+// the purge needs
+func Handler(ctx context.Context, _ events.CloudWatchEvent) error {
+	if inst == nil {
+		return errors.New("crud failed to initialize")
+	}
+
+	return handlers.PurgeDeletedUsers(ctx, inst)
+}
+
+func main() {
+	lambda.Start(Handler)
+}
+
+func init() {
+	tmp, err := crud.New()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	inst = tmp
+}
@@ -5,8 +5,78 @@ import (
 )
 
 type Config struct {
-	DYNAMODB_TABLE   string `env:"DYNAMODB_TABLE,required"`
+	// RepoBackend picks where users are stored, either "dynamo" or "memory"
+	RepoBackend string `env:"REPO_BACKEND" envDefault:"dynamo"`
+	// DYNAMODB_TABLE is required by the dynamo backend
+	DYNAMODB_TABLE   string `env:"DYNAMODB_TABLE"`
 	RequestTimeoutMS int    `env:"REQUEST_TIMEOUT_MS" envDefault:"200"`
+	// LambdaDeadlineMarginMS is held back from the end of a Lambda invocation
+	// so a timed out request still has time to send its response
+	LambdaDeadlineMarginMS int `env:"LAMBDA_DEADLINE_MARGIN_MS" envDefault:"50"`
+	// Repo operations that were throttled or hit an unavailable backend are
+	// tried up to RepoRetryMaxAttempts times, backing off exponentially from
+	// RepoRetryBaseDelayMS up to RepoRetryMaxDelayMS between attempts
+	RepoRetryMaxAttempts int `env:"REPO_RETRY_MAX_ATTEMPTS" envDefault:"3"`
+	RepoRetryBaseDelayMS int `env:"REPO_RETRY_BASE_DELAY_MS" envDefault:"10"`
+	RepoRetryMaxDelayMS  int `env:"REPO_RETRY_MAX_DELAY_MS" envDefault:"100"`
+	// After RepoBreakerThreshold consecutive transient failures the repo is not
+	// called for RepoBreakerCooldownMS. Zero disables the breaker.
+	RepoBreakerThreshold  int `env:"REPO_BREAKER_THRESHOLD" envDefault:"5"`
+	RepoBreakerCooldownMS int `env:"REPO_BREAKER_COOLDOWN_MS" envDefault:"10000"`
+	// UserCacheSize is how many users are cached in memory, zero disables the
+	// cache. Cached users may be UserCacheTTLMS out of date when written by
+	// another instance, and users that were not found are cached for
+	// UserCacheNegativeTTLMS.
+	UserCacheSize          int `env:"USER_CACHE_SIZE" envDefault:"10000"`
+	UserCacheTTLMS         int `env:"USER_CACHE_TTL_MS" envDefault:"5000"`
+	UserCacheNegativeTTLMS int `env:"USER_CACHE_NEGATIVE_TTL_MS" envDefault:"1000"`
+	// IdempotencyTable stores responses to requests sent with an
+	// Idempotency-Key for IdempotencyTTLSeconds. It is required for the
+	// header to be honoured by the dynamo backend. A request that has not
+	// finished after IdempotencyLockTimeoutMS is assumed to have crashed, and
+	// its key may be used again.
+	IdempotencyTable         string `env:"IDEMPOTENCY_TABLE"`
+	IdempotencyTTLSeconds    int    `env:"IDEMPOTENCY_TTL_SECONDS" envDefault:"86400"`
+	IdempotencyLockTimeoutMS int    `env:"IDEMPOTENCY_LOCK_TIMEOUT_MS" envDefault:"30000"`
+	// HistoryTable records every change made to users, and is required by the
+	// dynamo backend
+	HistoryTable string `env:"HISTORY_TABLE"`
+	// Deleted users keep their email for DeletedEmailHoldHours, so they can be
+	// restored, and are purged for good after DeletedUserRetentionDays
+	DeletedEmailHoldHours    int `env:"DELETED_EMAIL_HOLD_HOURS" envDefault:"24"`
+	DeletedUserRetentionDays int `env:"DELETED_USER_RETENTION_DAYS" envDefault:"30"`
+	// CursorSecret signs the pagination cursors handed out by list endpoints,
+	// and is required by the dynamo backend
+	CursorSecret        string `env:"CURSOR_SECRET"`
+	ListDefaultPageSize int    `env:"LIST_DEFAULT_PAGE_SIZE" envDefault:"25"`
+	ListMaxPageSize     int    `env:"LIST_MAX_PAGE_SIZE" envDefault:"100"`
+	// MaxRequestBodyBytes rejects larger request bodies with a 413. Zero
+	// disables the limit.
+	MaxRequestBodyBytes int `env:"MAX_REQUEST_BODY_BYTES" envDefault:"16384"`
+	// CORSAllowedOrigins lists the origins browsers may call the API from, or
+	// "*" for any. CORS headers are not sent when it is empty.
+	CORSAllowedOrigins []string `env:"CORS_ALLOWED_ORIGINS"`
+	CORSAllowedHeaders []string `env:"CORS_ALLOWED_HEADERS" envDefault:"Content-Type,If-Match,Accept-Language,X-Request-Id,Idempotency-Key"`
+	CORSMaxAgeSeconds  int      `env:"CORS_MAX_AGE_SECONDS" envDefault:"600"`
+	// LogRedaction is how personal data is redacted from logs: "mask" keeps
+	// part of each value, "hash" replaces it with a hash and "full" removes it
+	LogRedaction string `env:"LOG_REDACTION" envDefault:"mask"`
+	// TracingExporter is where spans are sent: "none", "stdout" or "otlp"
+	TracingExporter    string `env:"TRACING_EXPORTER" envDefault:"none"`
+	TracingServiceName string `env:"OTEL_SERVICE_NAME" envDefault:"crud"`
+	// MetricsBackend is where metrics go: "emf" logs them in CloudWatch
+	// Embedded Metric Format, "prometheus" serves them at /metrics from the
+	// standalone server, and "auto" picks emf inside Lambda and prometheus
+	// elsewhere
+	MetricsBackend   string `env:"METRICS_BACKEND" envDefault:"auto"`
+	MetricsNamespace string `env:"METRICS_NAMESPACE" envDefault:"crud"`
+
+	// The settings below are only used by the standalone server in cmd/server
+	ServerAddr              string `env:"SERVER_ADDR" envDefault:":8080"`
+	ServerReadTimeoutMS     int    `env:"SERVER_READ_TIMEOUT_MS" envDefault:"5000"`
+	ServerWriteTimeoutMS    int    `env:"SERVER_WRITE_TIMEOUT_MS" envDefault:"10000"`
+	ServerIdleTimeoutMS     int    `env:"SERVER_IDLE_TIMEOUT_MS" envDefault:"60000"`
+	ServerShutdownTimeoutMS int    `env:"SERVER_SHUTDOWN_TIMEOUT_MS" envDefault:"10000"`
 }
 
 func New() (*Config, error) {
@@ -1,18 +1,36 @@
 package crud
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/idempotency"
+	"github.com/crestenstclair/crud/internal/logging"
+	"github.com/crestenstclair/crud/internal/metrics"
 	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/repo/cache"
 	"github.com/crestenstclair/crud/internal/repo/dynamo"
+	"github.com/crestenstclair/crud/internal/repo/memory"
+	"github.com/crestenstclair/crud/internal/repo/resilience"
+	"github.com/crestenstclair/crud/internal/tracing"
 	"go.uber.org/zap"
 )
 
 type Crud struct {
-	Repo   repo.Repo
-	Logger *zap.Logger
-	Config *config.Config
+	Repo    repo.Repo
+	Logger  *zap.Logger
+	Config  *config.Config
+	Metrics metrics.Recorder
+	// Idempotency is nil when idempotency keys are disabled
+	Idempotency idempotency.Store
+
+	shutdownTracing func(context.Context) error
 }
 
 func New() (*Crud, error) {
@@ -26,15 +44,93 @@ func New() (*Crud, error) {
 		return nil, err
 	}
 
-	sess := session.Must(session.NewSession())
-	client := dynamodb.New(sess)
-	repo, err := dynamo.New(cfg.DYNAMODB_TABLE, client)
+	if err := logging.SetRedaction(logging.Redaction(cfg.LogRedaction)); err != nil {
+		return nil, err
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	recorder, err := metrics.New(cfg)
 	if err != nil {
 		return nil, err
 	}
+
+	repo, idempotencyStore, err := newStores(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if idempotencyStore == nil {
+		logger.Warn("IDEMPOTENCY_TABLE is not set, Idempotency-Key headers will be ignored")
+	}
+	// Metrics are recorded closest to the backend, so each attempt is counted
+	// and cache hits are not
+	repo = metrics.WrapRepo(repo, recorder)
+	repo = resilience.WrapRepo(repo, cfg)
+	repo = cache.WrapRepo(repo, cfg, nil)
+
 	return &Crud{
-		Logger: logger,
-		Repo:   repo,
-		Config: cfg,
+		Logger:          logger,
+		Repo:            repo,
+		Config:          cfg,
+		Metrics:         recorder,
+		Idempotency:     idempotencyStore,
+		shutdownTracing: shutdownTracing,
 	}, nil
 }
+
+// Close flushes anything still buffered, such as spans waiting to be exported
+func (c *Crud) Close(ctx context.Context) error {
+	_ = c.Logger.Sync()
+
+	if c.shutdownTracing == nil {
+		return nil
+	}
+
+	return c.shutdownTracing(ctx)
+}
+
+// newStores builds the repo and idempotency store for cfg.RepoBackend. The
+// idempotency store is nil, disabling idempotency keys, when the dynamo
+// backend has no IDEMPOTENCY_TABLE.
+func newStores(cfg *config.Config) (repo.Repo, idempotency.Store, error) {
+	ttl := time.Duration(cfg.IdempotencyTTLSeconds) * time.Second
+	lockTimeout := time.Duration(cfg.IdempotencyLockTimeoutMS) * time.Millisecond
+	emailHold := time.Duration(cfg.DeletedEmailHoldHours) * time.Hour
+
+	switch cfg.RepoBackend {
+	case "dynamo":
+		if cfg.DYNAMODB_TABLE == "" || cfg.HistoryTable == "" || cfg.CursorSecret == "" {
+			return nil, nil, errors.New("the dynamo backend requires DYNAMODB_TABLE, HISTORY_TABLE and CURSOR_SECRET")
+		}
+
+		sess := session.Must(session.NewSession())
+		// Retries are left to the resilience decorator, which knows the
+		// request's deadline and shares a circuit breaker across requests
+		client := dynamo.NewTracedClient(dynamodb.New(sess, aws.NewConfig().WithMaxRetries(0)))
+
+		r, err := dynamo.New(cfg.DYNAMODB_TABLE, client, []byte(cfg.CursorSecret), dynamo.WithEmailHold(emailHold), dynamo.WithHistoryTable(cfg.HistoryTable))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if cfg.IdempotencyTable == "" {
+			return r, nil, nil
+		}
+		// The store is not wrapped by the resilience decorator, so its client
+		// keeps the SDK's retries. A single throttle would otherwise fail the
+		// request the key guards.
+		storeClient := dynamo.NewTracedClient(dynamodb.New(sess))
+		return r, idempotency.NewDynamoStore(cfg.IdempotencyTable, storeClient, ttl, lockTimeout), nil
+	case "memory":
+		r, err := memory.New(memory.WithEmailHold(emailHold))
+		if err != nil {
+			return nil, nil, err
+		}
+		return r, idempotency.NewMemoryStore(ttl, lockTimeout), nil
+	default:
+		return nil, nil, fmt.Errorf("unknown REPO_BACKEND %q, expected dynamo or memory", cfg.RepoBackend)
+	}
+}
@@ -2,58 +2,40 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
-	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/crestenstclair/crud/internal/crud"
-	"github.com/crestenstclair/crud/internal/repo/dynamo"
+	"github.com/crestenstclair/crud/internal/logging"
 	"github.com/crestenstclair/crud/internal/user"
 	"go.uber.org/zap"
 )
 
 func CreateUser(ctx context.Context, request events.APIGatewayProxyRequest, crud *crud.Crud) (events.APIGatewayProxyResponse, error) {
-	ctx, cancel := context.WithTimeout(ctx, time.Duration(crud.Config.RequestTimeoutMS)*time.Millisecond)
+	crud.Logger.Info("Creating user", logging.Body("body", request.Body, userRequest{}))
 
-	defer cancel()
-	crud.Logger.Info(request.Body)
-
-	var body map[string]string
-	err := json.Unmarshal([]byte(request.Body), &body)
+	body, err := parseUserRequest(request.Body, crud.Config)
 	if err != nil {
-		crud.Logger.Error("Failed to create user", zap.Error(err))
-		return makeResponse(map[string]string{
-			"error": "An internal error occured",
-		}, 500), nil
+		crud.Logger.Error("Invalid user provided", zap.Error(err))
+
+		return invalidBodyProblem(ctx, request.Headers, err), nil
 	}
+
 	usr, err := user.New(
-		body["firstName"],
-		body["lastName"],
-		body["email"],
-		body["DOB"],
+		body.FirstName,
+		body.LastName,
+		body.Email,
+		body.DOB,
 	)
 	if err != nil {
 		crud.Logger.Error("Invalid user provided", zap.Error(err))
 
-		return makeResponse(map[string]string{
-			"error": err.Error(),
-		}, 400), nil
+		return validationProblem(ctx, request.Headers, err), nil
 	}
 
-	_, err = crud.Repo.CreateUser(ctx, *usr)
-
-	switch err.(type) {
-	case nil:
-		return makeResponse(usr, 200), nil
-	case *dynamo.UniqueConstraintViolation:
-		crud.Logger.Error("Failed to create user, email already in use", zap.Error(err))
-		return makeResponse(map[string]string{
-			"error": "Email already in use",
-		}, 400), nil
-	default:
-		crud.Logger.Error("Failed to create user", zap.Error(err))
-		return makeResponse(map[string]string{
-			"error": "An internal error occured",
-		}, 500), nil
+	result, err := crud.Repo.CreateUser(ctx, *usr)
+	if err != nil {
+		return repoErrorResponse(ctx, crud, err, "Failed to create user"), nil
 	}
+
+	return withETag(makeResponse(toUserResponse(result), 200), result.Version), nil
 }
@@ -4,18 +4,23 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/crestenstclair/crud/internal/config"
 	"github.com/crestenstclair/crud/internal/crud"
 	"github.com/crestenstclair/crud/internal/handlers"
-	"github.com/crestenstclair/crud/internal/repo/dynamo"
+	"github.com/crestenstclair/crud/internal/problem"
+	"github.com/crestenstclair/crud/internal/repo"
 	"github.com/crestenstclair/crud/internal/repo/mocks"
 	"github.com/crestenstclair/crud/internal/user"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestCreateUser(t *testing.T) {
@@ -46,6 +51,61 @@ func TestCreateUser(t *testing.T) {
 		assert.Equal(t, testUser.Email, result.Email)
 		assert.Equal(t, testUser.DOB, result.DOB)
 	})
+	t.Run("Responds using the camelCase wire format", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		testUser := makeTestUser()
+		mockRepo.On("CreateUser", mock.Anything, mock.Anything).Return(&testUser, nil)
+
+		res, err := handlers.CreateUser(context.Background(), events.APIGatewayProxyRequest{
+			Body: toJsonEscapedString(getUserMap()),
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		var result map[string]any
+		err = json.Unmarshal([]byte(res.Body), &result)
+		assert.NoError(t, err)
+
+		assert.Equal(t, map[string]any{
+			"id":           testUser.ID,
+			"firstName":    testUser.FirstName,
+			"lastName":     testUser.LastName,
+			"email":        testUser.Email,
+			"dob":          testUser.DOB,
+			"createdAt":    testUser.CreatedAt,
+			"lastModified": testUser.LastModified,
+			"version":      float64(testUser.Version),
+		}, result)
+	})
+	t.Run("Keeps personal data out of the logs", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		core, logs := observer.New(zap.DebugLevel)
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zap.New(core),
+			Config: &config.Config{},
+		}
+
+		testUser := makeTestUser()
+		mockRepo.On("CreateUser", mock.Anything, mock.Anything).Return(&testUser, nil)
+
+		_, err := handlers.CreateUser(context.Background(), events.APIGatewayProxyRequest{
+			Body: toJsonEscapedString(getUserMap()),
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.NotZero(t, logs.Len())
+		for _, entry := range logs.All() {
+			logged := fmt.Sprint(entry.Message, entry.ContextMap())
+			assert.NotContains(t, logged, testUser.Email)
+			assert.NotContains(t, logged, testUser.DOB)
+		}
+	})
 	t.Run("errors when firstname is not provided", func(t *testing.T) {
 		mockRepo := mocks.Repo{}
 		testCrud := crud.Crud{
@@ -70,6 +130,66 @@ func TestCreateUser(t *testing.T) {
 
 		assert.Equal(t, 400, res.StatusCode)
 	})
+	t.Run("lists each invalid field in a problem response", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
+			AwsRequestID: "request-id",
+		})
+
+		userMap := getUserMap()
+		userMap["firstName"] = ""
+		userMap["email"] = "not-an-email"
+
+		res, err := handlers.CreateUser(ctx, events.APIGatewayProxyRequest{
+			Body: toJsonEscapedString(userMap),
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		var result problem.Problem
+		err = json.Unmarshal([]byte(res.Body), &result)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 400, res.StatusCode)
+		assert.Equal(t, problem.ContentType, res.Headers["Content-Type"])
+		assert.Equal(t, problem.CodeValidationFailed, result.Code)
+		assert.Equal(t, "request-id", result.TraceID)
+		assert.ElementsMatch(t, []string{"firstName", "email"}, []string{result.Errors[0].Field, result.Errors[1].Field})
+		assert.ElementsMatch(t, []string{"required", "email"}, []string{result.Errors[0].Rule, result.Errors[1].Rule})
+		assert.NotEmpty(t, result.Errors[0].Message)
+	})
+	t.Run("translates validation messages using Accept-Language", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+
+		userMap := getUserMap()
+		userMap["lastName"] = ""
+
+		res, err := handlers.CreateUser(ctx, events.APIGatewayProxyRequest{
+			Headers: map[string]string{"accept-language": "es-ES,es;q=0.9,en;q=0.8"},
+			Body:    toJsonEscapedString(userMap),
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		var result problem.Problem
+		err = json.Unmarshal([]byte(res.Body), &result)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 400, res.StatusCode)
+		assert.Equal(t, "es", res.Headers["Content-Language"])
+		assert.Equal(t, "lastName es un campo requerido", result.Errors[0].Message)
+	})
 	t.Run("errors when lastname is not provided", func(t *testing.T) {
 		mockRepo := mocks.Repo{}
 		testCrud := crud.Crud{
@@ -157,7 +277,7 @@ func TestCreateUser(t *testing.T) {
 
 		userMap := getUserMap()
 
-		userMap["DOB"] = ""
+		userMap["dob"] = ""
 
 		res, err := handlers.CreateUser(ctx, events.APIGatewayProxyRequest{
 			Body: toJsonEscapedString(userMap),
@@ -181,7 +301,7 @@ func TestCreateUser(t *testing.T) {
 
 		userMap := getUserMap()
 
-		userMap["DOB"] = "not a vaild DOB"
+		userMap["dob"] = "not a vaild DOB"
 
 		res, err := handlers.CreateUser(ctx, events.APIGatewayProxyRequest{
 			Body: toJsonEscapedString(userMap),
@@ -211,7 +331,7 @@ func TestCreateUser(t *testing.T) {
 
 		assert.Equal(t, 500, res.StatusCode)
 	})
-	t.Run("returns 400 when unique constraint is found", func(t *testing.T) {
+	t.Run("returns 409 when unique constraint is found", func(t *testing.T) {
 		mockRepo := mocks.Repo{}
 		testCrud := crud.Crud{
 			Repo:   &mockRepo,
@@ -220,7 +340,7 @@ func TestCreateUser(t *testing.T) {
 		}
 
 		ctx := context.Background()
-		mockRepo.On("CreateUser", mock.Anything, mock.Anything).Return(nil, &dynamo.UniqueConstraintViolation{})
+		mockRepo.On("CreateUser", mock.Anything, mock.Anything).Return(nil, &repo.ErrUnique{Field: "email"})
 
 		userMap := getUserMap()
 
@@ -229,6 +349,59 @@ func TestCreateUser(t *testing.T) {
 		}, &testCrud)
 		assert.NoError(t, err)
 
-		assert.Equal(t, 400, res.StatusCode)
+		assert.Equal(t, 409, res.StatusCode)
+		assert.Contains(t, res.Body, "email already in use")
+	})
+}
+
+func TestCreateUserRejectsMalformedBodies(t *testing.T) {
+	valid := `"firstName":"Fred","lastName":"Flintstone","email":"fred@example.com","dob":"1979-12-09T00:00:00Z"`
+
+	cases := map[string]string{
+		"a non-string value":        `{"firstName":1,"lastName":"Flintstone","email":"fred@example.com","dob":"1979-12-09T00:00:00Z"}`,
+		"an unknown field":          `{` + valid + `,"createdAt":"1979-12-09T00:00:00Z"}`,
+		"a miscased field":          `{"FirstName":"Fred","lastName":"Flintstone","email":"fred@example.com","dob":"1979-12-09T00:00:00Z"}`,
+		"a duplicate key":           `{` + valid + `,"email":"wilma@example.com"}`,
+		"trailing data":             `{` + valid + `}{}`,
+		"invalid JSON":              `{` + valid,
+		"a value that is no object": `["Fred"]`,
+		"an empty body":             ``,
+	}
+
+	for name, body := range cases {
+		t.Run("returns 400 for "+name, func(t *testing.T) {
+			mockRepo := mocks.Repo{}
+			testCrud := crud.Crud{
+				Repo:   &mockRepo,
+				Logger: zaptest.NewLogger(t),
+				Config: &config.Config{},
+			}
+
+			res, err := handlers.CreateUser(context.Background(), events.APIGatewayProxyRequest{
+				Body: body,
+			}, &testCrud)
+			assert.NoError(t, err)
+
+			assert.Equal(t, 400, res.StatusCode)
+			assert.Contains(t, res.Body, problem.CodeMalformedBody)
+			mockRepo.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything)
+		})
+	}
+
+	t.Run("returns 413 when the body is larger than the limit", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{MaxRequestBodyBytes: 16},
+		}
+
+		res, err := handlers.CreateUser(context.Background(), events.APIGatewayProxyRequest{
+			Body: `{` + valid + `}`,
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 413, res.StatusCode)
+		mockRepo.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything)
 	})
 }
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+var errBodyTooLarge = errors.New("request body is too large")
+
+// malformedBodyError is returned when a request body is not exactly one JSON
+// object matching the expected shape
+type malformedBodyError struct {
+	reason string
+}
+
+func (e *malformedBodyError) Error() string {
+	return "malformed request body: " + e.reason
+}
+
+func malformed(format string, args ...any) error {
+	return &malformedBodyError{reason: fmt.Sprintf(format, args...)}
+}
+
+// decodeStrict decodes body into target, which must be a pointer to a struct.
+// Unlike json.Unmarshal it rejects unknown or miscased fields, duplicate keys
+// and anything after the first value. A maxBytes of 0 disables the size limit.
+func decodeStrict(body string, maxBytes int, target any) error {
+	if maxBytes > 0 && len(body) > maxBytes {
+		return errBodyTooLarge
+	}
+
+	if err := checkKeys([]byte(body), jsonFieldNames(target)); err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(target); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return malformed("%s must be a %s", typeErr.Field, typeErr.Type)
+		}
+		return malformed("%s", err)
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return malformed("unexpected data after JSON object")
+	}
+
+	return nil
+}
+
+// jsonFieldNames lists the names target's fields have on the wire
+func jsonFieldNames(target any) map[string]bool {
+	names := map[string]bool{}
+
+	t := reflect.TypeOf(target).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+
+	return names
+}
+
+// checkKeys walks the top level object in data and rejects keys that are
+// repeated or not in allowed. encoding/json silently keeps the last of a
+// duplicate key, and matches keys case insensitively, so neither can be
+// caught after decoding.
+func checkKeys(data []byte, allowed map[string]bool) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+
+	token, err := decoder.Token()
+	if err != nil {
+		return malformed("%s", err)
+	}
+	if token != json.Delim('{') {
+		return malformed("expected a JSON object")
+	}
+
+	seen := map[string]bool{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return malformed("%s", err)
+		}
+
+		key := token.(string)
+		if !allowed[key] {
+			return malformed("unknown field %q", key)
+		}
+		if seen[key] {
+			return malformed("duplicate field %q", key)
+		}
+		seen[key] = true
+
+		// Skip the value, whatever its type
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return malformed("%s", err)
+		}
+	}
+
+	return nil
+}
@@ -3,13 +3,14 @@ package handlers_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/crestenstclair/crud/internal/config"
 	"github.com/crestenstclair/crud/internal/crud"
 	"github.com/crestenstclair/crud/internal/handlers"
+	"github.com/crestenstclair/crud/internal/repo"
 	"github.com/crestenstclair/crud/internal/repo/mocks"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -27,13 +28,54 @@ func TestDeleteUser(t *testing.T) {
 
 		ctx := context.Background()
 
-		mockRepo.On("DeleteUser", mock.Anything, mock.Anything).Return(nil)
+		mockRepo.On("DeleteUser", mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
-		res, err := handlers.DeleteUser(ctx, events.APIGatewayProxyRequest{}, &testCrud)
+		res, err := handlers.DeleteUser(ctx, events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{"id": "123"},
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 200, res.StatusCode)
+		assert.JSONEq(t, `{"id": "123"}`, res.Body)
+	})
+	t.Run("Passes If-Match version to the repo", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("DeleteUser", mock.Anything, mock.Anything, int64(7)).Return(nil)
+
+		res, err := handlers.DeleteUser(ctx, events.APIGatewayProxyRequest{
+			Headers: map[string]string{"If-Match": `"7"`},
+		}, &testCrud)
 		assert.NoError(t, err)
 
 		assert.Equal(t, 200, res.StatusCode)
 	})
+	t.Run("Returns 412 when version conflict occurs", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("DeleteUser", mock.Anything, mock.Anything, mock.Anything).Return(fmt.Errorf("%w: expected version 7, found 8", repo.ErrConflict))
+
+		res, err := handlers.DeleteUser(ctx, events.APIGatewayProxyRequest{
+			Headers: map[string]string{"If-Match": `"7"`},
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 412, res.StatusCode)
+	})
 	t.Run("Returns 500 when an internal server error occurs", func(t *testing.T) {
 		mockRepo := mocks.Repo{}
 		testCrud := crud.Crud{
@@ -44,7 +86,7 @@ func TestDeleteUser(t *testing.T) {
 
 		ctx := context.Background()
 
-		mockRepo.On("DeleteUser", mock.Anything, mock.Anything).Return(errors.New("TestError"))
+		mockRepo.On("DeleteUser", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("TestError"))
 
 		res, err := handlers.DeleteUser(ctx, events.APIGatewayProxyRequest{}, &testCrud)
 
@@ -62,7 +104,7 @@ func TestDeleteUser(t *testing.T) {
 
 		ctx := context.Background()
 
-		mockRepo.On("DeleteUser", mock.Anything, mock.Anything).Return(&dynamodb.ConditionalCheckFailedException{})
+		mockRepo.On("DeleteUser", mock.Anything, mock.Anything, mock.Anything).Return(fmt.Errorf("%w: id", repo.ErrNotFound))
 
 		res, err := handlers.DeleteUser(ctx, events.APIGatewayProxyRequest{}, &testCrud)
 
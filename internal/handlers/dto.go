@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/history"
+	"github.com/crestenstclair/crud/internal/user"
+	"github.com/crestenstclair/crud/internal/validator"
+)
+
+// userRequest is the body accepted by POST /user and PUT /user/{id}. IDs,
+// timestamps and versions are owned by the server, so clients cannot set them.
+type userRequest struct {
+	FirstName string `json:"firstName" validate:"required" pii:"name"`
+	LastName  string `json:"lastName" validate:"required" pii:"name"`
+	Email     string `json:"email" validate:"required,email" pii:"email"`
+	DOB       string `json:"dob" validate:"required,RFC3339Date" pii:"dob"`
+}
+
+func toUserRequest(u *user.User) userRequest {
+	return userRequest{
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Email:     u.Email,
+		DOB:       u.DOB,
+	}
+}
+
+// userPath holds the parameters taken from a /user/{id} path, so they can be
+// validated and reported like body fields
+type userPath struct {
+	ID string `json:"id" validate:"uuid"`
+}
+
+// parseUserRequest strictly decodes and validates a user request body
+func parseUserRequest(body string, cfg *config.Config) (*userRequest, error) {
+	var req userRequest
+	if err := decodeStrict(body, cfg.MaxRequestBodyBytes, &req); err != nil {
+		return nil, err
+	}
+
+	if err := validator.GetValidator().Struct(&req); err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
+// revertRequest is the body accepted by POST /user/{id}/revert
+type revertRequest struct {
+	Version int64 `json:"version" validate:"required,min=1"`
+}
+
+func parseRevertRequest(body string, cfg *config.Config) (*revertRequest, error) {
+	var req revertRequest
+	if err := decodeStrict(body, cfg.MaxRequestBodyBytes, &req); err != nil {
+		return nil, err
+	}
+
+	if err := validator.GetValidator().Struct(&req); err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
+// userResponse is how a user is represented in every response body
+type userResponse struct {
+	ID           string `json:"id"`
+	FirstName    string `json:"firstName"`
+	LastName     string `json:"lastName"`
+	Email        string `json:"email"`
+	DOB          string `json:"dob"`
+	CreatedAt    string `json:"createdAt"`
+	LastModified string `json:"lastModified"`
+	Version      int64  `json:"version"`
+}
+
+func toUserResponse(u *user.User) userResponse {
+	return userResponse{
+		ID:           u.ID,
+		FirstName:    u.FirstName,
+		LastName:     u.LastName,
+		Email:        u.Email,
+		DOB:          u.DOB,
+		CreatedAt:    u.CreatedAt,
+		LastModified: u.LastModified,
+		Version:      u.Version,
+	}
+}
+
+func toUserResponses(users []user.User) []userResponse {
+	result := make([]userResponse, 0, len(users))
+	for i := range users {
+		result = append(result, toUserResponse(&users[i]))
+	}
+
+	return result
+}
+
+// deleteUserResponse is the body returned by DELETE /user/{id}
+type deleteUserResponse struct {
+	ID string `json:"id"`
+}
+
+// historyResponse is how a history record is represented in response bodies
+type historyResponse struct {
+	Version   int64            `json:"version"`
+	Operation string           `json:"operation"`
+	Actor     string           `json:"actor"`
+	RequestID string           `json:"requestId,omitempty"`
+	Timestamp string           `json:"timestamp"`
+	Changes   []changeResponse `json:"changes"`
+	// Scrubbed records lost their values when the user was purged
+	Scrubbed bool `json:"scrubbed,omitempty"`
+}
+
+// changeResponse holds the values of any user field
+type changeResponse struct {
+	Field  string `json:"field"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+func toHistoryResponses(records []history.Record) []historyResponse {
+	result := make([]historyResponse, 0, len(records))
+	for _, record := range records {
+		changes := make([]changeResponse, 0, len(record.Changes))
+		for _, change := range record.Changes {
+			changes = append(changes, changeResponse{
+				Field:  change.Field,
+				Before: change.Before,
+				After:  change.After,
+			})
+		}
+
+		result = append(result, historyResponse{
+			Version:   record.Version,
+			Operation: string(record.Operation),
+			Actor:     record.Actor,
+			RequestID: record.RequestID,
+			Timestamp: record.Timestamp,
+			Changes:   changes,
+			Scrubbed:  record.Scrubbed,
+		})
+	}
+
+	return result
+}
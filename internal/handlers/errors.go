@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/header"
+	"github.com/crestenstclair/crud/internal/problem"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/validator"
+	playground "github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+)
+
+func problemResponse(ctx context.Context, status int, code string, detail string) events.APIGatewayProxyResponse {
+	return problem.New(ctx, status, code, detail).Response()
+}
+
+// validationProblem reports an invalid request body. Failed validation rules
+// are listed field by field, so clients can point users at what to fix, with
+// messages in the language the request's Accept-Language header prefers.
+func validationProblem(ctx context.Context, headers map[string]string, err error) events.APIGatewayProxyResponse {
+	var invalid playground.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return problemResponse(ctx, 400, problem.CodeValidationFailed, err.Error())
+	}
+
+	trans := validator.Translator(header.Get(headers, "Accept-Language"))
+
+	fields := make([]problem.FieldError, 0, len(invalid))
+	for _, fe := range invalid {
+		fields = append(fields, problem.FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Message: validator.Message(fe, trans),
+		})
+	}
+
+	response := problem.New(ctx, 400, problem.CodeValidationFailed, "One or more fields are invalid").
+		WithErrors(fields).
+		Response()
+	response.Headers["Content-Language"] = trans.Locale()
+
+	return response
+}
+
+// invalidBodyProblem reports a request body that could not be decoded into, or
+// failed validation as, the expected request
+func invalidBodyProblem(ctx context.Context, headers map[string]string, err error) events.APIGatewayProxyResponse {
+	var malformed *malformedBodyError
+
+	switch {
+	case errors.Is(err, errBodyTooLarge):
+		return problemResponse(ctx, 413, problem.CodePayloadTooLarge, err.Error())
+	case errors.As(err, &malformed):
+		return problemResponse(ctx, 400, problem.CodeMalformedBody, malformed.Error())
+	default:
+		return validationProblem(ctx, headers, err)
+	}
+}
+
+// repoErrorResponse maps an error returned by the repo to a response, so every
+// handler reports the same failure with the same status. failure describes
+// what was being attempted, e.g. "Failed to get user", and is only logged.
+func repoErrorResponse(ctx context.Context, crud *crud.Crud, err error, failure string) events.APIGatewayProxyResponse {
+	var unique *repo.ErrUnique
+
+	switch {
+	case timedOut(ctx, err):
+		crud.Logger.Error(failure+", request timed out", zap.Error(err))
+		return timeoutResponse(ctx)
+	case errors.Is(err, repo.ErrNotFound):
+		crud.Logger.Error(failure+", user not found", zap.Error(err))
+		return problemResponse(ctx, 404, problem.CodeNotFound, "User not found")
+	case errors.As(err, &unique):
+		crud.Logger.Error(failure+", unique constraint violated", zap.Error(err))
+		return problemResponse(ctx, 409, problem.CodeAlreadyExists, fmt.Sprintf("%s already in use", unique.Field))
+	case errors.Is(err, repo.ErrConflict):
+		crud.Logger.Error(failure+", user was modified concurrently", zap.Error(err))
+		return problemResponse(ctx, 409, problem.CodeConflict, "User was modified concurrently, retry the request")
+	case errors.Is(err, repo.ErrThrottled):
+		crud.Logger.Error(failure+", backend throttled the request", zap.Error(err))
+		return problemResponse(ctx, 429, problem.CodeThrottled, "Too many requests, retry later")
+	case errors.Is(err, repo.ErrUnavailable):
+		crud.Logger.Error(failure+", backend unavailable", zap.Error(err))
+		return problemResponse(ctx, 503, problem.CodeUnavailable, "Service temporarily unavailable, retry later")
+	default:
+		crud.Logger.Error(failure, zap.Error(err))
+		return problemResponse(ctx, 500, problem.CodeInternal, "An internal error occured")
+	}
+}
+
+// versionMismatch reports whether a conflict means the caller's If-Match
+// header named a version other than the stored one. Those are reported as 412,
+// while conflicts without a precondition remain 409.
+func versionMismatch(err error, expectedVersion int64) bool {
+	return expectedVersion != repo.AnyVersion && errors.Is(err, repo.ErrConflict)
+}
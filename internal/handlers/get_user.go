@@ -2,41 +2,39 @@ package handlers
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/problem"
 	"go.uber.org/zap"
 )
 
+// GetUser returns the user as it is now, or as it was at the RFC 3339 time
+// in the asOf query parameter. Past states carry no ETag, since they cannot
+// be written to.
 func GetUser(ctx context.Context, request events.APIGatewayProxyRequest, crud *crud.Crud) (events.APIGatewayProxyResponse, error) {
-	ctx, cancel := context.WithTimeout(ctx, time.Duration(crud.Config.RequestTimeoutMS)*time.Millisecond)
-	defer cancel()
-
 	id := request.PathParameters["id"]
-	user, err := crud.Repo.GetUser(ctx, id)
-	if err != nil {
-		crud.Logger.Error("Failed to get user", zap.Error(err))
 
-		return makeResponse(map[string]string{
-			"error": "An internal error occured",
-		}, 500), nil
-	}
+	if value, ok := request.QueryStringParameters["asOf"]; ok {
+		asOf, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			crud.Logger.Error("Invalid asOf provided", zap.String("asOf", value))
+			return problemResponse(ctx, 400, problem.CodeInvalidParameter, "asOf must be an RFC 3339 time"), nil
+		}
+
+		user, err := crud.Repo.GetUserAsOf(ctx, id, asOf)
+		if err != nil {
+			return repoErrorResponse(ctx, crud, err, "Failed to get user as of "+value), nil
+		}
 
-	if user == nil {
-		crud.Logger.Error("User not found", zap.String("id", id))
-		return makeResponse(map[string]string{
-			"error": fmt.Sprintf("User not found. ID: %s", id),
-		}, 404), nil
+		return makeResponse(toUserResponse(user), 200), nil
 	}
 
+	user, err := crud.Repo.GetUser(ctx, id)
 	if err != nil {
-		crud.Logger.Error("Failed to parse user after fetching from database", zap.Error(err))
-		return makeResponse(map[string]string{
-			"error": "An internal error occured",
-		}, 500), nil
+		return repoErrorResponse(ctx, crud, err, "Failed to get user"), nil
 	}
 
-	return makeResponse(user, 200), nil
+	return withETag(makeResponse(toUserResponse(user), 200), user.Version), nil
 }
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/problem"
+	"github.com/crestenstclair/crud/internal/validator"
+	"go.uber.org/zap"
+)
+
+// getUserByEmail serves GET /user?email=... on behalf of ListUsers, which owns
+// the route.
+func getUserByEmail(ctx context.Context, email string, crud *crud.Crud) (events.APIGatewayProxyResponse, error) {
+	if err := validator.GetValidator().Var(email, "required,email"); err != nil {
+		crud.Logger.Error("Invalid email provided", zap.Error(err))
+		return problemResponse(ctx, 400, problem.CodeInvalidParameter, "email must be a valid email address"), nil
+	}
+
+	// Repo errors never include the email, which is PII, so they are safe to log
+	user, err := crud.Repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		return repoErrorResponse(ctx, crud, err, "Failed to get user by email"), nil
+	}
+
+	return withETag(makeResponse(toUserResponse(user), 200), user.Version), nil
+}
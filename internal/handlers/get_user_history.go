@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/problem"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/repo/cursor"
+	"go.uber.org/zap"
+)
+
+type userHistoryResponse struct {
+	History    []historyResponse `json:"history"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+// GetUserHistory pages through the changes made to a user, newest first
+func GetUserHistory(ctx context.Context, request events.APIGatewayProxyRequest, crud *crud.Crud) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+
+	limit, err := pageLimit(request.QueryStringParameters, crud.Config)
+	if err != nil {
+		crud.Logger.Error("Invalid limit provided", zap.String("limit", request.QueryStringParameters["limit"]))
+		return problemResponse(ctx, 400, problem.CodeInvalidParameter, err.Error()), nil
+	}
+
+	page, err := crud.Repo.ListUserHistory(ctx, id, repo.ListOptions{
+		Limit:  limit,
+		Cursor: request.QueryStringParameters["cursor"],
+	})
+
+	if errors.Is(err, cursor.ErrInvalid) {
+		crud.Logger.Error("Invalid cursor provided", zap.Error(err))
+		return problemResponse(ctx, 400, problem.CodeInvalidParameter, "Invalid cursor"), nil
+	}
+
+	if err != nil {
+		return repoErrorResponse(ctx, crud, err, "Failed to get user history"), nil
+	}
+
+	return makeResponse(userHistoryResponse{
+		History:    toHistoryResponses(page.Records),
+		NextCursor: page.NextCursor,
+	}, 200), nil
+}
@@ -0,0 +1,189 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/handlers"
+	"github.com/crestenstclair/crud/internal/history"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/repo/cursor"
+	"github.com/crestenstclair/crud/internal/repo/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestGetUserHistory(t *testing.T) {
+	t.Run("Returns the page of history records", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{ListDefaultPageSize: 25, ListMaxPageSize: 100},
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("ListUserHistory", mock.Anything, "123", repo.ListOptions{Limit: 10, Cursor: "abc"}).Return(repo.HistoryPage{
+			Records: []history.Record{{
+				UserID:    "123",
+				Version:   2,
+				Operation: history.Update,
+				Actor:     "fred",
+				Timestamp: "2023-01-02T03:04:05Z",
+				Changes:   []history.Change{{Field: "email", Before: "fred@example.com", After: "wilma@example.com"}},
+			}},
+			NextCursor: "def",
+		}, nil)
+
+		res, err := handlers.GetUserHistory(ctx, events.APIGatewayProxyRequest{
+			PathParameters:        map[string]string{"id": "123"},
+			QueryStringParameters: map[string]string{"limit": "10", "cursor": "abc"},
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 200, res.StatusCode)
+		assert.JSONEq(t, `{
+			"history": [{
+				"version": 2,
+				"operation": "update",
+				"actor": "fred",
+				"timestamp": "2023-01-02T03:04:05Z",
+				"changes": [{"field": "email", "before": "fred@example.com", "after": "wilma@example.com"}]
+			}],
+			"nextCursor": "def"
+		}`, res.Body)
+	})
+	t.Run("Marks records scrubbed when their user was purged", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{ListDefaultPageSize: 25, ListMaxPageSize: 100},
+		}
+
+		mockRepo.On("ListUserHistory", mock.Anything, "123", repo.ListOptions{Limit: 25}).Return(repo.HistoryPage{
+			Records: []history.Record{{
+				UserID:    "123",
+				Version:   2,
+				Operation: history.Update,
+				Actor:     "fred",
+				Timestamp: "2023-01-02T03:04:05Z",
+				Changes:   []history.Change{{Field: "email"}},
+				Scrubbed:  true,
+			}},
+		}, nil)
+
+		res, err := handlers.GetUserHistory(context.Background(), events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{"id": "123"},
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 200, res.StatusCode)
+		assert.JSONEq(t, `{
+			"history": [{
+				"version": 2,
+				"operation": "update",
+				"actor": "fred",
+				"timestamp": "2023-01-02T03:04:05Z",
+				"changes": [{"field": "email"}],
+				"scrubbed": true
+			}]
+		}`, res.Body)
+	})
+
+	t.Run("Returns an empty list for users without history", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{ListDefaultPageSize: 25, ListMaxPageSize: 100},
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("ListUserHistory", mock.Anything, mock.Anything, mock.Anything).Return(repo.HistoryPage{}, nil)
+
+		res, err := handlers.GetUserHistory(ctx, events.APIGatewayProxyRequest{}, &testCrud)
+		assert.NoError(t, err)
+
+		var body map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(res.Body), &body))
+		assert.Equal(t, []any{}, body["history"])
+	})
+	t.Run("Returns 400 when limit is invalid", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{ListDefaultPageSize: 25, ListMaxPageSize: 100},
+		}
+
+		ctx := context.Background()
+
+		res, err := handlers.GetUserHistory(ctx, events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{"limit": "0"},
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 400, res.StatusCode)
+	})
+	t.Run("Returns 400 when cursor is invalid", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{ListDefaultPageSize: 25, ListMaxPageSize: 100},
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("ListUserHistory", mock.Anything, mock.Anything, mock.Anything).Return(repo.HistoryPage{}, cursor.ErrInvalid)
+
+		res, err := handlers.GetUserHistory(ctx, events.APIGatewayProxyRequest{}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 400, res.StatusCode)
+	})
+	t.Run("Returns 404 when user not found", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{ListDefaultPageSize: 25, ListMaxPageSize: 100},
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("ListUserHistory", mock.Anything, mock.Anything, mock.Anything).Return(repo.HistoryPage{}, fmt.Errorf("%w: id", repo.ErrNotFound))
+
+		res, err := handlers.GetUserHistory(ctx, events.APIGatewayProxyRequest{}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 404, res.StatusCode)
+	})
+	t.Run("Returns 500 when an internal server error occurs", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{ListDefaultPageSize: 25, ListMaxPageSize: 100},
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("ListUserHistory", mock.Anything, mock.Anything, mock.Anything).Return(repo.HistoryPage{}, errors.New("TestError"))
+
+		res, err := handlers.GetUserHistory(ctx, events.APIGatewayProxyRequest{}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 500, res.StatusCode)
+	})
+}
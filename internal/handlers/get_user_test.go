@@ -4,12 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/crestenstclair/crud/internal/config"
 	"github.com/crestenstclair/crud/internal/crud"
 	"github.com/crestenstclair/crud/internal/handlers"
+	"github.com/crestenstclair/crud/internal/middleware"
+	"github.com/crestenstclair/crud/internal/repo"
 	"github.com/crestenstclair/crud/internal/repo/mocks"
 	"github.com/crestenstclair/crud/internal/user"
 	"github.com/stretchr/testify/assert"
@@ -44,6 +49,7 @@ func TestGetUser(t *testing.T) {
 		assert.Equal(t, testUser.DOB, result.DOB)
 		assert.Equal(t, testUser.CreatedAt, result.CreatedAt)
 		assert.Equal(t, testUser.LastModified, result.LastModified)
+		assert.Equal(t, `"3"`, res.Headers["ETag"])
 	})
 	t.Run("Returns 500 when an internal server error occurs", func(t *testing.T) {
 		mockRepo := mocks.Repo{}
@@ -73,7 +79,7 @@ func TestGetUser(t *testing.T) {
 
 		ctx := context.Background()
 
-		mockRepo.On("GetUser", mock.Anything, mock.Anything).Return(nil, nil)
+		mockRepo.On("GetUser", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: id", repo.ErrNotFound))
 
 		res, err := handlers.GetUser(ctx, events.APIGatewayProxyRequest{}, &testCrud)
 
@@ -81,4 +87,133 @@ func TestGetUser(t *testing.T) {
 
 		assert.Equal(t, 404, res.StatusCode)
 	})
+	t.Run("Returns 429 when the backend throttles the request", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("GetUser", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: slow down", repo.ErrThrottled))
+
+		res, err := handlers.GetUser(ctx, events.APIGatewayProxyRequest{}, &testCrud)
+
+		assert.NoError(t, err)
+
+		assert.Equal(t, 429, res.StatusCode)
+	})
+	t.Run("Returns 503 when the backend is unavailable", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("GetUser", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: bad gateway", repo.ErrUnavailable))
+
+		res, err := handlers.GetUser(ctx, events.APIGatewayProxyRequest{}, &testCrud)
+
+		assert.NoError(t, err)
+
+		assert.Equal(t, 503, res.StatusCode)
+	})
+	t.Run("Returns 504 when the repo runs past the request timeout", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{RequestTimeoutMS: 10},
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("GetUser", mock.Anything, mock.Anything).Return(func(ctx context.Context, id string) (*user.User, error) {
+			<-ctx.Done()
+			return nil, errors.New("RequestCanceled: request context canceled")
+		}, nil)
+
+		res, err := middleware.Chain(handlers.GetUser, middleware.Timeout())(ctx, events.APIGatewayProxyRequest{}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 504, res.StatusCode)
+		assert.Contains(t, res.Body, "REQUEST_TIMEOUT")
+	})
+	t.Run("Leaves a margin before the Lambda invocation deadline", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{
+				RequestTimeoutMS:       60000,
+				LambdaDeadlineMarginMS: 500,
+			},
+		}
+
+		lambdaDeadline := time.Now().Add(time.Second)
+		ctx, cancel := context.WithDeadline(context.Background(), lambdaDeadline)
+		defer cancel()
+		ctx = lambdacontext.NewContext(ctx, &lambdacontext.LambdaContext{})
+
+		var repoDeadline time.Time
+		testUser := makeTestUser()
+		mockRepo.On("GetUser", mock.Anything, mock.Anything).Return(func(ctx context.Context, id string) (*user.User, error) {
+			repoDeadline, _ = ctx.Deadline()
+			return &testUser, nil
+		}, nil)
+
+		_, err := middleware.Chain(handlers.GetUser, middleware.Timeout())(ctx, events.APIGatewayProxyRequest{}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.WithinDuration(t, lambdaDeadline.Add(-500*time.Millisecond), repoDeadline, time.Millisecond)
+	})
+	t.Run("Returns the user as of the given time without an ETag", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+		testUser := makeTestUser()
+		asOf := time.Date(2023, 2, 15, 12, 0, 0, 0, time.UTC)
+
+		mockRepo.On("GetUserAsOf", mock.Anything, testUser.ID, asOf).Return(&testUser, nil)
+
+		res, err := handlers.GetUser(ctx, events.APIGatewayProxyRequest{
+			PathParameters:        map[string]string{"id": testUser.ID},
+			QueryStringParameters: map[string]string{"asOf": "2023-02-15T12:00:00Z"},
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Empty(t, res.Headers["ETag"])
+		mockRepo.AssertNotCalled(t, "GetUser", mock.Anything, mock.Anything)
+	})
+	t.Run("Returns 400 when asOf is not an RFC 3339 time", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+
+		for _, asOf := range []string{"", "yesterday", "2023-02-15"} {
+			res, err := handlers.GetUser(ctx, events.APIGatewayProxyRequest{
+				QueryStringParameters: map[string]string{"asOf": asOf},
+			}, &testCrud)
+			assert.NoError(t, err)
+
+			assert.Equal(t, 400, res.StatusCode, asOf)
+			assert.Contains(t, res.Body, "INVALID_PARAMETER")
+		}
+	})
 }
@@ -3,8 +3,14 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/header"
+	"github.com/crestenstclair/crud/internal/repo"
 )
 
 func makeResponse[T any](respBody T, statusCode int) events.APIGatewayProxyResponse {
@@ -21,3 +27,34 @@ func makeResponse[T any](respBody T, statusCode int) events.APIGatewayProxyRespo
 		},
 	}
 }
+
+// withETag tags a response with the version of the user it carries
+func withETag(response events.APIGatewayProxyResponse, version int64) events.APIGatewayProxyResponse {
+	response.Headers["ETag"] = fmt.Sprintf("\"%d\"", version)
+	return response
+}
+
+var errPreconditionFailed = errors.New("If-Match header does not match a version of this user")
+
+// parseIfMatch returns the version a request's If-Match header expects.
+// Requests without the header, or with the "*" wildcard, accept any version.
+func parseIfMatch(headers map[string]string) (int64, error) {
+	value := strings.TrimSpace(header.Get(headers, "If-Match"))
+	if value == "" || value == "*" {
+		return repo.AnyVersion, nil
+	}
+
+	// If-Match uses strong comparison, so weak tags can never match
+	unquoted, err := strconv.Unquote(value)
+	if err != nil {
+		return 0, errPreconditionFailed
+	}
+
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	// Users written before versioning was introduced are tagged "0"
+	if err != nil || version < 0 {
+		return 0, errPreconditionFailed
+	}
+
+	return version, nil
+}
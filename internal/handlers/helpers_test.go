@@ -13,7 +13,7 @@ func getUserMap() map[string]string {
 		"firstName": "firstName",
 		"lastName":  "lastName",
 		"email":     "example@example.com",
-		"DOB":       "1979-12-09T00:00:00Z",
+		"dob":       "1979-12-09T00:00:00Z",
 	}
 }
 
@@ -22,8 +22,7 @@ func toUserMap(u *user.User) map[string]string {
 		"firstName": u.FirstName,
 		"lastName":  u.LastName,
 		"email":     u.Email,
-		"DOB":       u.DOB,
-		"ID":        u.ID,
+		"dob":       u.DOB,
 	}
 }
 
@@ -46,5 +45,6 @@ func makeTestUser() user.User {
 		DOB:          testTime,
 		CreatedAt:    testTime,
 		LastModified: testTime,
+		Version:      3,
 	}
 }
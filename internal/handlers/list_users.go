@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/problem"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/repo/cursor"
+	"go.uber.org/zap"
+)
+
+type listUsersResponse struct {
+	Users      []userResponse `json:"users"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
+func ListUsers(ctx context.Context, request events.APIGatewayProxyRequest, crud *crud.Crud) (events.APIGatewayProxyResponse, error) {
+	if email, ok := request.QueryStringParameters["email"]; ok {
+		return getUserByEmail(ctx, email, crud)
+	}
+
+	limit, err := pageLimit(request.QueryStringParameters, crud.Config)
+	if err != nil {
+		crud.Logger.Error("Invalid limit provided", zap.String("limit", request.QueryStringParameters["limit"]))
+		return problemResponse(ctx, 400, problem.CodeInvalidParameter, err.Error()), nil
+	}
+
+	page, err := crud.Repo.ListUsers(ctx, repo.ListOptions{
+		Limit:  limit,
+		Cursor: request.QueryStringParameters["cursor"],
+	})
+
+	if errors.Is(err, cursor.ErrInvalid) {
+		crud.Logger.Error("Invalid cursor provided", zap.Error(err))
+		return problemResponse(ctx, 400, problem.CodeInvalidParameter, "Invalid cursor"), nil
+	}
+
+	if err != nil {
+		return repoErrorResponse(ctx, crud, err, "Failed to list users"), nil
+	}
+
+	return makeResponse(listUsersResponse{
+		Users:      toUserResponses(page.Users),
+		NextCursor: page.NextCursor,
+	}, 200), nil
+}
+
+var errInvalidLimit = errors.New("limit must be a positive integer")
+
+// pageLimit is the page size asked for by a list request's limit parameter.
+// Larger requests are clamped rather than rejected so clients can ask for "as
+// many as possible" without knowing the configured maximum.
+func pageLimit(query map[string]string, cfg *config.Config) (int, error) {
+	limit := cfg.ListDefaultPageSize
+	if raw, ok := query["limit"]; ok {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			return 0, errInvalidLimit
+		}
+		limit = parsed
+	}
+
+	if limit > cfg.ListMaxPageSize {
+		limit = cfg.ListMaxPageSize
+	}
+
+	return limit, nil
+}
@@ -0,0 +1,221 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/handlers"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/repo/cursor"
+	"github.com/crestenstclair/crud/internal/repo/mocks"
+	"github.com/crestenstclair/crud/internal/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap/zaptest"
+)
+
+func makeListConfig() *config.Config {
+	return &config.Config{
+		ListDefaultPageSize: 25,
+		ListMaxPageSize:     100,
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	t.Run("Returns 200 with users and next cursor", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: makeListConfig(),
+		}
+
+		ctx := context.Background()
+		testUser := makeTestUser()
+
+		mockRepo.On("ListUsers", mock.Anything, repo.ListOptions{Limit: 25, Cursor: "abc"}).Return(repo.Page{
+			Users:      []user.User{testUser},
+			NextCursor: "def",
+		}, nil)
+
+		res, err := handlers.ListUsers(ctx, events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{"cursor": "abc"},
+		}, &testCrud)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, res.StatusCode)
+
+		result := struct {
+			Users      []user.User
+			NextCursor string
+		}{}
+		err = json.Unmarshal([]byte(res.Body), &result)
+		assert.NoError(t, err)
+
+		assert.Equal(t, testUser.ID, result.Users[0].ID)
+		assert.Equal(t, "def", result.NextCursor)
+	})
+	t.Run("Clamps limit to the configured maximum", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: makeListConfig(),
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("ListUsers", mock.Anything, repo.ListOptions{Limit: 100}).Return(repo.Page{}, nil)
+
+		res, err := handlers.ListUsers(ctx, events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{"limit": "5000"},
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 200, res.StatusCode)
+	})
+	t.Run("Returns 400 when limit is invalid", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: makeListConfig(),
+		}
+
+		ctx := context.Background()
+
+		res, err := handlers.ListUsers(ctx, events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{"limit": "-1"},
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 400, res.StatusCode)
+	})
+	t.Run("Returns 400 when cursor is invalid", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: makeListConfig(),
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("ListUsers", mock.Anything, mock.Anything).Return(repo.Page{}, cursor.ErrInvalid)
+
+		res, err := handlers.ListUsers(ctx, events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{"cursor": "forged"},
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 400, res.StatusCode)
+	})
+	t.Run("Returns 500 when an internal server error occurs", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: makeListConfig(),
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("ListUsers", mock.Anything, mock.Anything).Return(repo.Page{}, errors.New("TestError"))
+
+		res, err := handlers.ListUsers(ctx, events.APIGatewayProxyRequest{}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 500, res.StatusCode)
+	})
+}
+
+func TestListUsersByEmail(t *testing.T) {
+	t.Run("Returns 200 and the full user when email matches", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: makeListConfig(),
+		}
+
+		ctx := context.Background()
+		testUser := makeTestUser()
+
+		mockRepo.On("GetUserByEmail", mock.Anything, "Example@example.com").Return(&testUser, nil)
+
+		res, err := handlers.ListUsers(ctx, events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{"email": "Example@example.com"},
+		}, &testCrud)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, res.StatusCode)
+
+		result := &user.User{}
+		err = json.Unmarshal([]byte(res.Body), &result)
+		assert.NoError(t, err)
+
+		assert.Equal(t, testUser.ID, result.ID)
+		assert.Equal(t, testUser.FirstName, result.FirstName)
+		assert.Equal(t, testUser.DOB, result.DOB)
+		assert.Equal(t, `"3"`, res.Headers["ETag"])
+		mockRepo.AssertNotCalled(t, "ListUsers", mock.Anything, mock.Anything)
+	})
+	t.Run("Returns 404 when no user has the email", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: makeListConfig(),
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("GetUserByEmail", mock.Anything, mock.Anything).Return(nil, repo.ErrNotFound)
+
+		res, err := handlers.ListUsers(ctx, events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{"email": "missing@example.com"},
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 404, res.StatusCode)
+	})
+	t.Run("Returns 400 when email is invalid", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: makeListConfig(),
+		}
+
+		ctx := context.Background()
+
+		res, err := handlers.ListUsers(ctx, events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{"email": "not an email"},
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 400, res.StatusCode)
+	})
+	t.Run("Returns 500 when an internal server error occurs", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: makeListConfig(),
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("GetUserByEmail", mock.Anything, mock.Anything).Return(nil, errors.New("TestError"))
+
+		res, err := handlers.ListUsers(ctx, events.APIGatewayProxyRequest{
+			QueryStringParameters: map[string]string{"email": "example@example.com"},
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 500, res.StatusCode)
+	})
+}
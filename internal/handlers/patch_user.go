@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mime"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/header"
+	"github.com/crestenstclair/crud/internal/problem"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/user"
+	"github.com/crestenstclair/crud/internal/validator"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// PatchUser applies a JSON Merge Patch (RFC 7386) or JSON Patch (RFC 6902) to
+// the writable fields of a user, as they appear in a PUT body.
+func PatchUser(ctx context.Context, request events.APIGatewayProxyRequest, crud *crud.Crud) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	expectedVersion, err := parseIfMatch(request.Headers)
+	if err != nil {
+		crud.Logger.Error("Invalid If-Match header provided", zap.Error(err))
+
+		return problemResponse(ctx, 412, problem.CodePreconditionFailed, err.Error()), nil
+	}
+
+	if err := validator.GetValidator().Struct(&userPath{ID: id}); err != nil {
+		crud.Logger.Error("Invalid user ID provided", zap.Error(err))
+
+		return validationProblem(ctx, request.Headers, err), nil
+	}
+
+	contentType, _, _ := mime.ParseMediaType(header.Get(request.Headers, "Content-Type"))
+	if contentType != mergePatchContentType && contentType != jsonPatchContentType {
+		crud.Logger.Error("Unsupported patch content type", zap.String("contentType", contentType))
+
+		return problemResponse(ctx, 415, problem.CodeUnsupportedMediaType,
+			"Content-Type must be "+mergePatchContentType+" or "+jsonPatchContentType), nil
+	}
+
+	if max := crud.Config.MaxRequestBodyBytes; max > 0 && len(request.Body) > max {
+		return invalidBodyProblem(ctx, request.Headers, errBodyTooLarge), nil
+	}
+
+	// A cached user could be stale, failing If-Match headers that are not
+	existingUser, err := crud.Repo.GetUser(repo.WithConsistentRead(ctx), id)
+	if err != nil {
+		return repoErrorResponse(ctx, crud, err, "Failed to patch user"), nil
+	}
+
+	// Catch stale versions before doing any work. The repo checks again when
+	// writing, in case the user changes in the meantime.
+	if expectedVersion != repo.AnyVersion && existingUser.Version != expectedVersion {
+		crud.Logger.Error("Failed to patch user, version mismatch")
+		return problemResponse(ctx, 412, problem.CodePreconditionFailed, errPreconditionFailed.Error()), nil
+	}
+
+	patched, err := applyPatch(contentType, toUserRequest(existingUser), []byte(request.Body))
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		crud.Logger.Error("Failed to patch user, test operation failed", zap.Error(err))
+		return problemResponse(ctx, 409, problem.CodeConflict, "A test operation in the patch failed"), nil
+	}
+	if err != nil {
+		crud.Logger.Error("Invalid patch provided", zap.Error(err))
+		return invalidBodyProblem(ctx, request.Headers, err), nil
+	}
+
+	if err := validator.GetValidator().Struct(patched); err != nil {
+		crud.Logger.Error("Patched user is invalid", zap.Error(err))
+		return validationProblem(ctx, request.Headers, err), nil
+	}
+
+	changes := diffUserRequest(existingUser, patched)
+	if changes.IsEmpty() {
+		return withETag(makeResponse(toUserResponse(existingUser), 200), existingUser.Version), nil
+	}
+
+	// The patch was applied to the version just read, so without If-Match it
+	// must still only be written over that version
+	writeVersion := expectedVersion
+	if writeVersion == repo.AnyVersion {
+		writeVersion = existingUser.Version
+	}
+
+	result, err := crud.Repo.PatchUser(ctx, id, changes, writeVersion)
+
+	if versionMismatch(err, expectedVersion) {
+		crud.Logger.Error("Failed to patch user, version mismatch", zap.Error(err))
+		return problemResponse(ctx, 412, problem.CodePreconditionFailed, errPreconditionFailed.Error()), nil
+	}
+
+	if err != nil {
+		return repoErrorResponse(ctx, crud, err, "Failed to patch user"), nil
+	}
+
+	return withETag(makeResponse(toUserResponse(result), 200), result.Version), nil
+}
+
+// applyPatch patches current with a patch document of the given content type,
+// and strictly decodes the result back into a request
+func applyPatch(contentType string, current userRequest, patch []byte) (*userRequest, error) {
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+
+	var patchedDoc []byte
+	switch contentType {
+	case mergePatchContentType:
+		// Merge patches name the fields they change, so catch unknown and
+		// repeated fields before they are silently merged
+		if err := checkKeys(patch, jsonFieldNames(&current)); err != nil {
+			return nil, err
+		}
+
+		patchedDoc, err = jsonpatch.MergePatch(doc, patch)
+		if err != nil {
+			return nil, malformed("%s", err)
+		}
+	default:
+		operations, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, malformed("%s", err)
+		}
+
+		patchedDoc, err = operations.Apply(doc)
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, malformed("%s", err)
+		}
+	}
+
+	var patched userRequest
+	if err := decodeStrict(string(patchedDoc), 0, &patched); err != nil {
+		return nil, err
+	}
+
+	return &patched, nil
+}
+
+func diffUserRequest(existing *user.User, patched *userRequest) repo.UserChanges {
+	var changes repo.UserChanges
+
+	if patched.FirstName != existing.FirstName {
+		changes.FirstName = &patched.FirstName
+	}
+	if patched.LastName != existing.LastName {
+		changes.LastName = &patched.LastName
+	}
+	if patched.Email != existing.Email {
+		changes.Email = &patched.Email
+	}
+	if patched.DOB != existing.DOB {
+		changes.DOB = &patched.DOB
+	}
+
+	return changes
+}
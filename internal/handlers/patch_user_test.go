@@ -0,0 +1,254 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/handlers"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/repo/mocks"
+	"github.com/crestenstclair/crud/internal/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap/zaptest"
+)
+
+func patchRequest(id string, contentType string, body string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{"id": id},
+		Headers:        map[string]string{"Content-Type": contentType},
+		Body:           body,
+	}
+}
+
+func onlyLastName(lastName string) interface{} {
+	return mock.MatchedBy(func(changes repo.UserChanges) bool {
+		return changes.LastName != nil && *changes.LastName == lastName &&
+			changes.FirstName == nil && changes.Email == nil && changes.DOB == nil
+	})
+}
+
+func TestPatchUser(t *testing.T) {
+	t.Run("Applies a merge patch and writes only the changed fields", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		testUser := makeTestUser()
+		patchedUser := testUser
+		patchedUser.LastName = "Rubble"
+		patchedUser.Version = 4
+		mockRepo.On("GetUser", mock.Anything, testUser.ID).Return(&testUser, nil)
+		mockRepo.On("PatchUser", mock.Anything, testUser.ID, onlyLastName("Rubble"), int64(3)).Return(&patchedUser, nil)
+
+		res, err := handlers.PatchUser(context.Background(),
+			patchRequest(testUser.ID, "application/merge-patch+json", `{"lastName":"Rubble"}`), &testCrud)
+		assert.NoError(t, err)
+
+		result := &user.User{}
+		err = json.Unmarshal([]byte(res.Body), &result)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, "Rubble", result.LastName)
+		assert.Equal(t, `"4"`, res.Headers["ETag"])
+	})
+	t.Run("Reads the user past any cache before patching it", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		testUser := makeTestUser()
+		patchedUser := testUser
+		patchedUser.LastName = "Rubble"
+		patchedUser.Version = 4
+		mockRepo.On("GetUser", mock.MatchedBy(repo.ConsistentRead), testUser.ID).Return(&testUser, nil)
+		mockRepo.On("PatchUser", mock.Anything, testUser.ID, onlyLastName("Rubble"), int64(3)).Return(&patchedUser, nil)
+
+		res, err := handlers.PatchUser(context.Background(),
+			patchRequest(testUser.ID, "application/merge-patch+json", `{"lastName":"Rubble"}`), &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 200, res.StatusCode)
+		mockRepo.AssertExpectations(t)
+	})
+	t.Run("Applies a JSON patch", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		testUser := makeTestUser()
+		mockRepo.On("GetUser", mock.Anything, testUser.ID).Return(&testUser, nil)
+		mockRepo.On("PatchUser", mock.Anything, testUser.ID, onlyLastName("Rubble"), int64(3)).Return(&testUser, nil)
+
+		res, err := handlers.PatchUser(context.Background(), patchRequest(testUser.ID, "application/json-patch+json",
+			`[{"op":"test","path":"/lastName","value":"lastName"},{"op":"replace","path":"/lastName","value":"Rubble"}]`), &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 200, res.StatusCode)
+	})
+	t.Run("Passes If-Match version to the repo", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		testUser := makeTestUser()
+		mockRepo.On("GetUser", mock.Anything, testUser.ID).Return(&testUser, nil)
+		mockRepo.On("PatchUser", mock.Anything, testUser.ID, mock.Anything, int64(3)).Return(nil, repo.ErrConflict)
+
+		request := patchRequest(testUser.ID, "application/merge-patch+json", `{"lastName":"Rubble"}`)
+		request.Headers["If-Match"] = `"3"`
+		res, err := handlers.PatchUser(context.Background(), request, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 412, res.StatusCode)
+	})
+	t.Run("Returns 412 without writing when If-Match is already stale", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		testUser := makeTestUser()
+		mockRepo.On("GetUser", mock.Anything, testUser.ID).Return(&testUser, nil)
+
+		request := patchRequest(testUser.ID, "application/merge-patch+json", `{"lastName":"Rubble"}`)
+		request.Headers["If-Match"] = `"2"`
+		res, err := handlers.PatchUser(context.Background(), request, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 412, res.StatusCode)
+		mockRepo.AssertNotCalled(t, "PatchUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+	t.Run("Returns 409 when a JSON patch test operation fails", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		testUser := makeTestUser()
+		mockRepo.On("GetUser", mock.Anything, testUser.ID).Return(&testUser, nil)
+
+		res, err := handlers.PatchUser(context.Background(), patchRequest(testUser.ID, "application/json-patch+json",
+			`[{"op":"test","path":"/lastName","value":"Slate"},{"op":"replace","path":"/lastName","value":"Rubble"}]`), &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 409, res.StatusCode)
+		mockRepo.AssertNotCalled(t, "PatchUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+	t.Run("Revalidates the patched user", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		testUser := makeTestUser()
+		mockRepo.On("GetUser", mock.Anything, testUser.ID).Return(&testUser, nil)
+
+		res, err := handlers.PatchUser(context.Background(),
+			patchRequest(testUser.ID, "application/merge-patch+json", `{"email":"not-an-email","dob":null}`), &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 400, res.StatusCode)
+		assert.Contains(t, res.Body, `"field":"email"`)
+		assert.Contains(t, res.Body, `"field":"dob"`)
+		mockRepo.AssertNotCalled(t, "PatchUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+	t.Run("Rejects patches to fields the server owns", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		testUser := makeTestUser()
+		mockRepo.On("GetUser", mock.Anything, testUser.ID).Return(&testUser, nil)
+
+		for contentType, body := range map[string]string{
+			"application/merge-patch+json": `{"createdAt":"2000-01-01T00:00:00Z"}`,
+			"application/json-patch+json":  `[{"op":"add","path":"/version","value":9}]`,
+		} {
+			res, err := handlers.PatchUser(context.Background(), patchRequest(testUser.ID, contentType, body), &testCrud)
+			assert.NoError(t, err)
+
+			assert.Equal(t, 400, res.StatusCode, contentType)
+		}
+		mockRepo.AssertNotCalled(t, "PatchUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+	t.Run("Does not write when the patch changes nothing", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		testUser := makeTestUser()
+		mockRepo.On("GetUser", mock.Anything, testUser.ID).Return(&testUser, nil)
+
+		res, err := handlers.PatchUser(context.Background(),
+			patchRequest(testUser.ID, "application/merge-patch+json", `{"lastName":"lastName"}`), &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, `"3"`, res.Headers["ETag"])
+		mockRepo.AssertNotCalled(t, "PatchUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+	t.Run("Returns 415 for other content types", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		testUser := makeTestUser()
+
+		res, err := handlers.PatchUser(context.Background(),
+			patchRequest(testUser.ID, "application/json", `{"lastName":"Rubble"}`), &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 415, res.StatusCode)
+		mockRepo.AssertNotCalled(t, "GetUser", mock.Anything, mock.Anything)
+	})
+	t.Run("Returns 404 when user not found", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		testUser := makeTestUser()
+		mockRepo.On("GetUser", mock.Anything, testUser.ID).Return(nil, repo.ErrNotFound)
+
+		res, err := handlers.PatchUser(context.Background(),
+			patchRequest(testUser.ID, "application/merge-patch+json; charset=utf-8", `{"lastName":"Rubble"}`), &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 404, res.StatusCode)
+	})
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/crestenstclair/crud/internal/crud"
+	"go.uber.org/zap"
+)
+
+// PurgeDeletedUsers permanently removes users that were deleted more than
+// DeletedUserRetentionDays ago. It runs on a schedule rather than behind the
+// API, so failures are returned instead of turned into responses.
+func PurgeDeletedUsers(ctx context.Context, crud *crud.Crud) error {
+	retention := time.Duration(crud.Config.DeletedUserRetentionDays) * 24 * time.Hour
+	deletedBefore := time.Now().Add(-retention)
+
+	purged, err := crud.Repo.PurgeDeletedUsers(ctx, deletedBefore)
+	if err != nil {
+		crud.Logger.Error("Failed to purge deleted users", zap.Int("purged", purged), zap.Error(err))
+		return err
+	}
+
+	crud.Logger.Info("Purged deleted users", zap.Int("purged", purged), zap.Time("deletedBefore", deletedBefore))
+
+	return nil
+}
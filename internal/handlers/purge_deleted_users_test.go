@@ -0,0 +1,50 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/handlers"
+	"github.com/crestenstclair/crud/internal/repo/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	t.Run("Purges users deleted before the retention period", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{DeletedUserRetentionDays: 30},
+		}
+
+		mockRepo.On("PurgeDeletedUsers", mock.Anything, mock.MatchedBy(func(deletedBefore time.Time) bool {
+			return time.Since(deletedBefore).Round(time.Hour) == 30*24*time.Hour
+		})).Return(2, nil)
+
+		err := handlers.PurgeDeletedUsers(context.Background(), &testCrud)
+
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+	t.Run("Returns errors from the repo", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		mockRepo.On("PurgeDeletedUsers", mock.Anything, mock.Anything).Return(1, errors.New("TestError"))
+
+		err := handlers.PurgeDeletedUsers(context.Background(), &testCrud)
+
+		assert.Error(t, err)
+	})
+}
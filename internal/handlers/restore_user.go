@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/problem"
+	"go.uber.org/zap"
+)
+
+// RestoreUser undoes a soft delete. It fails with a 409 if the user's email
+// was taken by someone else after it was released.
+func RestoreUser(ctx context.Context, request events.APIGatewayProxyRequest, crud *crud.Crud) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	expectedVersion, err := parseIfMatch(request.Headers)
+	if err != nil {
+		crud.Logger.Error("Invalid If-Match header provided", zap.Error(err))
+
+		return problemResponse(ctx, 412, problem.CodePreconditionFailed, err.Error()), nil
+	}
+
+	result, err := crud.Repo.RestoreUser(ctx, id, expectedVersion)
+
+	if versionMismatch(err, expectedVersion) {
+		crud.Logger.Error("Failed to restore user, version mismatch", zap.Error(err))
+		return problemResponse(ctx, 412, problem.CodePreconditionFailed, errPreconditionFailed.Error()), nil
+	}
+
+	if err != nil {
+		return repoErrorResponse(ctx, crud, err, "Failed to restore user"), nil
+	}
+
+	return withETag(makeResponse(toUserResponse(result), 200), result.Version), nil
+}
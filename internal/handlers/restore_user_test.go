@@ -0,0 +1,103 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/handlers"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/repo/mocks"
+	"github.com/crestenstclair/crud/internal/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRestoreUser(t *testing.T) {
+	t.Run("Returns 200 and the restored user", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+		testUser := makeTestUser()
+		testUser.Version = 4
+
+		mockRepo.On("RestoreUser", mock.Anything, testUser.ID, int64(3)).Return(&testUser, nil)
+
+		res, err := handlers.RestoreUser(ctx, events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{"id": testUser.ID},
+			Headers:        map[string]string{"If-Match": `"3"`},
+		}, &testCrud)
+		assert.NoError(t, err)
+		result := &user.User{}
+
+		err = json.Unmarshal([]byte(res.Body), &result)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, `"4"`, res.Headers["ETag"])
+		assert.Equal(t, testUser.Email, result.Email)
+	})
+	t.Run("Returns 409 when the email was taken", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("RestoreUser", mock.Anything, mock.Anything, mock.Anything).Return(nil, &repo.ErrUnique{Field: "email"})
+
+		res, err := handlers.RestoreUser(ctx, events.APIGatewayProxyRequest{}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 409, res.StatusCode)
+	})
+	t.Run("Returns 412 when version conflict occurs", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("RestoreUser", mock.Anything, mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: expected version 7, found 8", repo.ErrConflict))
+
+		res, err := handlers.RestoreUser(ctx, events.APIGatewayProxyRequest{
+			Headers: map[string]string{"If-Match": `"7"`},
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 412, res.StatusCode)
+	})
+	t.Run("Returns 404 when user not found", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("RestoreUser", mock.Anything, mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: id", repo.ErrNotFound))
+
+		res, err := handlers.RestoreUser(ctx, events.APIGatewayProxyRequest{}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 404, res.StatusCode)
+	})
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/problem"
+	"github.com/crestenstclair/crud/internal/repo"
+	"go.uber.org/zap"
+)
+
+var errPreconditionRequired = errors.New("If-Match header with the user's current version is required")
+
+// RevertUser writes an earlier version of the user, from its history, as a
+// new version. Reverting undoes every change made since, so unlike other
+// writes it requires If-Match to name the version the caller last saw.
+func RevertUser(ctx context.Context, request events.APIGatewayProxyRequest, crud *crud.Crud) (events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	expectedVersion, err := parseIfMatch(request.Headers)
+	if err != nil {
+		crud.Logger.Error("Invalid If-Match header provided", zap.Error(err))
+
+		return problemResponse(ctx, 412, problem.CodePreconditionFailed, err.Error()), nil
+	}
+
+	if expectedVersion == repo.AnyVersion {
+		crud.Logger.Error("Revert requested without If-Match")
+
+		return problemResponse(ctx, 428, problem.CodePreconditionRequired, errPreconditionRequired.Error()), nil
+	}
+
+	body, err := parseRevertRequest(request.Body, crud.Config)
+	if err != nil {
+		crud.Logger.Error("Invalid revert provided", zap.Error(err))
+
+		return invalidBodyProblem(ctx, request.Headers, err), nil
+	}
+
+	result, err := crud.Repo.RevertUser(ctx, id, body.Version, expectedVersion)
+
+	if versionMismatch(err, expectedVersion) {
+		crud.Logger.Error("Failed to revert user, version mismatch", zap.Error(err))
+		return problemResponse(ctx, 412, problem.CodePreconditionFailed, errPreconditionFailed.Error()), nil
+	}
+
+	if errors.Is(err, repo.ErrVersionNotFound) {
+		crud.Logger.Error("Failed to revert user, unknown version", zap.Error(err))
+		return problemResponse(ctx, 400, problem.CodeValidationFailed, fmt.Sprintf("version %d is not in the user's history", body.Version)), nil
+	}
+
+	if err != nil {
+		return repoErrorResponse(ctx, crud, err, "Failed to revert user"), nil
+	}
+
+	return withETag(makeResponse(toUserResponse(result), 200), result.Version), nil
+}
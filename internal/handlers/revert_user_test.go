@@ -0,0 +1,154 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/handlers"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/repo/mocks"
+	"github.com/crestenstclair/crud/internal/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRevertUser(t *testing.T) {
+	t.Run("Returns 200 and the reverted user", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+		testUser := makeTestUser()
+		testUser.Version = 4
+
+		mockRepo.On("RevertUser", mock.Anything, testUser.ID, int64(1), int64(3)).Return(&testUser, nil)
+
+		res, err := handlers.RevertUser(ctx, events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{"id": testUser.ID},
+			Headers:        map[string]string{"If-Match": `"3"`},
+			Body:           `{"version":1}`,
+		}, &testCrud)
+		assert.NoError(t, err)
+		result := &user.User{}
+
+		err = json.Unmarshal([]byte(res.Body), &result)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, `"4"`, res.Headers["ETag"])
+		assert.Equal(t, testUser.Email, result.Email)
+	})
+	t.Run("Returns 428 without an If-Match version", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+
+		for _, headers := range []map[string]string{{}, {"If-Match": "*"}} {
+			res, err := handlers.RevertUser(ctx, events.APIGatewayProxyRequest{
+				Headers: headers,
+				Body:    `{"version":1}`,
+			}, &testCrud)
+			assert.NoError(t, err)
+
+			assert.Equal(t, 428, res.StatusCode)
+			assert.Contains(t, res.Body, "PRECONDITION_REQUIRED")
+		}
+		mockRepo.AssertNotCalled(t, "RevertUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+	t.Run("Returns 400 when the version is missing or invalid", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+
+		for _, body := range []string{`{}`, `{"version":0}`, `{"version":"1"}`, `{"version":1,"email":"x"}`} {
+			res, err := handlers.RevertUser(ctx, events.APIGatewayProxyRequest{
+				Headers: map[string]string{"If-Match": `"3"`},
+				Body:    body,
+			}, &testCrud)
+			assert.NoError(t, err)
+
+			assert.Equal(t, 400, res.StatusCode, body)
+		}
+	})
+	t.Run("Returns 400 when the version is not in the user's history", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("RevertUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: id has no version 9", repo.ErrVersionNotFound))
+
+		res, err := handlers.RevertUser(ctx, events.APIGatewayProxyRequest{
+			Headers: map[string]string{"If-Match": `"3"`},
+			Body:    `{"version":9}`,
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 400, res.StatusCode)
+		assert.Contains(t, res.Body, "version 9 is not in the user's history")
+	})
+	t.Run("Returns 409 when the earlier email was taken", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("RevertUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, &repo.ErrUnique{Field: "email"})
+
+		res, err := handlers.RevertUser(ctx, events.APIGatewayProxyRequest{
+			Headers: map[string]string{"If-Match": `"3"`},
+			Body:    `{"version":1}`,
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 409, res.StatusCode)
+	})
+	t.Run("Returns 412 when the user changed since the If-Match version", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+
+		mockRepo.On("RevertUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: expected version 3, found 4", repo.ErrConflict))
+
+		res, err := handlers.RevertUser(ctx, events.APIGatewayProxyRequest{
+			Headers: map[string]string{"If-Match": `"3"`},
+			Body:    `{"version":1}`,
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 412, res.StatusCode)
+	})
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/problem"
+)
+
+// timedOut reports whether err was caused by the request running out of time.
+// Repo backends do not always wrap the context's error, so the context itself
+// is checked as well.
+func timedOut(ctx context.Context, err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+func timeoutResponse(ctx context.Context) events.APIGatewayProxyResponse {
+	return problemResponse(ctx, 504, problem.CodeTimeout, "The request timed out")
+}
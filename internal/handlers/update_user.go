@@ -2,50 +2,55 @@ package handlers
 
 import (
 	"context"
-	"time"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/crestenstclair/crud/internal/crud"
-	"github.com/crestenstclair/crud/internal/repo/dynamo"
+	"github.com/crestenstclair/crud/internal/problem"
 	"github.com/crestenstclair/crud/internal/user"
+	"github.com/crestenstclair/crud/internal/validator"
 	"go.uber.org/zap"
 )
 
 func UpdateUser(ctx context.Context, request events.APIGatewayProxyRequest, crud *crud.Crud) (events.APIGatewayProxyResponse, error) {
-	ctx, cancel := context.WithTimeout(ctx, time.Duration(crud.Config.RequestTimeoutMS)*time.Millisecond)
+	id := request.PathParameters["id"]
+	expectedVersion, err := parseIfMatch(request.Headers)
+	if err != nil {
+		crud.Logger.Error("Invalid If-Match header provided", zap.Error(err))
 
-	defer cancel()
+		return problemResponse(ctx, 412, problem.CodePreconditionFailed, err.Error()), nil
+	}
 
-	id := request.PathParameters["id"]
-	usr, err := user.Parse(request.Body, id)
+	if err := validator.GetValidator().Struct(&userPath{ID: id}); err != nil {
+		crud.Logger.Error("Invalid user ID provided", zap.Error(err))
+
+		return validationProblem(ctx, request.Headers, err), nil
+	}
+
+	body, err := parseUserRequest(request.Body, crud.Config)
 	if err != nil {
 		crud.Logger.Error("Invalid user provided", zap.Error(err))
 
-		return makeResponse(map[string]string{
-			"error": err.Error(),
-		}, 400), nil
+		return invalidBodyProblem(ctx, request.Headers, err), nil
 	}
 
-	result, err := crud.Repo.UpdateUser(ctx, *usr)
-
-	switch err.(type) {
-	case nil:
-		return makeResponse(result, 200), nil
-	case *dynamo.UniqueConstraintViolation:
-		crud.Logger.Error("Failed to update user, email already in use", zap.Error(err))
-		return makeResponse(map[string]string{
-			"error": "Email already in use",
-		}, 400), nil
-	case *dynamodb.ConditionalCheckFailedException:
-		crud.Logger.Error("Failed to update user, email already in use", zap.Error(err))
-		return makeResponse(map[string]string{
-			"error": "Email already in use",
-		}, 400), nil
-	default:
-		crud.Logger.Error("Failed to update user", zap.Error(err))
-		return makeResponse(map[string]string{
-			"error": "An internal error occured",
-		}, 500), nil
+	usr := &user.User{
+		ID:        id,
+		FirstName: body.FirstName,
+		LastName:  body.LastName,
+		Email:     body.Email,
+		DOB:       body.DOB,
 	}
+
+	result, err := crud.Repo.UpdateUser(ctx, *usr, expectedVersion)
+
+	if versionMismatch(err, expectedVersion) {
+		crud.Logger.Error("Failed to update user, version mismatch", zap.Error(err))
+		return problemResponse(ctx, 412, problem.CodePreconditionFailed, errPreconditionFailed.Error()), nil
+	}
+
+	if err != nil {
+		return repoErrorResponse(ctx, crud, err, "Failed to update user"), nil
+	}
+
+	return withETag(makeResponse(toUserResponse(result), 200), result.Version), nil
 }
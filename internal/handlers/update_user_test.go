@@ -4,14 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/crestenstclair/crud/internal/config"
 	"github.com/crestenstclair/crud/internal/crud"
 	"github.com/crestenstclair/crud/internal/handlers"
-	"github.com/crestenstclair/crud/internal/repo/dynamo"
+	"github.com/crestenstclair/crud/internal/repo"
 	"github.com/crestenstclair/crud/internal/repo/mocks"
 	"github.com/crestenstclair/crud/internal/user"
 	"github.com/stretchr/testify/assert"
@@ -31,10 +31,11 @@ func TestUpdateUser(t *testing.T) {
 		ctx := context.Background()
 		testUser := makeTestUser()
 
-		mockRepo.On("UpdateUser", mock.Anything, mock.Anything).Return(&testUser, nil)
+		mockRepo.On("UpdateUser", mock.Anything, mock.Anything, mock.Anything).Return(&testUser, nil)
 
 		res, err := handlers.UpdateUser(ctx, events.APIGatewayProxyRequest{
-			Body: toJsonEscapedString(toUserMap(&testUser)),
+			PathParameters: map[string]string{"id": testUser.ID},
+			Body:           toJsonEscapedString(toUserMap(&testUser)),
 		}, &testCrud)
 		assert.NoError(t, err)
 		result := &user.User{}
@@ -59,14 +60,15 @@ func TestUpdateUser(t *testing.T) {
 		ctx := context.Background()
 		testUser := makeTestUser()
 
-		mockRepo.On("UpdateUser", mock.Anything, mock.Anything).Return(&testUser, nil)
+		mockRepo.On("UpdateUser", mock.Anything, mock.Anything, mock.Anything).Return(&testUser, nil)
 
 		userMap := toUserMap(&testUser)
 
 		userMap["firstName"] = ""
 
 		res, err := handlers.UpdateUser(ctx, events.APIGatewayProxyRequest{
-			Body: toJsonEscapedString(userMap),
+			PathParameters: map[string]string{"id": testUser.ID},
+			Body:           toJsonEscapedString(userMap),
 		}, &testCrud)
 		assert.NoError(t, err)
 
@@ -83,14 +85,15 @@ func TestUpdateUser(t *testing.T) {
 		ctx := context.Background()
 		testUser := makeTestUser()
 
-		mockRepo.On("UpdateUser", mock.Anything, mock.Anything).Return(&testUser, nil)
+		mockRepo.On("UpdateUser", mock.Anything, mock.Anything, mock.Anything).Return(&testUser, nil)
 
 		userMap := getUserMap()
 
 		userMap["lastName"] = ""
 
 		res, err := handlers.UpdateUser(ctx, events.APIGatewayProxyRequest{
-			Body: toJsonEscapedString(userMap),
+			PathParameters: map[string]string{"id": testUser.ID},
+			Body:           toJsonEscapedString(userMap),
 		}, &testCrud)
 		assert.NoError(t, err)
 
@@ -107,14 +110,15 @@ func TestUpdateUser(t *testing.T) {
 		ctx := context.Background()
 		testUser := makeTestUser()
 
-		mockRepo.On("UpdateUser", mock.Anything, mock.Anything).Return(&testUser, nil)
+		mockRepo.On("UpdateUser", mock.Anything, mock.Anything, mock.Anything).Return(&testUser, nil)
 
 		userMap := getUserMap()
 
 		userMap["email"] = ""
 
 		res, err := handlers.UpdateUser(ctx, events.APIGatewayProxyRequest{
-			Body: toJsonEscapedString(userMap),
+			PathParameters: map[string]string{"id": testUser.ID},
+			Body:           toJsonEscapedString(userMap),
 		}, &testCrud)
 		assert.NoError(t, err)
 
@@ -131,14 +135,15 @@ func TestUpdateUser(t *testing.T) {
 		ctx := context.Background()
 		testUser := makeTestUser()
 
-		mockRepo.On("UpdateUser", mock.Anything, mock.Anything).Return(&testUser, nil)
+		mockRepo.On("UpdateUser", mock.Anything, mock.Anything, mock.Anything).Return(&testUser, nil)
 
 		userMap := getUserMap()
 
 		userMap["email"] = "not a vaild email"
 
 		res, err := handlers.UpdateUser(ctx, events.APIGatewayProxyRequest{
-			Body: toJsonEscapedString(userMap),
+			PathParameters: map[string]string{"id": testUser.ID},
+			Body:           toJsonEscapedString(userMap),
 		}, &testCrud)
 		assert.NoError(t, err)
 
@@ -155,14 +160,15 @@ func TestUpdateUser(t *testing.T) {
 		ctx := context.Background()
 		testUser := makeTestUser()
 
-		mockRepo.On("UpdateUser", mock.Anything, mock.Anything).Return(&testUser, nil)
+		mockRepo.On("UpdateUser", mock.Anything, mock.Anything, mock.Anything).Return(&testUser, nil)
 
 		userMap := getUserMap()
 
-		userMap["DOB"] = ""
+		userMap["dob"] = ""
 
 		res, err := handlers.UpdateUser(ctx, events.APIGatewayProxyRequest{
-			Body: toJsonEscapedString(userMap),
+			PathParameters: map[string]string{"id": testUser.ID},
+			Body:           toJsonEscapedString(userMap),
 		}, &testCrud)
 		assert.NoError(t, err)
 
@@ -179,19 +185,37 @@ func TestUpdateUser(t *testing.T) {
 		ctx := context.Background()
 		testUser := makeTestUser()
 
-		mockRepo.On("UpdateUser", mock.Anything, mock.Anything).Return(&testUser, nil)
+		mockRepo.On("UpdateUser", mock.Anything, mock.Anything, mock.Anything).Return(&testUser, nil)
 
 		userMap := getUserMap()
 
-		userMap["DOB"] = "not a vaild DOB"
+		userMap["dob"] = "not a vaild DOB"
 
 		res, err := handlers.UpdateUser(ctx, events.APIGatewayProxyRequest{
-			Body: toJsonEscapedString(userMap),
+			PathParameters: map[string]string{"id": testUser.ID},
+			Body:           toJsonEscapedString(userMap),
 		}, &testCrud)
 		assert.NoError(t, err)
 
 		assert.Equal(t, 400, res.StatusCode)
 	})
+	t.Run("errors when the path ID is not a UUID", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		res, err := handlers.UpdateUser(context.Background(), events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{"id": "not-a-uuid"},
+			Body:           toJsonEscapedString(getUserMap()),
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 400, res.StatusCode)
+		assert.Contains(t, res.Body, `"field":"id"`)
+	})
 	t.Run("returns 500 when random error returns", func(t *testing.T) {
 		mockRepo := mocks.Repo{}
 		testCrud := crud.Crud{
@@ -202,19 +226,20 @@ func TestUpdateUser(t *testing.T) {
 
 		ctx := context.Background()
 
-		mockRepo.On("UpdateUser", mock.Anything, mock.Anything).Return(nil, errors.New("something went wrong"))
+		mockRepo.On("UpdateUser", mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("something went wrong"))
 
 		testUser := makeTestUser()
 		userMap := toUserMap(&testUser)
 
 		res, err := handlers.UpdateUser(ctx, events.APIGatewayProxyRequest{
-			Body: toJsonEscapedString(userMap),
+			PathParameters: map[string]string{"id": testUser.ID},
+			Body:           toJsonEscapedString(userMap),
 		}, &testCrud)
 		assert.NoError(t, err)
 
 		assert.Equal(t, 500, res.StatusCode)
 	})
-	t.Run("returns 400 when conditional check fails", func(t *testing.T) {
+	t.Run("returns 404 when the user does not exist", func(t *testing.T) {
 		mockRepo := mocks.Repo{}
 		testCrud := crud.Crud{
 			Repo:   &mockRepo,
@@ -223,18 +248,20 @@ func TestUpdateUser(t *testing.T) {
 		}
 
 		ctx := context.Background()
-		mockRepo.On("UpdateUser", mock.Anything, mock.Anything).Return(nil, &dynamodb.ConditionalCheckFailedException{})
+		mockRepo.On("UpdateUser", mock.Anything, mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: id", repo.ErrNotFound))
 
-		userMap := getUserMap()
+		testUser := makeTestUser()
+		userMap := toUserMap(&testUser)
 
 		res, err := handlers.UpdateUser(ctx, events.APIGatewayProxyRequest{
-			Body: toJsonEscapedString(userMap),
+			PathParameters: map[string]string{"id": testUser.ID},
+			Body:           toJsonEscapedString(userMap),
 		}, &testCrud)
 		assert.NoError(t, err)
 
-		assert.Equal(t, 400, res.StatusCode)
+		assert.Equal(t, 404, res.StatusCode)
 	})
-	t.Run("returns 400 when uniqueness violation occurs", func(t *testing.T) {
+	t.Run("passes If-Match version to the repo and returns the new ETag", func(t *testing.T) {
 		mockRepo := mocks.Repo{}
 		testCrud := crud.Crud{
 			Repo:   &mockRepo,
@@ -243,15 +270,127 @@ func TestUpdateUser(t *testing.T) {
 		}
 
 		ctx := context.Background()
-		mockRepo.On("UpdateUser", mock.Anything, mock.Anything).Return(nil, &dynamo.UniqueConstraintViolation{Message: "x"})
+		testUser := makeTestUser()
+		mockRepo.On("UpdateUser", mock.Anything, mock.Anything, int64(2)).Return(&testUser, nil)
 
-		userMap := getUserMap()
+		res, err := handlers.UpdateUser(ctx, events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{"id": testUser.ID},
+			Headers:        map[string]string{"if-match": `"2"`},
+			Body:           toJsonEscapedString(toUserMap(&testUser)),
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, `"3"`, res.Headers["ETag"])
+	})
+	t.Run("passes the version of users stored before versioning to the repo", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+		testUser := makeTestUser()
+		testUser.Version = 1
+		mockRepo.On("UpdateUser", mock.Anything, mock.Anything, int64(0)).Return(&testUser, nil)
 
 		res, err := handlers.UpdateUser(ctx, events.APIGatewayProxyRequest{
-			Body: toJsonEscapedString(userMap),
+			PathParameters: map[string]string{"id": testUser.ID},
+			Headers:        map[string]string{"If-Match": `"0"`},
+			Body:           toJsonEscapedString(toUserMap(&testUser)),
 		}, &testCrud)
 		assert.NoError(t, err)
 
-		assert.Equal(t, 400, res.StatusCode)
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, `"1"`, res.Headers["ETag"])
+		mockRepo.AssertExpectations(t)
+	})
+	t.Run("returns 412 when If-Match is not a strong version tag", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+		testUser := makeTestUser()
+
+		res, err := handlers.UpdateUser(ctx, events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{"id": testUser.ID},
+			Headers:        map[string]string{"If-Match": `W/"2"`},
+			Body:           toJsonEscapedString(toUserMap(&testUser)),
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 412, res.StatusCode)
+		mockRepo.AssertNotCalled(t, "UpdateUser", mock.Anything, mock.Anything, mock.Anything)
+	})
+	t.Run("returns 412 when version conflict occurs", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+		mockRepo.On("UpdateUser", mock.Anything, mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: expected version 2, found 3", repo.ErrConflict))
+
+		testUser := makeTestUser()
+
+		res, err := handlers.UpdateUser(ctx, events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{"id": testUser.ID},
+			Headers:        map[string]string{"If-Match": `"2"`},
+			Body:           toJsonEscapedString(toUserMap(&testUser)),
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 412, res.StatusCode)
+	})
+	t.Run("returns 409 when a concurrent write conflicts without If-Match", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+		mockRepo.On("UpdateUser", mock.Anything, mock.Anything, mock.Anything).Return(nil, repo.ErrConflict)
+
+		testUser := makeTestUser()
+
+		res, err := handlers.UpdateUser(ctx, events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{"id": testUser.ID},
+			Body:           toJsonEscapedString(toUserMap(&testUser)),
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 409, res.StatusCode)
+	})
+	t.Run("returns 409 when uniqueness violation occurs", func(t *testing.T) {
+		mockRepo := mocks.Repo{}
+		testCrud := crud.Crud{
+			Repo:   &mockRepo,
+			Logger: zaptest.NewLogger(t),
+			Config: &config.Config{},
+		}
+
+		ctx := context.Background()
+		mockRepo.On("UpdateUser", mock.Anything, mock.Anything, mock.Anything).Return(nil, &repo.ErrUnique{Field: "email"})
+
+		testUser := makeTestUser()
+		userMap := toUserMap(&testUser)
+
+		res, err := handlers.UpdateUser(ctx, events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{"id": testUser.ID},
+			Body:           toJsonEscapedString(userMap),
+		}, &testCrud)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 409, res.StatusCode)
 	})
 }
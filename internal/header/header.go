@@ -0,0 +1,16 @@
+// Package header reads the headers of requests, which API Gateway passes
+// through with whatever casing the client used.
+package header
+
+import "strings"
+
+// Get looks up a header case insensitively
+func Get(headers map[string]string, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,20 @@
+package header_test
+
+import (
+	"testing"
+
+	"github.com/crestenstclair/crud/internal/header"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGet(t *testing.T) {
+	t.Run("Ignores the casing of header names", func(t *testing.T) {
+		headers := map[string]string{"if-match": `"3"`}
+
+		assert.Equal(t, `"3"`, header.Get(headers, "If-Match"))
+	})
+
+	t.Run("Returns an empty string for missing headers", func(t *testing.T) {
+		assert.Empty(t, header.Get(map[string]string{}, "If-Match"))
+	})
+}
@@ -0,0 +1,141 @@
+// Package history describes the changes made to users. Every write to a user
+// appends a record of who made it, when, and what it changed, so there is an
+// audit trail of the user's previous states.
+package history
+
+import (
+	"context"
+	"time"
+
+	"github.com/crestenstclair/crud/internal/logging"
+	"github.com/crestenstclair/crud/internal/user"
+)
+
+// Operation is the kind of write a record describes
+type Operation string
+
+const (
+	Create  Operation = "create"
+	Update  Operation = "update"
+	Delete  Operation = "delete"
+	Restore Operation = "restore"
+	Revert  Operation = "revert"
+)
+
+// Anonymous is the actor of writes made by requests that were not
+// authenticated
+const Anonymous = "anonymous"
+
+// Change is a field whose value was changed by a write. Before is empty for
+// fields that were set for the first time, and After for fields that were
+// cleared.
+type Change struct {
+	Field  string
+	Before string
+	After  string
+}
+
+// Record describes a single write to a user. Records are never changed once
+// written, except by the purge, which scrubs the details of purged users from
+// them.
+type Record struct {
+	UserID string
+	// Version is the user's version after the write, so records are ordered
+	// and unique per user
+	Version   int64
+	Operation Operation
+	Actor     string
+	// RequestID ties the record to the request's log lines
+	RequestID string
+	// Timestamp is when the write was made, which is also the user's
+	// LastModified after it
+	Timestamp string
+	Changes   []Change
+	// User is a snapshot of the user after the write, so earlier states can
+	// be read back and reverted to
+	User *user.User `dynamodbav:",omitempty"`
+	// Scrubbed records had the user's details removed when it was purged,
+	// leaving only which fields changed
+	Scrubbed bool `dynamodbav:",omitempty"`
+}
+
+// Scrub returns the record without the user's details, keeping who made the
+// write, when, and which fields it changed
+func (r Record) Scrub() Record {
+	changes := make([]Change, 0, len(r.Changes))
+	for _, change := range r.Changes {
+		changes = append(changes, Change{Field: change.Field})
+	}
+
+	r.Changes = changes
+	r.User = nil
+	r.Scrubbed = true
+
+	return r
+}
+
+// At parses when the write was made
+func (r Record) At() (time.Time, error) {
+	return time.Parse(time.RFC3339, r.Timestamp)
+}
+
+// New describes the write that changed before into after. before is nil for
+// users being created.
+func New(ctx context.Context, op Operation, before *user.User, after user.User) Record {
+	if before == nil {
+		before = &user.User{}
+	}
+
+	return Record{
+		UserID:    after.ID,
+		Version:   after.Version,
+		Operation: op,
+		Actor:     Actor(ctx),
+		RequestID: logging.RequestID(ctx),
+		Timestamp: after.LastModified,
+		Changes:   Diff(*before, after),
+		User:      &after,
+	}
+}
+
+// Diff lists the fields that differ between before and after, named as they
+// are in the API. Bookkeeping fields such as LastModified and Version are
+// left out, since every write changes them.
+func Diff(before user.User, after user.User) []Change {
+	fields := []struct {
+		name          string
+		before, after string
+	}{
+		{"firstName", before.FirstName, after.FirstName},
+		{"lastName", before.LastName, after.LastName},
+		{"email", before.Email, after.Email},
+		{"dob", before.DOB, after.DOB},
+		{"deletedAt", before.DeletedAt, after.DeletedAt},
+	}
+
+	changes := []Change{}
+	for _, f := range fields {
+		if f.before != f.after {
+			changes = append(changes, Change{Field: f.name, Before: f.before, After: f.after})
+		}
+	}
+
+	return changes
+}
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx carrying who is making the request
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor returns who is making the request ctx belongs to, or Anonymous when
+// it is not known
+func Actor(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+
+	return Anonymous
+}
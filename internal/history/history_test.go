@@ -0,0 +1,87 @@
+package history_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crestenstclair/crud/internal/history"
+	"github.com/crestenstclair/crud/internal/logging"
+	"github.com/crestenstclair/crud/internal/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("Records who made the write and when", func(t *testing.T) {
+		ctx := history.WithActor(logging.WithRequestID(context.Background(), "request-id"), "auth0|fred")
+		before := user.User{ID: "123", Email: "fred@example.com", Version: 3}
+		after := user.User{ID: "123", Email: "wilma@example.com", Version: 4, LastModified: "2023-01-02T03:04:05Z"}
+
+		record := history.New(ctx, history.Update, &before, after)
+
+		assert.Equal(t, history.Record{
+			UserID:    "123",
+			Version:   4,
+			Operation: history.Update,
+			Actor:     "auth0|fred",
+			RequestID: "request-id",
+			Timestamp: "2023-01-02T03:04:05Z",
+			Changes:   []history.Change{{Field: "email", Before: "fred@example.com", After: "wilma@example.com"}},
+			User:      &after,
+		}, record)
+	})
+
+	t.Run("Records every field set by a create", func(t *testing.T) {
+		record := history.New(context.Background(), history.Create, nil, user.User{
+			ID:        "123",
+			FirstName: "Fred",
+			LastName:  "Flintstone",
+			Email:     "fred@example.com",
+			DOB:       "1979-12-09T00:00:00Z",
+			Version:   1,
+		})
+
+		assert.Equal(t, history.Anonymous, record.Actor)
+		assert.Equal(t, []history.Change{
+			{Field: "firstName", After: "Fred"},
+			{Field: "lastName", After: "Flintstone"},
+			{Field: "email", After: "fred@example.com"},
+			{Field: "dob", After: "1979-12-09T00:00:00Z"},
+		}, record.Changes)
+	})
+}
+
+func TestDiff(t *testing.T) {
+	t.Run("Leaves out bookkeeping fields", func(t *testing.T) {
+		before := user.User{FirstName: "Fred", LastModified: "2023-01-01T00:00:00Z", Version: 1}
+		after := user.User{FirstName: "Fred", LastModified: "2023-01-02T00:00:00Z", Version: 2}
+
+		assert.Empty(t, history.Diff(before, after))
+	})
+
+	t.Run("Records deletion", func(t *testing.T) {
+		before := user.User{FirstName: "Fred"}
+		after := user.User{FirstName: "Fred", DeletedAt: "2023-01-02T00:00:00Z"}
+
+		assert.Equal(t, []history.Change{{Field: "deletedAt", After: "2023-01-02T00:00:00Z"}}, history.Diff(before, after))
+	})
+}
+
+func TestScrub(t *testing.T) {
+	t.Run("Removes the user's details but not who changed what", func(t *testing.T) {
+		ctx := history.WithActor(context.Background(), "auth0|fred")
+		before := user.User{ID: "123", Email: "fred@example.com", Version: 3}
+		after := user.User{ID: "123", Email: "wilma@example.com", Version: 4, LastModified: "2023-01-02T03:04:05Z"}
+
+		record := history.New(ctx, history.Update, &before, after).Scrub()
+
+		assert.Equal(t, history.Record{
+			UserID:    "123",
+			Version:   4,
+			Operation: history.Update,
+			Actor:     "auth0|fred",
+			Timestamp: "2023-01-02T03:04:05Z",
+			Changes:   []history.Change{{Field: "email"}},
+			Scrubbed:  true,
+		}, record)
+	})
+}
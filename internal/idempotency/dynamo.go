@@ -0,0 +1,154 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// DynamoStore keeps records in a DynamoDB table keyed by the string
+// attribute "Key". ExpiresAt should be the table's TTL attribute, so expired
+// records are deleted.
+type DynamoStore struct {
+	client      dynamodbiface.DynamoDBAPI
+	tableName   string
+	ttl         time.Duration
+	lockTimeout time.Duration
+}
+
+func NewDynamoStore(tableName string, client dynamodbiface.DynamoDBAPI, ttl time.Duration, lockTimeout time.Duration) *DynamoStore {
+	return &DynamoStore{client: client, tableName: tableName, ttl: ttl, lockTimeout: lockTimeout}
+}
+
+func (s *DynamoStore) Claim(ctx context.Context, key string, fingerprint string) (*Record, bool, error) {
+	now := time.Now()
+
+	av, err := dynamodbattribute.MarshalMap(item{
+		Key:         key,
+		Fingerprint: fingerprint,
+		ClaimedAt:   now.UnixMilli(),
+		ExpiresAt:   now.Add(s.ttl).Unix(),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	// DynamoDB deletes expired items some time after they expire, so expiry
+	// is checked here too. The existing record is returned when the condition
+	// fails, saving a read.
+	_, err = s.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: &s.tableName,
+		Item:      av,
+		ConditionExpression: aws.String("attribute_not_exists(#key) OR ExpiresAt <= :now OR " +
+			"(attribute_not_exists(#response) AND ClaimedAt <= :stale)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#key":      aws.String("Key"),
+			"#response": aws.String("Response"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now":   {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+			":stale": {N: aws.String(strconv.FormatInt(now.Add(-s.lockTimeout).UnixMilli(), 10))},
+		},
+		ReturnValuesOnConditionCheckFailure: aws.String(dynamodb.ReturnValuesOnConditionCheckFailureAllOld),
+	})
+
+	var failed *dynamodb.ConditionalCheckFailedException
+	if errors.As(err, &failed) {
+		record, err := decodeRecord(failed.Item)
+		return record, false, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return nil, true, nil
+}
+
+func (s *DynamoStore) Complete(ctx context.Context, key string, response events.APIGatewayProxyResponse) error {
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName:           &s.tableName,
+		Key:                 map[string]*dynamodb.AttributeValue{"Key": {S: aws.String(key)}},
+		UpdateExpression:    aws.String("SET #response = :response"),
+		ConditionExpression: aws.String("attribute_exists(#key)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#key":      aws.String("Key"),
+			"#response": aws.String("Response"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":response": {S: aws.String(string(encoded))},
+		},
+	})
+
+	return err
+}
+
+func (s *DynamoStore) Release(ctx context.Context, key string) error {
+	_, err := s.client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName:           &s.tableName,
+		Key:                 map[string]*dynamodb.AttributeValue{"Key": {S: aws.String(key)}},
+		ConditionExpression: aws.String("attribute_not_exists(#response)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#response": aws.String("Response"),
+		},
+	})
+
+	// A response was stored after all, which is kept
+	var failed *dynamodb.ConditionalCheckFailedException
+	if errors.As(err, &failed) {
+		return nil
+	}
+
+	return err
+}
+
+// item is how a record is stored
+type item struct {
+	Key         string
+	Fingerprint string
+	// ClaimedAt is in epoch milliseconds
+	ClaimedAt int64
+	// ExpiresAt is in epoch seconds, as DynamoDB TTL requires
+	ExpiresAt int64
+	// Response is JSON, and is missing until the request has finished
+	Response string `dynamodbav:",omitempty"`
+}
+
+func decodeRecord(av map[string]*dynamodb.AttributeValue) (*Record, error) {
+	if av == nil {
+		return nil, errors.New("idempotency record missing from failed claim")
+	}
+
+	var stored item
+	if err := dynamodbattribute.UnmarshalMap(av, &stored); err != nil {
+		return nil, err
+	}
+
+	record := &Record{
+		Key:         stored.Key,
+		Fingerprint: stored.Fingerprint,
+		ClaimedAt:   time.UnixMilli(stored.ClaimedAt),
+		ExpiresAt:   time.Unix(stored.ExpiresAt, 0),
+	}
+
+	if stored.Response != "" {
+		record.Response = &events.APIGatewayProxyResponse{}
+		if err := json.Unmarshal([]byte(stored.Response), record.Response); err != nil {
+			return nil, err
+		}
+	}
+
+	return record, nil
+}
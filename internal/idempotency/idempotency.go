@@ -0,0 +1,46 @@
+// Package idempotency stores the responses to requests sent with an
+// Idempotency-Key header, so a client retrying a request gets the response to
+// the first attempt instead of repeating its effects.
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Record is what is stored for a key
+type Record struct {
+	Key string
+	// Fingerprint identifies the request that claimed the key, so the key
+	// cannot be reused for a different request
+	Fingerprint string
+	ClaimedAt   time.Time
+	ExpiresAt   time.Time
+	// Response is nil until the request that claimed the key has finished
+	Response *events.APIGatewayProxyResponse
+}
+
+// Store holds records until they expire. A claim whose request has not
+// finished within the store's lock timeout may be claimed again, so a request
+// that crashed does not hold its key until it expires.
+type Store interface {
+	// Claim records that a request is being handled for key. When key is
+	// already claimed, the existing record is returned and claimed is false.
+	Claim(ctx context.Context, key string, fingerprint string) (record *Record, claimed bool, err error)
+	// Complete stores the response to the request that claimed key
+	Complete(ctx context.Context, key string, response events.APIGatewayProxyResponse) error
+	// Release forgets a claim that has no response, so the request can be
+	// tried again
+	Release(ctx context.Context, key string) error
+}
+
+// claimable reports whether a request may claim the key of record at now
+func claimable(record *Record, now time.Time, lockTimeout time.Duration) bool {
+	if record == nil || !now.Before(record.ExpiresAt) {
+		return true
+	}
+
+	return record.Response == nil && !now.Before(record.ClaimedAt.Add(lockTimeout))
+}
@@ -0,0 +1,173 @@
+package idempotency_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/crestenstclair/crud/internal/idempotency"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Claims each key once", func(t *testing.T) {
+		store := idempotency.NewMemoryStore(time.Hour, time.Minute)
+
+		record, claimed, err := store.Claim(ctx, "key", "first")
+		assert.NoError(t, err)
+		assert.True(t, claimed)
+		assert.Nil(t, record)
+
+		record, claimed, err = store.Claim(ctx, "key", "second")
+		assert.NoError(t, err)
+		assert.False(t, claimed)
+		assert.Equal(t, "first", record.Fingerprint)
+		assert.Nil(t, record.Response)
+	})
+
+	t.Run("Returns the stored response", func(t *testing.T) {
+		store := idempotency.NewMemoryStore(time.Hour, time.Minute)
+
+		_, _, _ = store.Claim(ctx, "key", "fingerprint")
+		assert.NoError(t, store.Complete(ctx, "key", events.APIGatewayProxyResponse{StatusCode: 200, Body: "created"}))
+
+		record, claimed, err := store.Claim(ctx, "key", "fingerprint")
+		assert.NoError(t, err)
+		assert.False(t, claimed)
+		assert.Equal(t, "created", record.Response.Body)
+	})
+
+	t.Run("Frees released keys", func(t *testing.T) {
+		store := idempotency.NewMemoryStore(time.Hour, time.Minute)
+
+		_, _, _ = store.Claim(ctx, "key", "fingerprint")
+		assert.NoError(t, store.Release(ctx, "key"))
+
+		_, claimed, err := store.Claim(ctx, "key", "fingerprint")
+		assert.NoError(t, err)
+		assert.True(t, claimed)
+	})
+
+	t.Run("Frees keys once they expire", func(t *testing.T) {
+		store := idempotency.NewMemoryStore(10*time.Millisecond, time.Minute)
+
+		_, _, _ = store.Claim(ctx, "key", "fingerprint")
+		assert.NoError(t, store.Complete(ctx, "key", events.APIGatewayProxyResponse{StatusCode: 200}))
+		time.Sleep(20 * time.Millisecond)
+
+		_, claimed, err := store.Claim(ctx, "key", "fingerprint")
+		assert.NoError(t, err)
+		assert.True(t, claimed)
+	})
+
+	t.Run("Frees keys of requests that never finished", func(t *testing.T) {
+		store := idempotency.NewMemoryStore(time.Hour, 10*time.Millisecond)
+
+		_, _, _ = store.Claim(ctx, "key", "fingerprint")
+		time.Sleep(20 * time.Millisecond)
+
+		_, claimed, err := store.Claim(ctx, "key", "fingerprint")
+		assert.NoError(t, err)
+		assert.True(t, claimed)
+	})
+}
+
+type dynamodbMockClient struct {
+	dynamodbiface.DynamoDBAPI
+	mock.Mock
+}
+
+func (m *dynamodbMockClient) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, _ ...request.Option) (*dynamodb.PutItemOutput, error) {
+	args := m.Called(ctx, input)
+
+	return &dynamodb.PutItemOutput{}, args.Error(1)
+}
+
+func (m *dynamodbMockClient) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, _ ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	args := m.Called(ctx, input)
+
+	return &dynamodb.UpdateItemOutput{}, args.Error(1)
+}
+
+func (m *dynamodbMockClient) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, _ ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	args := m.Called(ctx, input)
+
+	return &dynamodb.DeleteItemOutput{}, args.Error(1)
+}
+
+func TestDynamoStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Claims keys with a conditional put", func(t *testing.T) {
+		client := &dynamodbMockClient{}
+		client.On("PutItemWithContext", ctx, mock.MatchedBy(func(input *dynamodb.PutItemInput) bool {
+			return aws.StringValue(input.TableName) == "idempotency" &&
+				aws.StringValue(input.Item["Key"].S) == "key" &&
+				aws.StringValue(input.Item["Fingerprint"].S) == "fingerprint" &&
+				input.Item["ExpiresAt"].N != nil &&
+				aws.StringValue(input.ReturnValuesOnConditionCheckFailure) == "ALL_OLD"
+		})).Return(nil, nil)
+		store := idempotency.NewDynamoStore("idempotency", client, time.Hour, time.Minute)
+
+		record, claimed, err := store.Claim(ctx, "key", "fingerprint")
+
+		assert.NoError(t, err)
+		assert.True(t, claimed)
+		assert.Nil(t, record)
+		client.AssertExpectations(t)
+	})
+
+	t.Run("Returns the record that holds the key", func(t *testing.T) {
+		client := &dynamodbMockClient{}
+		client.On("PutItemWithContext", ctx, mock.Anything).Return(nil, &dynamodb.ConditionalCheckFailedException{
+			Item: map[string]*dynamodb.AttributeValue{
+				"Key":         {S: aws.String("key")},
+				"Fingerprint": {S: aws.String("fingerprint")},
+				"ClaimedAt":   {N: aws.String("1700000000000")},
+				"ExpiresAt":   {N: aws.String("1700086400")},
+				"Response":    {S: aws.String(`{"statusCode":200,"headers":{"ETag":"\"1\""},"body":"created"}`)},
+			},
+		})
+		store := idempotency.NewDynamoStore("idempotency", client, time.Hour, time.Minute)
+
+		record, claimed, err := store.Claim(ctx, "key", "other")
+
+		assert.NoError(t, err)
+		assert.False(t, claimed)
+		assert.Equal(t, "fingerprint", record.Fingerprint)
+		assert.Equal(t, time.UnixMilli(1700000000000), record.ClaimedAt)
+		assert.Equal(t, 200, record.Response.StatusCode)
+		assert.Equal(t, `"1"`, record.Response.Headers["ETag"])
+		assert.Equal(t, "created", record.Response.Body)
+	})
+
+	t.Run("Stores responses as JSON", func(t *testing.T) {
+		client := &dynamodbMockClient{}
+		client.On("UpdateItemWithContext", ctx, mock.MatchedBy(func(input *dynamodb.UpdateItemInput) bool {
+			return aws.StringValue(input.Key["Key"].S) == "key" &&
+				aws.StringValue(input.ExpressionAttributeValues[":response"].S) == `{"statusCode":201,"headers":null,"multiValueHeaders":null,"body":"created"}`
+		})).Return(nil, nil)
+		store := idempotency.NewDynamoStore("idempotency", client, time.Hour, time.Minute)
+
+		err := store.Complete(ctx, "key", events.APIGatewayProxyResponse{StatusCode: 201, Body: "created"})
+
+		assert.NoError(t, err)
+		client.AssertExpectations(t)
+	})
+
+	t.Run("Keeps responses stored before a release", func(t *testing.T) {
+		client := &dynamodbMockClient{}
+		client.On("DeleteItemWithContext", ctx, mock.Anything).Return(nil, &dynamodb.ConditionalCheckFailedException{})
+		store := idempotency.NewDynamoStore("idempotency", client, time.Hour, time.Minute)
+
+		assert.NoError(t, store.Release(ctx, "key"))
+	})
+}
@@ -0,0 +1,64 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// MemoryStore keeps records in memory, for tests and the memory repo backend
+type MemoryStore struct {
+	ttl         time.Duration
+	lockTimeout time.Duration
+
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func NewMemoryStore(ttl time.Duration, lockTimeout time.Duration) *MemoryStore {
+	return &MemoryStore{ttl: ttl, lockTimeout: lockTimeout, records: map[string]Record{}}
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, key string, fingerprint string) (*Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := s.records[key]; ok && !claimable(&existing, now, s.lockTimeout) {
+		return &existing, false, nil
+	}
+
+	s.records[key] = Record{
+		Key:         key,
+		Fingerprint: fingerprint,
+		ClaimedAt:   now,
+		ExpiresAt:   now.Add(s.ttl),
+	}
+
+	return nil, true, nil
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, key string, response events.APIGatewayProxyResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record, ok := s.records[key]; ok {
+		record.Response = &response
+		s.records[key] = record
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record, ok := s.records[key]; ok && record.Response == nil {
+		delete(s.records, key)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+// Package logging carries per-request logging state through contexts, so log
+// lines written anywhere while handling a request can be tied back to it.
+package logging
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type requestIDKey struct{}
+
+type loggerKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request's ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID of the request ctx belongs to, or "" outside of a
+// request
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithLogger returns a copy of ctx carrying the logger for the request
+func WithLogger(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger for the request ctx belongs to. Outside of a
+// request it returns a logger that discards everything, so code that logs
+// never needs to check.
+func FromContext(ctx context.Context) *zap.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+		return logger
+	}
+
+	return zap.NewNop()
+}
@@ -0,0 +1,41 @@
+package logging_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crestenstclair/crud/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRequestID(t *testing.T) {
+	t.Run("Returns the ID stored in the context", func(t *testing.T) {
+		ctx := logging.WithRequestID(context.Background(), "request-id")
+
+		assert.Equal(t, "request-id", logging.RequestID(ctx))
+	})
+
+	t.Run("Returns an empty ID outside of a request", func(t *testing.T) {
+		assert.Empty(t, logging.RequestID(context.Background()))
+	})
+}
+
+func TestFromContext(t *testing.T) {
+	t.Run("Returns the logger stored in the context", func(t *testing.T) {
+		core, logs := observer.New(zap.InfoLevel)
+		ctx := logging.WithLogger(context.Background(), zap.New(core))
+
+		logging.FromContext(ctx).Info("hello")
+
+		assert.Equal(t, 1, logs.Len())
+	})
+
+	t.Run("Returns a logger that discards everything outside of a request", func(t *testing.T) {
+		logger := logging.FromContext(context.Background())
+
+		assert.NotNil(t, logger)
+		logger.Info("discarded")
+	})
+}
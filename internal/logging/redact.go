@@ -0,0 +1,157 @@
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+// Redaction controls how personal data is written to logs. Fields holding
+// personal data are classified with a pii struct tag naming the kind of data,
+// e.g. `pii:"email"`.
+type Redaction string
+
+const (
+	// RedactMask keeps enough of a value to help debugging, such as the
+	// domain of an email or the year of a date of birth
+	RedactMask Redaction = "mask"
+	// RedactHash replaces values with a hash, so the same value can be
+	// followed through the logs without being revealed
+	RedactHash Redaction = "hash"
+	// RedactFull removes values entirely
+	RedactFull Redaction = "full"
+)
+
+// redacted replaces values that are removed entirely
+const redacted = "[REDACTED]"
+
+var redaction atomic.Value
+
+func init() {
+	redaction.Store(RedactMask)
+}
+
+// SetRedaction sets how personal data is redacted by Redact and Body
+func SetRedaction(r Redaction) error {
+	switch r {
+	case RedactMask, RedactHash, RedactFull:
+		redaction.Store(r)
+		return nil
+	default:
+		return fmt.Errorf("unknown redaction %q, expected mask, hash or full", r)
+	}
+}
+
+// Redact redacts value, which holds personal data of the given class
+func Redact(class string, value string) string {
+	if value == "" {
+		return ""
+	}
+
+	switch redaction.Load().(Redaction) {
+	case RedactFull:
+		return redacted
+	case RedactHash:
+		sum := sha256.Sum256([]byte(value))
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	default:
+		return mask(class, value)
+	}
+}
+
+func mask(class string, value string) string {
+	switch class {
+	case "email":
+		local, domain, ok := strings.Cut(value, "@")
+		if !ok || local == "" {
+			return "***"
+		}
+		return firstRune(local) + "***@" + domain
+	case "dob":
+		dob, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return "***"
+		}
+		return fmt.Sprintf("%04d-**-**", dob.Year())
+	case "name":
+		return firstRune(value) + "***"
+	default:
+		return "***"
+	}
+}
+
+func firstRune(s string) string {
+	_, size := utf8.DecodeRuneInString(s)
+	return s[:size]
+}
+
+// Body logs a JSON request body, redacting the keys schema tags as personal
+// data. Keys are matched case insensitively, and keys schema does not know
+// about are removed entirely, since nothing says they are safe to log.
+func Body(key string, body string, schema any) zap.Field {
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(body), &fields); err != nil {
+		return zap.String(key, fmt.Sprintf("[unparseable body, %d bytes]", len(body)))
+	}
+
+	classes := classify(reflect.TypeOf(schema))
+	for name, value := range fields {
+		class, known := classes[strings.ToLower(name)]
+		switch {
+		case !known:
+			fields[name] = redacted
+		case class != "":
+			fields[name] = Redact(class, fmt.Sprint(value))
+		}
+	}
+
+	return zap.Any(key, fields)
+}
+
+// classify maps the lowercased json names of t's fields to their pii class,
+// which is empty for fields that are safe to log
+func classify(t reflect.Type) map[string]string {
+	classes := map[string]string{}
+	if t == nil {
+		return classes
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return classes
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name, ok := fieldName(f); ok {
+			classes[strings.ToLower(name)] = f.Tag.Get("pii")
+		}
+	}
+
+	return classes
+}
+
+func fieldName(f reflect.StructField) (string, bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return "", false
+	case "":
+		return f.Name, true
+	default:
+		return name, true
+	}
+}
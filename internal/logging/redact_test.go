@@ -0,0 +1,93 @@
+package logging_test
+
+import (
+	"testing"
+
+	"github.com/crestenstclair/crud/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func setRedaction(t *testing.T, r logging.Redaction) {
+	assert.NoError(t, logging.SetRedaction(r))
+	t.Cleanup(func() {
+		_ = logging.SetRedaction(logging.RedactMask)
+	})
+}
+
+// logged returns the fields written by logging field
+func logged(field zap.Field) map[string]any {
+	core, logs := observer.New(zap.InfoLevel)
+	zap.New(core).Info("test", field)
+
+	return logs.All()[0].ContextMap()
+}
+
+func TestRedact(t *testing.T) {
+	t.Run("Masks part of each value by default", func(t *testing.T) {
+		assert.Equal(t, "f***@example.com", logging.Redact("email", "fred@example.com"))
+		assert.Equal(t, "1979-**-**", logging.Redact("dob", "1979-12-09T00:00:00Z"))
+		assert.Equal(t, "F***", logging.Redact("name", "Fred"))
+		assert.Equal(t, "É***", logging.Redact("name", "Éloïse"))
+		assert.Equal(t, "***", logging.Redact("email", "not-an-email"))
+		assert.Equal(t, "***", logging.Redact("phone", "555-1234"))
+	})
+
+	t.Run("Hashes values consistently", func(t *testing.T) {
+		setRedaction(t, logging.RedactHash)
+
+		hashed := logging.Redact("email", "fred@example.com")
+
+		assert.Regexp(t, "^sha256:[0-9a-f]{16}$", hashed)
+		assert.Equal(t, hashed, logging.Redact("email", "fred@example.com"))
+		assert.NotEqual(t, hashed, logging.Redact("email", "wilma@example.com"))
+	})
+
+	t.Run("Removes values entirely when fully redacting", func(t *testing.T) {
+		setRedaction(t, logging.RedactFull)
+
+		assert.Equal(t, "[REDACTED]", logging.Redact("email", "fred@example.com"))
+	})
+
+	t.Run("Leaves empty values empty", func(t *testing.T) {
+		assert.Equal(t, "", logging.Redact("email", ""))
+	})
+
+	t.Run("Rejects unknown redactions", func(t *testing.T) {
+		assert.Error(t, logging.SetRedaction("partial"))
+	})
+}
+
+func TestBody(t *testing.T) {
+	schema := struct {
+		FirstName string `json:"firstName" pii:"name"`
+		Email     string `json:"email" pii:"email"`
+		Source    string `json:"source"`
+	}{}
+
+	t.Run("Redacts the keys the schema tags as personal data", func(t *testing.T) {
+		fields := logged(logging.Body("body", `{"firstName":"Fred","email":"fred@example.com","source":"web"}`, schema))
+
+		assert.Equal(t, map[string]any{
+			"firstName": "F***",
+			"email":     "f***@example.com",
+			"source":    "web",
+		}, fields["body"])
+	})
+
+	t.Run("Redacts miscased and unknown keys", func(t *testing.T) {
+		fields := logged(logging.Body("body", `{"Email":"fred@example.com","phone":"555-1234"}`, schema))
+
+		assert.Equal(t, map[string]any{
+			"Email": "f***@example.com",
+			"phone": "[REDACTED]",
+		}, fields["body"])
+	})
+
+	t.Run("Does not log bodies it cannot parse", func(t *testing.T) {
+		fields := logged(logging.Body("body", `fred@example.com`, schema))
+
+		assert.Equal(t, "[unparseable body, 16 bytes]", fields["body"])
+	})
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// EMF writes metrics to the logs in CloudWatch Embedded Metric Format, which
+// CloudWatch turns into metrics without any calls to its API.
+// https://docs.aws.amazon.com/AmazonCloudWatch/latest/monitoring/CloudWatch_Embedded_Metric_Format_Specification.html
+type EMF struct {
+	logger    *zap.Logger
+	namespace string
+}
+
+// NewEMF writes metrics to w as JSON lines. They are written by a logger of
+// their own, since the application's logger samples repeated messages and
+// every dropped line would be a request missing from the metrics.
+func NewEMF(w io.Writer, namespace string) *EMF {
+	logger := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.Lock(zapcore.AddSync(w)),
+		zap.InfoLevel,
+	))
+
+	return &EMF{logger: logger, namespace: namespace}
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+// Request records Requests and Latency by route and method. Requests are also
+// broken down by status class.
+func (e *EMF) Request(ctx context.Context, m RequestMetric) {
+	e.emit("Request metrics",
+		[][]string{{"Route", "Method"}, {"Route", "Method", "StatusClass"}},
+		[]emfMetric{{Name: "Requests", Unit: "Count"}, {Name: "Latency", Unit: "Milliseconds"}},
+		zap.String("Route", m.Route),
+		zap.String("Method", m.Method),
+		zap.String("StatusClass", StatusClass(m.Status)),
+		zap.Int("Status", m.Status),
+		zap.Int("Requests", 1),
+		zap.Float64("Latency", milliseconds(m.Latency)),
+	)
+}
+
+// RepoOperation records Calls, Errors and Latency by operation. Only backend
+// failures count as Errors, see IsFailure.
+func (e *EMF) RepoOperation(ctx context.Context, m RepoMetric) {
+	outcome := Outcome(m.Err)
+
+	failed := 0
+	if IsFailure(outcome) {
+		failed = 1
+	}
+
+	e.emit("Repo metrics",
+		[][]string{{"Operation"}},
+		[]emfMetric{{Name: "Calls", Unit: "Count"}, {Name: "Errors", Unit: "Count"}, {Name: "Latency", Unit: "Milliseconds"}},
+		zap.String("Operation", m.Operation),
+		zap.String("Outcome", outcome),
+		zap.Int("Calls", 1),
+		zap.Int("Errors", failed),
+		zap.Float64("Latency", milliseconds(m.Latency)),
+	)
+}
+
+func (e *EMF) emit(msg string, dimensions [][]string, metrics []emfMetric, fields ...zap.Field) {
+	metadata := emfMetadata{
+		Timestamp: time.Now().UnixMilli(),
+		CloudWatchMetrics: []emfDirective{{
+			Namespace:  e.namespace,
+			Dimensions: dimensions,
+			Metrics:    metrics,
+		}},
+	}
+
+	e.logger.Info(msg, append([]zap.Field{zap.Any("_aws", metadata)}, fields...)...)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,111 @@
+// Package metrics records how requests and repo operations behave. In Lambda
+// metrics are written to the logs in CloudWatch Embedded Metric Format, and
+// the standalone server exposes them to Prometheus.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type Recorder interface {
+	Request(ctx context.Context, m RequestMetric)
+	RepoOperation(ctx context.Context, m RepoMetric)
+}
+
+// RequestMetric describes a handled request. Route is the route template,
+// never the raw path, so the number of distinct routes stays bounded.
+type RequestMetric struct {
+	Route   string
+	Method  string
+	Status  int
+	Latency time.Duration
+}
+
+type RepoMetric struct {
+	Operation string
+	Err       error
+	Latency   time.Duration
+}
+
+// New builds the recorder selected by cfg.MetricsBackend. "auto" picks EMF
+// inside Lambda and Prometheus everywhere else.
+func New(cfg *config.Config) (Recorder, error) {
+	backend := cfg.MetricsBackend
+	if backend == "auto" {
+		backend = "prometheus"
+		if os.Getenv("AWS_LAMBDA_FUNCTION_NAME") != "" {
+			backend = "emf"
+		}
+	}
+
+	switch backend {
+	case "emf":
+		return NewEMF(os.Stdout, cfg.MetricsNamespace), nil
+	case "prometheus":
+		return NewPrometheus(prometheus.NewRegistry())
+	case "none":
+		return Nop{}, nil
+	default:
+		return nil, fmt.Errorf("unknown METRICS_BACKEND %q, expected auto, emf, prometheus or none", cfg.MetricsBackend)
+	}
+}
+
+// Nop discards metrics
+type Nop struct{}
+
+func (Nop) Request(context.Context, RequestMetric) {}
+
+func (Nop) RepoOperation(context.Context, RepoMetric) {}
+
+// StatusClass groups statuses by their first digit, e.g. "4xx"
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+
+	return fmt.Sprintf("%dxx", status/100)
+}
+
+// Outcome classifies the result of a repo operation using the repo error
+// taxonomy
+func Outcome(err error) string {
+	var unique *repo.ErrUnique
+
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, repo.ErrNotFound):
+		return "not_found"
+	case errors.As(err, &unique):
+		return "unique"
+	case errors.Is(err, repo.ErrConflict):
+		return "conflict"
+	case errors.Is(err, repo.ErrThrottled):
+		return "throttled"
+	case errors.Is(err, repo.ErrUnavailable):
+		return "unavailable"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "error"
+	}
+}
+
+// IsFailure reports whether an outcome means the backend failed, rather than
+// the operation being refused because of the data, such as a missing user
+func IsFailure(outcome string) bool {
+	switch outcome {
+	case "ok", "not_found", "unique", "conflict":
+		return false
+	default:
+		return true
+	}
+}
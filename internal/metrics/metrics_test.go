@@ -0,0 +1,263 @@
+package metrics_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/metrics"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/repo/mocks"
+	"github.com/crestenstclair/crud/internal/user"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// spy keeps what it is asked to record
+type spy struct {
+	requests   []metrics.RequestMetric
+	operations []metrics.RepoMetric
+}
+
+func (s *spy) Request(ctx context.Context, m metrics.RequestMetric) {
+	s.requests = append(s.requests, m)
+}
+
+func (s *spy) RepoOperation(ctx context.Context, m metrics.RepoMetric) {
+	s.operations = append(s.operations, m)
+}
+
+// counter finds the value of the named counter with the given labels
+func counter(t *testing.T, registry *prometheus.Registry, name string, labels map[string]string) float64 {
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if hasLabels(m, labels) {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+
+	return 0
+}
+
+func hasLabels(m *dto.Metric, labels map[string]string) bool {
+	found := 0
+	for _, pair := range m.GetLabel() {
+		if value, ok := labels[pair.GetName()]; ok && value == pair.GetValue() {
+			found++
+		}
+	}
+
+	return found == len(labels)
+}
+
+func TestNew(t *testing.T) {
+	t.Run("Uses Prometheus outside Lambda", func(t *testing.T) {
+		t.Setenv("AWS_LAMBDA_FUNCTION_NAME", "")
+
+		recorder, err := metrics.New(&config.Config{MetricsBackend: "auto"})
+
+		assert.NoError(t, err)
+		assert.IsType(t, &metrics.Prometheus{}, recorder)
+	})
+
+	t.Run("Uses EMF inside Lambda", func(t *testing.T) {
+		t.Setenv("AWS_LAMBDA_FUNCTION_NAME", "crud-router")
+
+		recorder, err := metrics.New(&config.Config{MetricsBackend: "auto"})
+
+		assert.NoError(t, err)
+		assert.IsType(t, &metrics.EMF{}, recorder)
+	})
+
+	t.Run("Rejects unknown backends", func(t *testing.T) {
+		_, err := metrics.New(&config.Config{MetricsBackend: "statsd"})
+
+		assert.ErrorContains(t, err, "METRICS_BACKEND")
+	})
+}
+
+func TestOutcome(t *testing.T) {
+	for err, expected := range map[error]string{
+		nil:                                      "ok",
+		repo.ErrNotFound:                         "not_found",
+		&repo.ErrUnique{Field: "email"}:          "unique",
+		repo.ErrConflict:                         "conflict",
+		fmt.Errorf("put: %w", repo.ErrThrottled): "throttled",
+		repo.ErrUnavailable:                      "unavailable",
+		context.DeadlineExceeded:                 "timeout",
+		errors.New("boom"):                       "error",
+	} {
+		assert.Equal(t, expected, metrics.Outcome(err), "%v", err)
+	}
+
+	assert.False(t, metrics.IsFailure("not_found"))
+	assert.True(t, metrics.IsFailure("throttled"))
+}
+
+func TestStatusClass(t *testing.T) {
+	assert.Equal(t, "2xx", metrics.StatusClass(204))
+	assert.Equal(t, "4xx", metrics.StatusClass(404))
+	assert.Equal(t, "5xx", metrics.StatusClass(503))
+	assert.Equal(t, "unknown", metrics.StatusClass(0))
+}
+
+func TestEMF(t *testing.T) {
+	t.Run("Logs requests in Embedded Metric Format", func(t *testing.T) {
+		var buf bytes.Buffer
+		emf := metrics.NewEMF(&buf, "crud")
+
+		emf.Request(context.Background(), metrics.RequestMetric{
+			Route:   "/user/{id}",
+			Method:  "GET",
+			Status:  404,
+			Latency: 1500 * time.Microsecond,
+		})
+
+		var line map[string]any
+		err := json.Unmarshal(buf.Bytes(), &line)
+		assert.NoError(t, err)
+		assert.Equal(t, "/user/{id}", line["Route"])
+		assert.Equal(t, "GET", line["Method"])
+		assert.Equal(t, "4xx", line["StatusClass"])
+		assert.Equal(t, float64(1), line["Requests"])
+		assert.Equal(t, 1.5, line["Latency"])
+
+		metadata := line["_aws"].(map[string]any)
+		assert.NotZero(t, metadata["Timestamp"])
+		assert.Equal(t, []any{map[string]any{
+			"Namespace": "crud",
+			"Dimensions": []any{
+				[]any{"Route", "Method"},
+				[]any{"Route", "Method", "StatusClass"},
+			},
+			"Metrics": []any{
+				map[string]any{"Name": "Requests", "Unit": "Count"},
+				map[string]any{"Name": "Latency", "Unit": "Milliseconds"},
+			},
+		}}, metadata["CloudWatchMetrics"])
+	})
+
+	t.Run("Counts only backend failures as repo errors", func(t *testing.T) {
+		var buf bytes.Buffer
+		emf := metrics.NewEMF(&buf, "crud")
+
+		emf.RepoOperation(context.Background(), metrics.RepoMetric{Operation: "GetUser", Err: repo.ErrNotFound})
+		emf.RepoOperation(context.Background(), metrics.RepoMetric{Operation: "GetUser", Err: repo.ErrThrottled})
+
+		lines := emfLines(t, &buf)
+		assert.Len(t, lines, 2)
+		assert.Equal(t, float64(0), lines[0]["Errors"])
+		assert.Equal(t, "not_found", lines[0]["Outcome"])
+		assert.Equal(t, float64(1), lines[1]["Errors"])
+		assert.Equal(t, "throttled", lines[1]["Outcome"])
+	})
+
+	t.Run("Writes every record however many are repeated", func(t *testing.T) {
+		var buf bytes.Buffer
+		emf := metrics.NewEMF(&buf, "crud")
+
+		for i := 0; i < 250; i++ {
+			emf.Request(context.Background(), metrics.RequestMetric{Route: "/user", Method: "GET", Status: 200})
+		}
+
+		assert.Len(t, emfLines(t, &buf), 250)
+	})
+}
+
+// emfLines decodes the JSON lines written by an EMF recorder
+func emfLines(t *testing.T, r io.Reader) []map[string]any {
+	var lines []map[string]any
+
+	decoder := json.NewDecoder(r)
+	for decoder.More() {
+		var line map[string]any
+		assert.NoError(t, decoder.Decode(&line))
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func TestPrometheus(t *testing.T) {
+	t.Run("Counts requests by route, method and status class", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+		p, err := metrics.NewPrometheus(registry)
+		assert.NoError(t, err)
+
+		p.Request(context.Background(), metrics.RequestMetric{Route: "/user", Method: "POST", Status: 200})
+		p.Request(context.Background(), metrics.RequestMetric{Route: "/user", Method: "POST", Status: 201})
+		p.Request(context.Background(), metrics.RequestMetric{Route: "/user", Method: "POST", Status: 400})
+
+		labels := map[string]string{"route": "/user", "method": "POST", "status_class": "2xx"}
+		assert.Equal(t, float64(2), counter(t, registry, "crud_requests_total", labels))
+		labels["status_class"] = "4xx"
+		assert.Equal(t, float64(1), counter(t, registry, "crud_requests_total", labels))
+	})
+
+	t.Run("Counts repo operations by outcome", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+		p, err := metrics.NewPrometheus(registry)
+		assert.NoError(t, err)
+
+		p.RepoOperation(context.Background(), metrics.RepoMetric{Operation: "CreateUser", Err: &repo.ErrUnique{Field: "email"}})
+		p.RepoOperation(context.Background(), metrics.RepoMetric{Operation: "CreateUser", Err: repo.ErrUnavailable})
+
+		assert.Equal(t, float64(1), counter(t, registry, "crud_repo_operations_total",
+			map[string]string{"operation": "CreateUser", "outcome": "unique"}))
+		assert.Equal(t, float64(1), counter(t, registry, "crud_repo_operation_errors_total",
+			map[string]string{"operation": "CreateUser"}))
+	})
+
+	t.Run("Serves metrics in the exposition format", func(t *testing.T) {
+		p, err := metrics.NewPrometheus(prometheus.NewRegistry())
+		assert.NoError(t, err)
+		p.Request(context.Background(), metrics.RequestMetric{Route: "/user/{id}", Method: "GET", Status: 200})
+
+		res := httptest.NewRecorder()
+		p.Handler().ServeHTTP(res, httptest.NewRequest("GET", "/metrics", nil))
+
+		body, err := io.ReadAll(res.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, res.Code)
+		assert.Contains(t, string(body), `crud_requests_total{method="GET",route="/user/{id}",status_class="2xx"} 1`)
+		assert.Contains(t, string(body), "crud_request_duration_seconds_bucket")
+	})
+}
+
+func TestWrapRepo(t *testing.T) {
+	t.Run("Records each operation and its error", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(&user.User{ID: "123"}, nil)
+		r.On("DeleteUser", mock.Anything, "456", int64(2)).Return(repo.ErrConflict)
+		recorder := &spy{}
+
+		wrapped := metrics.WrapRepo(r, recorder)
+		u, err := wrapped.GetUser(context.Background(), "123")
+		assert.NoError(t, err)
+		assert.Equal(t, "123", u.ID)
+		err = wrapped.DeleteUser(context.Background(), "456", 2)
+		assert.ErrorIs(t, err, repo.ErrConflict)
+
+		assert.Len(t, recorder.operations, 2)
+		assert.Equal(t, "GetUser", recorder.operations[0].Operation)
+		assert.NoError(t, recorder.operations[0].Err)
+		assert.Equal(t, "DeleteUser", recorder.operations[1].Operation)
+		assert.ErrorIs(t, recorder.operations[1].Err, repo.ErrConflict)
+	})
+}
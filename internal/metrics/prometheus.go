@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus keeps metrics in a registry, served by Handler for Prometheus to
+// scrape
+type Prometheus struct {
+	gatherer prometheus.Gatherer
+
+	requests       *prometheus.CounterVec
+	requestLatency *prometheus.HistogramVec
+	repoOperations *prometheus.CounterVec
+	repoErrors     *prometheus.CounterVec
+	repoLatency    *prometheus.HistogramVec
+}
+
+func NewPrometheus(registry *prometheus.Registry) (*Prometheus, error) {
+	p := &Prometheus{
+		gatherer: registry,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "crud_requests_total",
+			Help: "Requests handled, by route, method and status class.",
+		}, []string{"route", "method", "status_class"}),
+		requestLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "crud_request_duration_seconds",
+			Help:    "Time taken to handle requests, by route and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		repoOperations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "crud_repo_operations_total",
+			Help: "Repo operations, by operation and outcome.",
+		}, []string{"operation", "outcome"}),
+		repoErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "crud_repo_operation_errors_total",
+			Help: "Repo operations that failed because of the backend, by operation.",
+		}, []string{"operation"}),
+		repoLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "crud_repo_operation_duration_seconds",
+			Help:    "Time taken by repo operations, by operation.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"operation"}),
+	}
+
+	for _, c := range []prometheus.Collector{
+		p.requests,
+		p.requestLatency,
+		p.repoOperations,
+		p.repoErrors,
+		p.repoLatency,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	} {
+		if err := registry.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+func (p *Prometheus) Request(ctx context.Context, m RequestMetric) {
+	p.requests.WithLabelValues(m.Route, m.Method, StatusClass(m.Status)).Inc()
+	p.requestLatency.WithLabelValues(m.Route, m.Method).Observe(m.Latency.Seconds())
+}
+
+func (p *Prometheus) RepoOperation(ctx context.Context, m RepoMetric) {
+	outcome := Outcome(m.Err)
+
+	p.repoOperations.WithLabelValues(m.Operation, outcome).Inc()
+	if IsFailure(outcome) {
+		p.repoErrors.WithLabelValues(m.Operation).Inc()
+	}
+	p.repoLatency.WithLabelValues(m.Operation).Observe(m.Latency.Seconds())
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (p *Prometheus) Handler() http.Handler {
+	return promhttp.HandlerFor(p.gatherer, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/user"
+)
+
+// instrumentedRepo records the latency and outcome of every operation on the
+// repo it wraps
+type instrumentedRepo struct {
+	next     repo.Repo
+	recorder Recorder
+}
+
+// WrapRepo records metrics for every operation on r
+func WrapRepo(r repo.Repo, recorder Recorder) repo.Repo {
+	return &instrumentedRepo{next: r, recorder: recorder}
+}
+
+func (r *instrumentedRepo) record(ctx context.Context, operation string, start time.Time, err error) {
+	r.recorder.RepoOperation(ctx, RepoMetric{
+		Operation: operation,
+		Err:       err,
+		Latency:   time.Since(start),
+	})
+}
+
+func (r *instrumentedRepo) GetUser(ctx context.Context, userID string) (*user.User, error) {
+	start := time.Now()
+	u, err := r.next.GetUser(ctx, userID)
+	r.record(ctx, "GetUser", start, err)
+
+	return u, err
+}
+
+func (r *instrumentedRepo) GetUserByEmail(ctx context.Context, email string) (*user.User, error) {
+	start := time.Now()
+	u, err := r.next.GetUserByEmail(ctx, email)
+	r.record(ctx, "GetUserByEmail", start, err)
+
+	return u, err
+}
+
+func (r *instrumentedRepo) DeleteUser(ctx context.Context, userID string, expectedVersion int64) error {
+	start := time.Now()
+	err := r.next.DeleteUser(ctx, userID, expectedVersion)
+	r.record(ctx, "DeleteUser", start, err)
+
+	return err
+}
+
+func (r *instrumentedRepo) UpdateUser(ctx context.Context, u user.User, expectedVersion int64) (*user.User, error) {
+	start := time.Now()
+	updated, err := r.next.UpdateUser(ctx, u, expectedVersion)
+	r.record(ctx, "UpdateUser", start, err)
+
+	return updated, err
+}
+
+func (r *instrumentedRepo) PatchUser(ctx context.Context, userID string, changes repo.UserChanges, expectedVersion int64) (*user.User, error) {
+	start := time.Now()
+	patched, err := r.next.PatchUser(ctx, userID, changes, expectedVersion)
+	r.record(ctx, "PatchUser", start, err)
+
+	return patched, err
+}
+
+func (r *instrumentedRepo) CreateUser(ctx context.Context, u user.User) (*user.User, error) {
+	start := time.Now()
+	created, err := r.next.CreateUser(ctx, u)
+	r.record(ctx, "CreateUser", start, err)
+
+	return created, err
+}
+
+func (r *instrumentedRepo) ListUsers(ctx context.Context, opts repo.ListOptions) (repo.Page, error) {
+	start := time.Now()
+	page, err := r.next.ListUsers(ctx, opts)
+	r.record(ctx, "ListUsers", start, err)
+
+	return page, err
+}
+
+func (r *instrumentedRepo) GetUserAsOf(ctx context.Context, userID string, asOf time.Time) (*user.User, error) {
+	start := time.Now()
+	u, err := r.next.GetUserAsOf(ctx, userID, asOf)
+	r.record(ctx, "GetUserAsOf", start, err)
+
+	return u, err
+}
+
+func (r *instrumentedRepo) ListUserHistory(ctx context.Context, userID string, opts repo.ListOptions) (repo.HistoryPage, error) {
+	start := time.Now()
+	page, err := r.next.ListUserHistory(ctx, userID, opts)
+	r.record(ctx, "ListUserHistory", start, err)
+
+	return page, err
+}
+
+func (r *instrumentedRepo) RestoreUser(ctx context.Context, userID string, expectedVersion int64) (*user.User, error) {
+	start := time.Now()
+	restored, err := r.next.RestoreUser(ctx, userID, expectedVersion)
+	r.record(ctx, "RestoreUser", start, err)
+
+	return restored, err
+}
+
+func (r *instrumentedRepo) RevertUser(ctx context.Context, userID string, version int64, expectedVersion int64) (*user.User, error) {
+	start := time.Now()
+	reverted, err := r.next.RevertUser(ctx, userID, version, expectedVersion)
+	r.record(ctx, "RevertUser", start, err)
+
+	return reverted, err
+}
+
+func (r *instrumentedRepo) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int, error) {
+	start := time.Now()
+	purged, err := r.next.PurgeDeletedUsers(ctx, deletedBefore)
+	r.record(ctx, "PurgeDeletedUsers", start, err)
+
+	return purged, err
+}
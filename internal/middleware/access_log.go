@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/crud"
+	"go.uber.org/zap"
+)
+
+// AccessLog logs one line per request with its outcome and duration. Placed
+// after RequestID, the line includes the request ID.
+func AccessLog() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			start := time.Now()
+
+			response, err := next(ctx, request, c)
+
+			fields := []zap.Field{
+				zap.String("method", request.HTTPMethod),
+				zap.String("path", request.Path),
+				zap.Int("status", response.StatusCode),
+				zap.Duration("duration", time.Since(start)),
+			}
+			if err != nil {
+				fields = append(fields, zap.Error(err))
+			}
+
+			c.Logger.Info("Request handled", fields...)
+
+			return response, err
+		}
+	}
+}
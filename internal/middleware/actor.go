@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/history"
+)
+
+// Actor works out who is making the request from what API Gateway's
+// authorizer verified, and stores it in the context for the history records
+// of any writes the request makes. Requests that were not authorized are made
+// by history.Anonymous.
+func Actor() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			return next(history.WithActor(ctx, actor(request.RequestContext)), request, c)
+		}
+	}
+}
+
+// actor picks the subject of a JWT or Cognito authorizer, then the principal
+// of a Lambda authorizer, then the ARN of an IAM caller
+func actor(requestContext events.APIGatewayProxyRequestContext) string {
+	if claims, ok := requestContext.Authorizer["claims"].(map[string]interface{}); ok {
+		if sub, ok := claims["sub"].(string); ok && sub != "" {
+			return sub
+		}
+	}
+
+	if principal, ok := requestContext.Authorizer["principalId"].(string); ok && principal != "" {
+		return principal
+	}
+
+	if requestContext.Identity.UserArn != "" {
+		return requestContext.Identity.UserArn
+	}
+
+	return history.Anonymous
+}
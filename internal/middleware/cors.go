@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/header"
+)
+
+// exposedHeaders are the response headers browsers may read cross origin
+var exposedHeaders = []string{"ETag", "Content-Language", RequestIDHeader, IdempotentReplayedHeader}
+
+// CORS adds the headers browsers need to call the API from the origins in
+// CORSAllowedOrigins. Requests from other origins, or without an Origin, are
+// passed through untouched. Preflight requests are answered by whatever
+// handles OPTIONS, normally the router, and the methods it allows are
+// advertised to the browser.
+func CORS() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			origin := header.Get(request.Headers, "Origin")
+			allowed, ok := allowedOrigin(c.Config.CORSAllowedOrigins, origin)
+			if !ok {
+				return next(ctx, request, c)
+			}
+
+			response, err := next(ctx, request, c)
+			if err != nil {
+				return response, err
+			}
+
+			setHeader(&response, "Access-Control-Allow-Origin", allowed)
+			if allowed != "*" {
+				addVary(&response, "Origin")
+			}
+
+			preflight := request.HTTPMethod == http.MethodOptions && header.Get(request.Headers, "Access-Control-Request-Method") != ""
+			if !preflight {
+				setHeader(&response, "Access-Control-Expose-Headers", strings.Join(exposedHeaders, ", "))
+				return response, nil
+			}
+
+			if methods := response.Headers["Allow"]; methods != "" {
+				setHeader(&response, "Access-Control-Allow-Methods", methods)
+			}
+			if len(c.Config.CORSAllowedHeaders) > 0 {
+				setHeader(&response, "Access-Control-Allow-Headers", strings.Join(c.Config.CORSAllowedHeaders, ", "))
+			}
+			if c.Config.CORSMaxAgeSeconds > 0 {
+				setHeader(&response, "Access-Control-Max-Age", strconv.Itoa(c.Config.CORSMaxAgeSeconds))
+			}
+
+			return response, nil
+		}
+	}
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for origin, and
+// whether it is allowed at all
+func allowedOrigin(allowed []string, origin string) (string, bool) {
+	if origin == "" {
+		return "", false
+	}
+
+	for _, o := range allowed {
+		if o == "*" {
+			return "*", true
+		}
+		if strings.EqualFold(o, origin) {
+			return origin, true
+		}
+	}
+
+	return "", false
+}
+
+func addVary(response *events.APIGatewayProxyResponse, value string) {
+	if existing := response.Headers["Vary"]; existing != "" {
+		setHeader(response, "Vary", existing+", "+value)
+		return
+	}
+	setHeader(response, "Vary", value)
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/header"
+	"github.com/crestenstclair/crud/internal/problem"
+	"go.uber.org/zap"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks responses replayed from an earlier
+	// request with the same key
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// maxIdempotencyKeyLength bounds keys, which are stored for every request
+const maxIdempotencyKeyLength = 255
+
+// idempotencyStoreTimeout bounds storing the outcome of a request, which
+// happens after the request's own deadline may have passed
+const idempotencyStoreTimeout = time.Second
+
+// Idempotency makes requests sent with an Idempotency-Key header safe to
+// retry. The response to the first request with a key is stored and replayed
+// for later requests with the same key, method, path and body. Reusing a key
+// for a different request is rejected with a 422, and a request sent while
+// another with the same key is still running is rejected with a 409.
+//
+// Failures that may not happen again, 5xx and 429 responses, are not stored,
+// so the request can be retried with the same key.
+func Idempotency() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			key := header.Get(request.Headers, IdempotencyKeyHeader)
+			if key == "" || c.Idempotency == nil {
+				return next(ctx, request, c)
+			}
+
+			if len(key) > maxIdempotencyKeyLength || !validRequestID(key) {
+				return problem.New(ctx, 400, problem.CodeInvalidParameter,
+					"Idempotency-Key must be 1 to 255 printable ASCII characters").Response(), nil
+			}
+
+			fingerprint := requestFingerprint(request)
+
+			record, claimed, err := c.Idempotency.Claim(ctx, key, fingerprint)
+			if err != nil {
+				c.Logger.Error("Failed to claim idempotency key", zap.Error(err))
+				return problem.New(ctx, 503, problem.CodeUnavailable, "Service temporarily unavailable, retry later").Response(), nil
+			}
+
+			if !claimed {
+				switch {
+				case record.Fingerprint != fingerprint:
+					return problem.New(ctx, 422, problem.CodeIdempotencyKeyReused,
+						"Idempotency-Key was already used for a different request").Response(), nil
+				case record.Response == nil:
+					return problem.New(ctx, 409, problem.CodeIdempotencyKeyInUse,
+						"A request with this Idempotency-Key is in progress, retry later").Response(), nil
+				default:
+					response := *record.Response
+					response.Headers = copyHeaders(response.Headers)
+					setHeader(&response, IdempotentReplayedHeader, "true")
+					return response, nil
+				}
+			}
+
+			response, err := next(ctx, request, c)
+
+			// The request may have run out of time, which should not stop its
+			// outcome from being stored
+			storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), idempotencyStoreTimeout)
+			defer cancel()
+
+			if err != nil || !replayable(response.StatusCode) {
+				if err := c.Idempotency.Release(storeCtx, key); err != nil {
+					c.Logger.Error("Failed to release idempotency key", zap.Error(err))
+				}
+				return response, err
+			}
+
+			if err := c.Idempotency.Complete(storeCtx, key, response); err != nil {
+				c.Logger.Error("Failed to store idempotent response", zap.Error(err))
+			}
+
+			return response, nil
+		}
+	}
+}
+
+// requestFingerprint identifies a request by everything that affects its
+// outcome
+func requestFingerprint(request events.APIGatewayProxyRequest) string {
+	hash := sha256.New()
+	for _, part := range []string{request.HTTPMethod, request.Path, request.Body} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func replayable(status int) bool {
+	return status < 500 && status != 429
+}
+
+func copyHeaders(headers map[string]string) map[string]string {
+	copied := make(map[string]string, len(headers))
+	for k, v := range headers {
+		copied[k] = v
+	}
+
+	return copied
+}
@@ -0,0 +1,131 @@
+package middleware_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/idempotency"
+	"github.com/crestenstclair/crud/internal/middleware"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+// counting is a handler that counts its calls and answers with status
+func counting(calls *int, status int) middleware.HandlerFunc {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+		*calls++
+		return events.APIGatewayProxyResponse{
+			StatusCode: status,
+			Headers:    map[string]string{"ETag": `"1"`},
+			Body:       request.Body,
+		}, nil
+	}
+}
+
+func newIdempotentCrud(t *testing.T) *crud.Crud {
+	return &crud.Crud{
+		Logger:      zaptest.NewLogger(t),
+		Config:      &config.Config{},
+		Idempotency: idempotency.NewMemoryStore(time.Hour, time.Minute),
+	}
+}
+
+func post(key string, body string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		HTTPMethod: "POST",
+		Path:       "/user",
+		Headers:    map[string]string{"Idempotency-Key": key},
+		Body:       body,
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	t.Run("Replays the first response to a repeated request", func(t *testing.T) {
+		var calls int
+		c := newIdempotentCrud(t)
+		h := middleware.Chain(counting(&calls, 200), middleware.Idempotency())
+
+		first, err := h(context.Background(), post("key", `{"firstName":"Fred"}`), c)
+		assert.NoError(t, err)
+		second, err := h(context.Background(), post("key", `{"firstName":"Fred"}`), c)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, first.Body, second.Body)
+		assert.Equal(t, `"1"`, second.Headers["ETag"])
+		assert.Equal(t, "true", second.Headers["Idempotent-Replayed"])
+		assert.Empty(t, first.Headers["Idempotent-Replayed"])
+	})
+
+	t.Run("Rejects a key reused for a different body", func(t *testing.T) {
+		var calls int
+		c := newIdempotentCrud(t)
+		h := middleware.Chain(counting(&calls, 200), middleware.Idempotency())
+
+		_, _ = h(context.Background(), post("key", `{"firstName":"Fred"}`), c)
+		res, err := h(context.Background(), post("key", `{"firstName":"Barney"}`), c)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, 422, res.StatusCode)
+		assert.Contains(t, res.Body, "IDEMPOTENCY_KEY_REUSED")
+	})
+
+	t.Run("Rejects a repeat while the first request is running", func(t *testing.T) {
+		c := newIdempotentCrud(t)
+		var res events.APIGatewayProxyResponse
+		h := middleware.Chain(func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			var err error
+			res, err = middleware.Chain(ok, middleware.Idempotency())(ctx, request, c)
+			return events.APIGatewayProxyResponse{StatusCode: 200}, err
+		}, middleware.Idempotency())
+
+		_, err := h(context.Background(), post("key", "{}"), c)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 409, res.StatusCode)
+		assert.Contains(t, res.Body, "IDEMPOTENCY_KEY_IN_USE")
+	})
+
+	t.Run("Lets failed requests be retried with the same key", func(t *testing.T) {
+		var calls int
+		c := newIdempotentCrud(t)
+		h := middleware.Chain(counting(&calls, 503), middleware.Idempotency())
+
+		_, _ = h(context.Background(), post("key", "{}"), c)
+		res, err := h(context.Background(), post("key", "{}"), c)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 2, calls)
+		assert.Empty(t, res.Headers["Idempotent-Replayed"])
+	})
+
+	t.Run("Rejects malformed keys", func(t *testing.T) {
+		var calls int
+		h := middleware.Chain(counting(&calls, 200), middleware.Idempotency())
+
+		res, err := h(context.Background(), post(strings.Repeat("k", 256), "{}"), newIdempotentCrud(t))
+		assert.NoError(t, err)
+
+		assert.Equal(t, 0, calls)
+		assert.Equal(t, 400, res.StatusCode)
+	})
+
+	t.Run("Handles requests without a key as usual", func(t *testing.T) {
+		var calls int
+		c := newIdempotentCrud(t)
+		h := middleware.Chain(counting(&calls, 200), middleware.Idempotency())
+
+		for i := 0; i < 2; i++ {
+			_, err := h(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "POST", Path: "/user"}, c)
+			assert.NoError(t, err)
+		}
+
+		assert.Equal(t, 2, calls)
+	})
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/metrics"
+)
+
+// unmatchedRoute labels requests no route matched, so unknown paths cannot
+// create new metric series
+const unmatchedRoute = "unmatched"
+
+type routeKey struct{}
+
+// SetRoute tells the middleware which route template a request matched. The
+// router calls it, since the template is only known once it has matched.
+func SetRoute(ctx context.Context, route string) {
+	if holder, ok := ctx.Value(routeKey{}).(*string); ok {
+		*holder = route
+	}
+}
+
+// Metrics records the count, latency and status of requests by route. Routes
+// come from SetRoute, or from API Gateway when a Lambda serves a single route.
+func Metrics() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			if c.Metrics == nil {
+				return next(ctx, request, c)
+			}
+
+			route := request.Resource
+			start := time.Now()
+
+			response, err := next(context.WithValue(ctx, routeKey{}, &route), request, c)
+
+			if route == "" {
+				route = unmatchedRoute
+			}
+
+			status := response.StatusCode
+			if err != nil {
+				status = 500
+			}
+
+			c.Metrics.Request(ctx, metrics.RequestMetric{
+				Route:   route,
+				Method:  request.HTTPMethod,
+				Status:  status,
+				Latency: time.Since(start),
+			})
+
+			return response, err
+		}
+	}
+}
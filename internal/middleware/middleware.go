@@ -0,0 +1,55 @@
+// Package middleware wraps handlers with behaviour every request needs, such
+// as timeouts, logging and CORS, so the handlers themselves only deal with
+// users.
+package middleware
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/crud"
+)
+
+type HandlerFunc func(context.Context, events.APIGatewayProxyRequest, *crud.Crud) (events.APIGatewayProxyResponse, error)
+
+type Middleware func(HandlerFunc) HandlerFunc
+
+// Chain wraps h in middleware. The first middleware is the outermost, so it
+// sees the request first and the response last.
+func Chain(h HandlerFunc, middleware ...Middleware) HandlerFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+
+	return h
+}
+
+// Defaults is the stack every request goes through. Recover comes first so a
+// panic in any middleware is still answered with a problem. Tracing follows so
+// the span covers the whole request, then request IDs so everything after can
+// log them, and the actor so writes can be attributed to it. Metrics and the
+// access log sit outside the rest so they record the response actually sent,
+// including the 500 from a panic in the handler, which Recover catches again
+// inside them.
+func Defaults() []Middleware {
+	return []Middleware{
+		Recover(),
+		Tracing(),
+		RequestID(),
+		Actor(),
+		Metrics(),
+		AccessLog(),
+		CORS(),
+		Recover(),
+		Timeout(),
+	}
+}
+
+// setHeader sets a response header, allocating the headers if the handler
+// did not
+func setHeader(response *events.APIGatewayProxyResponse, name string, value string) {
+	if response.Headers == nil {
+		response.Headers = map[string]string{}
+	}
+	response.Headers[name] = value
+}
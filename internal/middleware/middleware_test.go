@@ -0,0 +1,386 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/history"
+	"github.com/crestenstclair/crud/internal/logging"
+	"github.com/crestenstclair/crud/internal/metrics"
+	"github.com/crestenstclair/crud/internal/middleware"
+	"github.com/crestenstclair/crud/internal/problem"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newTestCrud(t *testing.T, cfg *config.Config) *crud.Crud {
+	return &crud.Crud{
+		Logger: zaptest.NewLogger(t),
+		Config: cfg,
+	}
+}
+
+func ok(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+	return events.APIGatewayProxyResponse{StatusCode: 200, Body: "ok"}, nil
+}
+
+// tag returns middleware that records the order it ran in
+func tag(name string, order *[]string) middleware.Middleware {
+	return func(next middleware.HandlerFunc) middleware.HandlerFunc {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			*order = append(*order, name)
+			return next(ctx, request, c)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	t.Run("Runs middleware outermost first", func(t *testing.T) {
+		var order []string
+
+		h := middleware.Chain(ok, tag("first", &order), tag("second", &order), tag("third", &order))
+		res, err := h(context.Background(), events.APIGatewayProxyRequest{}, newTestCrud(t, &config.Config{}))
+		assert.NoError(t, err)
+
+		assert.Equal(t, "ok", res.Body)
+		assert.Equal(t, []string{"first", "second", "third"}, order)
+	})
+}
+
+func TestRecover(t *testing.T) {
+	t.Run("Returns 500 when the handler panics", func(t *testing.T) {
+		h := middleware.Chain(func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			panic("boom")
+		}, middleware.Recover())
+
+		res, err := h(context.Background(), events.APIGatewayProxyRequest{}, newTestCrud(t, &config.Config{}))
+		assert.NoError(t, err)
+
+		assert.Equal(t, 500, res.StatusCode)
+		assert.Contains(t, res.Body, "INTERNAL_ERROR")
+	})
+
+	t.Run("Answers panics in the default middleware with a problem", func(t *testing.T) {
+		// Without a config the CORS middleware dereferences nil
+		h := middleware.Chain(ok, middleware.Defaults()...)
+
+		res, err := h(context.Background(), events.APIGatewayProxyRequest{}, newTestCrud(t, nil))
+		assert.NoError(t, err)
+
+		assert.Equal(t, 500, res.StatusCode)
+		assert.Equal(t, problem.ContentType, res.Headers["Content-Type"])
+	})
+
+	t.Run("Returns 500 when the handler returns an error", func(t *testing.T) {
+		h := middleware.Chain(func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			return events.APIGatewayProxyResponse{}, errors.New("boom")
+		}, middleware.Recover())
+
+		res, err := h(context.Background(), events.APIGatewayProxyRequest{}, newTestCrud(t, &config.Config{}))
+		assert.NoError(t, err)
+
+		assert.Equal(t, 500, res.StatusCode)
+	})
+}
+
+func TestTimeout(t *testing.T) {
+	t.Run("Sets a deadline from the configured timeout", func(t *testing.T) {
+		var deadline time.Time
+		h := middleware.Chain(func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			deadline, _ = ctx.Deadline()
+			return ok(ctx, request, c)
+		}, middleware.Timeout())
+
+		start := time.Now()
+		_, err := h(context.Background(), events.APIGatewayProxyRequest{}, newTestCrud(t, &config.Config{RequestTimeoutMS: 250}))
+		assert.NoError(t, err)
+
+		assert.WithinDuration(t, start.Add(250*time.Millisecond), deadline, 50*time.Millisecond)
+	})
+
+	t.Run("Sets no deadline when the timeout is disabled", func(t *testing.T) {
+		hasDeadline := true
+		h := middleware.Chain(func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			_, hasDeadline = ctx.Deadline()
+			return ok(ctx, request, c)
+		}, middleware.Timeout())
+
+		_, err := h(context.Background(), events.APIGatewayProxyRequest{}, newTestCrud(t, &config.Config{}))
+		assert.NoError(t, err)
+
+		assert.False(t, hasDeadline)
+	})
+}
+
+func TestRequestID(t *testing.T) {
+	run := func(t *testing.T, request events.APIGatewayProxyRequest) (string, events.APIGatewayProxyResponse) {
+		var seen string
+		h := middleware.Chain(func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			seen = logging.RequestID(ctx)
+			return ok(ctx, request, c)
+		}, middleware.RequestID())
+
+		res, err := h(context.Background(), request, newTestCrud(t, &config.Config{}))
+		assert.NoError(t, err)
+
+		return seen, res
+	}
+
+	t.Run("Keeps the ID sent by the client", func(t *testing.T) {
+		id, res := run(t, events.APIGatewayProxyRequest{
+			Headers:        map[string]string{"x-request-id": "client-id"},
+			RequestContext: events.APIGatewayProxyRequestContext{RequestID: "gateway-id"},
+		})
+
+		assert.Equal(t, "client-id", id)
+		assert.Equal(t, "client-id", res.Headers["X-Request-Id"])
+	})
+
+	t.Run("Falls back to the ID assigned by API Gateway", func(t *testing.T) {
+		id, res := run(t, events.APIGatewayProxyRequest{
+			Headers:        map[string]string{"X-Request-Id": "has spaces"},
+			RequestContext: events.APIGatewayProxyRequestContext{RequestID: "gateway-id"},
+		})
+
+		assert.Equal(t, "gateway-id", id)
+		assert.Equal(t, "gateway-id", res.Headers["X-Request-Id"])
+	})
+
+	t.Run("Logs the ID with everything the handler and repo log", func(t *testing.T) {
+		core, logs := observer.New(zap.InfoLevel)
+		c := &crud.Crud{Logger: zap.New(core), Config: &config.Config{}}
+
+		h := middleware.Chain(func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			c.Logger.Info("from handler")
+			logging.FromContext(ctx).Info("from repo")
+			return ok(ctx, request, c)
+		}, middleware.RequestID())
+
+		_, err := h(context.Background(), events.APIGatewayProxyRequest{
+			Headers: map[string]string{"X-Request-Id": "client-id"},
+		}, c)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 2, logs.Len())
+		for _, entry := range logs.All() {
+			assert.Equal(t, "client-id", entry.ContextMap()["requestId"], entry.Message)
+		}
+	})
+
+	t.Run("Uses the ID as the trace ID of problems", func(t *testing.T) {
+		h := middleware.Chain(func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			return problem.New(ctx, 404, problem.CodeNotFound, "User not found").Response(), nil
+		}, middleware.RequestID())
+
+		res, err := h(context.Background(), events.APIGatewayProxyRequest{
+			Headers: map[string]string{"X-Request-Id": "client-id"},
+		}, newTestCrud(t, &config.Config{}))
+		assert.NoError(t, err)
+
+		assert.Contains(t, res.Body, `"traceId":"client-id"`)
+		assert.Equal(t, "client-id", res.Headers["X-Request-Id"])
+	})
+
+	t.Run("Generates an ID when there is none", func(t *testing.T) {
+		id, res := run(t, events.APIGatewayProxyRequest{})
+
+		assert.NotEmpty(t, id)
+		assert.Equal(t, id, res.Headers["X-Request-Id"])
+	})
+}
+
+// recordedRequests keeps the request metrics it is asked to record
+type recordedRequests []metrics.RequestMetric
+
+func (r *recordedRequests) Request(ctx context.Context, m metrics.RequestMetric) {
+	*r = append(*r, m)
+}
+
+func (r *recordedRequests) RepoOperation(ctx context.Context, m metrics.RepoMetric) {}
+
+func TestActor(t *testing.T) {
+	actorOf := func(t *testing.T, requestContext events.APIGatewayProxyRequestContext) string {
+		var actor string
+		h := middleware.Chain(func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			actor = history.Actor(ctx)
+			return events.APIGatewayProxyResponse{StatusCode: 200}, nil
+		}, middleware.Actor())
+
+		_, err := h(context.Background(), events.APIGatewayProxyRequest{RequestContext: requestContext}, newTestCrud(t, &config.Config{}))
+		assert.NoError(t, err)
+
+		return actor
+	}
+
+	t.Run("Uses the subject of verified claims", func(t *testing.T) {
+		assert.Equal(t, "auth0|fred", actorOf(t, events.APIGatewayProxyRequestContext{
+			Authorizer: map[string]interface{}{
+				"claims":      map[string]interface{}{"sub": "auth0|fred"},
+				"principalId": "ignored",
+			},
+		}))
+	})
+
+	t.Run("Uses the principal of a Lambda authorizer", func(t *testing.T) {
+		assert.Equal(t, "fred", actorOf(t, events.APIGatewayProxyRequestContext{
+			Authorizer: map[string]interface{}{"principalId": "fred"},
+		}))
+	})
+
+	t.Run("Uses the ARN of IAM callers", func(t *testing.T) {
+		arn := "arn:aws:iam::123456789012:user/fred"
+		assert.Equal(t, arn, actorOf(t, events.APIGatewayProxyRequestContext{
+			Identity: events.APIGatewayRequestIdentity{UserArn: arn},
+		}))
+	})
+
+	t.Run("Falls back to anonymous", func(t *testing.T) {
+		assert.Equal(t, history.Anonymous, actorOf(t, events.APIGatewayProxyRequestContext{}))
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	t.Run("Labels requests with the route that matched", func(t *testing.T) {
+		var recorded recordedRequests
+		c := &crud.Crud{Logger: zaptest.NewLogger(t), Config: &config.Config{}, Metrics: &recorded}
+
+		h := middleware.Chain(func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			middleware.SetRoute(ctx, "/user/{id}")
+			return events.APIGatewayProxyResponse{StatusCode: 404}, nil
+		}, middleware.Metrics())
+
+		_, err := h(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/user/123"}, c)
+		assert.NoError(t, err)
+
+		assert.Len(t, recorded, 1)
+		assert.Equal(t, "/user/{id}", recorded[0].Route)
+		assert.Equal(t, "GET", recorded[0].Method)
+		assert.Equal(t, 404, recorded[0].Status)
+	})
+
+	t.Run("Falls back to the resource API Gateway matched", func(t *testing.T) {
+		var recorded recordedRequests
+		c := &crud.Crud{Logger: zaptest.NewLogger(t), Config: &config.Config{}, Metrics: &recorded}
+
+		h := middleware.Chain(ok, middleware.Metrics())
+		_, err := h(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/user/123", Resource: "/user/{id}"}, c)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "/user/{id}", recorded[0].Route)
+	})
+
+	t.Run("Keeps raw paths out of the labels", func(t *testing.T) {
+		var recorded recordedRequests
+		c := &crud.Crud{Logger: zaptest.NewLogger(t), Config: &config.Config{}, Metrics: &recorded}
+
+		h := middleware.Chain(func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			return events.APIGatewayProxyResponse{}, errors.New("boom")
+		}, middleware.Metrics())
+		_, err := h(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/wp-admin"}, c)
+		assert.Error(t, err)
+
+		assert.Equal(t, "unmatched", recorded[0].Route)
+		assert.Equal(t, 500, recorded[0].Status)
+	})
+}
+
+func TestAccessLog(t *testing.T) {
+	t.Run("Logs the request and its outcome", func(t *testing.T) {
+		core, logs := observer.New(zap.InfoLevel)
+		c := &crud.Crud{Logger: zap.New(core), Config: &config.Config{}}
+
+		h := middleware.Chain(ok, middleware.RequestID(), middleware.AccessLog())
+		_, err := h(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod:     "GET",
+			Path:           "/user/123",
+			RequestContext: events.APIGatewayProxyRequestContext{RequestID: "gateway-id"},
+		}, c)
+		assert.NoError(t, err)
+
+		entries := logs.FilterMessage("Request handled").All()
+		assert.Len(t, entries, 1)
+
+		fields := entries[0].ContextMap()
+		assert.Equal(t, "GET", fields["method"])
+		assert.Equal(t, "/user/123", fields["path"])
+		assert.Equal(t, int64(200), fields["status"])
+		assert.Equal(t, "gateway-id", fields["requestId"])
+	})
+}
+
+func TestCORS(t *testing.T) {
+	cfg := &config.Config{
+		CORSAllowedOrigins: []string{"https://app.example.com"},
+		CORSAllowedHeaders: []string{"Content-Type", "If-Match"},
+		CORSMaxAgeSeconds:  600,
+	}
+
+	t.Run("Allows configured origins", func(t *testing.T) {
+		h := middleware.Chain(ok, middleware.CORS())
+
+		res, err := h(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Headers:    map[string]string{"origin": "https://app.example.com"},
+		}, newTestCrud(t, cfg))
+		assert.NoError(t, err)
+
+		assert.Equal(t, "https://app.example.com", res.Headers["Access-Control-Allow-Origin"])
+		assert.Equal(t, "Origin", res.Headers["Vary"])
+		assert.Contains(t, res.Headers["Access-Control-Expose-Headers"], "ETag")
+	})
+
+	t.Run("Leaves other origins alone", func(t *testing.T) {
+		h := middleware.Chain(ok, middleware.CORS())
+
+		res, err := h(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Headers:    map[string]string{"Origin": "https://evil.example.com"},
+		}, newTestCrud(t, cfg))
+		assert.NoError(t, err)
+
+		assert.Empty(t, res.Headers["Access-Control-Allow-Origin"])
+	})
+
+	t.Run("Advertises the allowed methods on preflight", func(t *testing.T) {
+		h := middleware.Chain(func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			return events.APIGatewayProxyResponse{
+				StatusCode: 204,
+				Headers:    map[string]string{"Allow": "GET, OPTIONS, POST"},
+			}, nil
+		}, middleware.CORS())
+
+		res, err := h(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "OPTIONS",
+			Headers: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "POST",
+			},
+		}, newTestCrud(t, cfg))
+		assert.NoError(t, err)
+
+		assert.Equal(t, 204, res.StatusCode)
+		assert.Equal(t, "GET, OPTIONS, POST", res.Headers["Access-Control-Allow-Methods"])
+		assert.Equal(t, "Content-Type, If-Match", res.Headers["Access-Control-Allow-Headers"])
+		assert.Equal(t, "600", res.Headers["Access-Control-Max-Age"])
+	})
+
+	t.Run("Allows any origin with a wildcard", func(t *testing.T) {
+		h := middleware.Chain(ok, middleware.CORS())
+
+		res, err := h(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Headers:    map[string]string{"Origin": "https://anywhere.example.com"},
+		}, newTestCrud(t, &config.Config{CORSAllowedOrigins: []string{"*"}}))
+		assert.NoError(t, err)
+
+		assert.Equal(t, "*", res.Headers["Access-Control-Allow-Origin"])
+		assert.Empty(t, res.Headers["Vary"])
+	})
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/problem"
+	"go.uber.org/zap"
+)
+
+// Recover turns a panic, or an error returned by the handler, into a 500
+// problem response. Returning an error to Lambda would otherwise surface as an
+// opaque 502 from API Gateway, and a panic would crash the function.
+func Recover() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (response events.APIGatewayProxyResponse, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					c.Logger.Error("Handler panicked", zap.Any("panic", r), zap.Stack("stack"))
+					response, err = internalError(ctx), nil
+				}
+			}()
+
+			response, err = next(ctx, request, c)
+			if err != nil {
+				c.Logger.Error("Handler failed", zap.Error(err))
+				return internalError(ctx), nil
+			}
+
+			return response, nil
+		}
+	}
+}
+
+func internalError(ctx context.Context) events.APIGatewayProxyResponse {
+	return problem.New(ctx, 500, problem.CodeInternal, "An internal error occured").Response()
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/header"
+	"github.com/crestenstclair/crud/internal/logging"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const RequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength bounds IDs taken from clients, which end up in logs
+const maxRequestIDLength = 128
+
+// RequestID gives every request an ID, echoed back in the X-Request-Id
+// header and as the traceId of problem responses. A well formed X-Request-Id
+// sent by the client is kept, so requests can be traced across services.
+// Otherwise the ID API Gateway assigned is used, or a new one is generated.
+//
+// The ID is stored in the context along with a child logger that includes
+// it, and the trace ID when the request is traced, see the logging package.
+// Handlers are given a copy of crud whose Logger is that child logger, so
+// everything they log carries the ID.
+func RequestID() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			id := header.Get(request.Headers, RequestIDHeader)
+			if !validRequestID(id) {
+				id = request.RequestContext.RequestID
+			}
+			if id == "" {
+				id = uuid.NewString()
+			}
+
+			fields := []zap.Field{zap.String("requestId", id)}
+			if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+				fields = append(fields, zap.String("traceId", span.TraceID().String()))
+			}
+
+			requestCrud := *c
+			requestCrud.Logger = c.Logger.With(fields...)
+
+			ctx = logging.WithRequestID(ctx, id)
+			ctx = logging.WithLogger(ctx, requestCrud.Logger)
+
+			response, err := next(ctx, request, &requestCrud)
+			if err != nil {
+				return response, err
+			}
+
+			setHeader(&response, RequestIDHeader, id)
+
+			return response, nil
+		}
+	}
+}
+
+// validRequestID accepts non-empty IDs of printable ASCII
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/crud"
+)
+
+// Timeout bounds each request by the configured request timeout. Handlers
+// report requests that run out of time as a 504.
+func Timeout() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			ctx, cancel := withRequestTimeout(ctx, c.Config)
+			defer cancel()
+
+			return next(ctx, request, c)
+		}
+	}
+}
+
+// withRequestTimeout bounds a request by the configured RequestTimeoutMS, or
+// not at all when it is zero. Inside Lambda the request is also cut short
+// LambdaDeadlineMarginMS before the invocation's own deadline, so a timeout is
+// reported to the client instead of the function being killed mid request.
+func withRequestTimeout(ctx context.Context, cfg *config.Config) (context.Context, context.CancelFunc) {
+	var deadline time.Time
+
+	if cfg.RequestTimeoutMS > 0 {
+		deadline = time.Now().Add(time.Duration(cfg.RequestTimeoutMS) * time.Millisecond)
+	}
+
+	if _, ok := lambdacontext.FromContext(ctx); ok {
+		if lambdaDeadline, ok := ctx.Deadline(); ok {
+			lambdaDeadline = lambdaDeadline.Add(-time.Duration(cfg.LambdaDeadlineMarginMS) * time.Millisecond)
+			if deadline.IsZero() || lambdaDeadline.Before(deadline) {
+				deadline = lambdaDeadline
+			}
+		}
+	}
+
+	if deadline.IsZero() {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithDeadline(ctx, deadline)
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing records a span for each request, continuing the trace named in the
+// request's traceparent header if there is one. The router renames the span
+// after the route it matches.
+func Tracing() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+			ctx = otel.GetTextMapPropagator().Extract(ctx, headerCarrier(request.Headers))
+
+			ctx, span := tracing.Tracer().Start(ctx, request.HTTPMethod,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(request.HTTPMethod),
+					semconv.URLPath(request.Path),
+				),
+			)
+
+			response, err := next(ctx, request, c)
+
+			span.SetAttributes(semconv.HTTPResponseStatusCode(response.StatusCode))
+			switch {
+			case err != nil:
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			case response.StatusCode >= 500:
+				span.SetStatus(codes.Error, "")
+			}
+			span.End()
+
+			if _, ok := lambdacontext.FromContext(ctx); ok {
+				tracing.Flush(ctx)
+			}
+
+			return response, err
+		}
+	}
+}
+
+// headerCarrier lowercases header names, which propagators look up exactly
+func headerCarrier(headers map[string]string) propagation.MapCarrier {
+	carrier := make(propagation.MapCarrier, len(headers))
+	for name, value := range headers {
+		carrier[strings.ToLower(name)] = value
+	}
+
+	return carrier
+}
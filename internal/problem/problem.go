@@ -0,0 +1,100 @@
+// Package problem renders API errors as RFC 7807 problem details, so clients
+// can act on a stable code instead of parsing English messages.
+package problem
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/crestenstclair/crud/internal/logging"
+)
+
+const ContentType = "application/problem+json"
+
+// Codes identify the kind of problem. They are part of the API contract, so
+// existing codes must never be renamed.
+const (
+	CodeMalformedBody        = "MALFORMED_BODY"
+	CodeValidationFailed     = "VALIDATION_FAILED"
+	CodeInvalidParameter     = "INVALID_PARAMETER"
+	CodePreconditionFailed   = "PRECONDITION_FAILED"
+	CodePreconditionRequired = "PRECONDITION_REQUIRED"
+	CodeNotFound             = "NOT_FOUND"
+	CodeMethodNotAllowed     = "METHOD_NOT_ALLOWED"
+	CodeAlreadyExists        = "ALREADY_EXISTS"
+	CodeConflict             = "CONFLICT"
+	CodePayloadTooLarge      = "PAYLOAD_TOO_LARGE"
+	CodeUnsupportedMediaType = "UNSUPPORTED_MEDIA_TYPE"
+	CodeThrottled            = "THROTTLED"
+	CodeUnavailable          = "UNAVAILABLE"
+	CodeTimeout              = "REQUEST_TIMEOUT"
+	CodeInternal             = "INTERNAL_ERROR"
+	CodeIdempotencyKeyReused = "IDEMPOTENCY_KEY_REUSED"
+	CodeIdempotencyKeyInUse  = "IDEMPOTENCY_KEY_IN_USE"
+)
+
+// FieldError describes a single invalid field in a request
+type FieldError struct {
+	// Field is the name of the field as it appears on the wire
+	Field string `json:"field"`
+	// Rule is the validation rule that failed, e.g. "required" or "email"
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code"`
+	// TraceID ties the problem to the logs for the request that caused it. It
+	// is the request ID, or the Lambda invocation ID outside of a request.
+	TraceID string       `json:"traceId,omitempty"`
+	Errors  []FieldError `json:"errors,omitempty"`
+}
+
+// New builds a problem for the request in ctx. Problems are only
+// distinguished by code, so type is always about:blank and title is the
+// standard text for the status.
+func New(ctx context.Context, status int, code string, detail string) *Problem {
+	p := &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+
+	p.TraceID = logging.RequestID(ctx)
+	if lc, ok := lambdacontext.FromContext(ctx); ok && p.TraceID == "" {
+		p.TraceID = lc.AwsRequestID
+	}
+
+	return p
+}
+
+// WithErrors attaches field level details to the problem
+func (p *Problem) WithErrors(errors []FieldError) *Problem {
+	p.Errors = errors
+	return p
+}
+
+func (p *Problem) Response() events.APIGatewayProxyResponse {
+	var buf bytes.Buffer
+
+	body, _ := json.Marshal(p)
+
+	json.HTMLEscape(&buf, body)
+	return events.APIGatewayProxyResponse{
+		StatusCode: p.Status,
+		Body:       buf.String(),
+		Headers: map[string]string{
+			"Content-Type": ContentType,
+		},
+	}
+}
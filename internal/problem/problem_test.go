@@ -0,0 +1,53 @@
+package problem_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/crestenstclair/crud/internal/logging"
+	"github.com/crestenstclair/crud/internal/problem"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProblem(t *testing.T) {
+	t.Run("Renders an RFC 7807 body", func(t *testing.T) {
+		res := problem.New(context.Background(), 404, problem.CodeNotFound, "User not found").Response()
+
+		var body map[string]any
+		err := json.Unmarshal([]byte(res.Body), &body)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 404, res.StatusCode)
+		assert.Equal(t, "application/problem+json", res.Headers["Content-Type"])
+		assert.Equal(t, map[string]any{
+			"type":   "about:blank",
+			"title":  "Not Found",
+			"status": float64(404),
+			"detail": "User not found",
+			"code":   "NOT_FOUND",
+		}, body)
+	})
+
+	t.Run("Takes the trace ID from the Lambda request ID", func(t *testing.T) {
+		ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
+			AwsRequestID: "request-id",
+		})
+
+		p := problem.New(ctx, 500, problem.CodeInternal, "")
+
+		assert.Equal(t, "request-id", p.TraceID)
+	})
+
+	t.Run("Prefers the ID of the request being handled", func(t *testing.T) {
+		ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
+			AwsRequestID: "invocation-id",
+		})
+		ctx = logging.WithRequestID(ctx, "client-id")
+
+		p := problem.New(ctx, 500, problem.CodeInternal, "")
+
+		assert.Equal(t, "client-id", p.TraceID)
+	})
+}
@@ -0,0 +1,292 @@
+// Package cache decorates a repo.Repo so users that are read often are served
+// from memory instead of the backend.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/logging"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/user"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// Backend is a cache shared between instances, such as Redis or Memcached.
+// It is optional, and failures are logged and treated as misses.
+type Backend interface {
+	// Get returns false when key is not cached
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+type cachedRepo struct {
+	next        repo.Repo
+	local       *lru
+	shared      Backend
+	ttl         time.Duration
+	negativeTTL time.Duration
+	group       singleflight.Group
+	// writes counts completed writes, so lookups that raced a write do not
+	// cache what they read before it
+	writes atomic.Uint64
+}
+
+// WrapRepo caches the users GetUser returns, and the IDs it found no user
+// for, in an LRU of cfg.UserCacheSize entries. Concurrent lookups of the same
+// ID share a single call to r. Writes made through the returned repo update
+// the cache. Writes made elsewhere, such as by another Lambda instance, are
+// seen once the cached entry expires.
+//
+// shared may be nil. When set it is checked after the LRU and before r, and
+// writes delete the entries they affect from it.
+//
+// r is returned unwrapped when cfg.UserCacheSize is zero.
+func WrapRepo(r repo.Repo, cfg *config.Config, shared Backend) repo.Repo {
+	if cfg.UserCacheSize <= 0 {
+		return r
+	}
+
+	return &cachedRepo{
+		next:        r,
+		local:       newLRU(cfg.UserCacheSize),
+		shared:      shared,
+		ttl:         time.Duration(cfg.UserCacheTTLMS) * time.Millisecond,
+		negativeTTL: time.Duration(cfg.UserCacheNegativeTTLMS) * time.Millisecond,
+	}
+}
+
+// sharedEntry is how entries are stored in the shared backend. The expiry
+// is kept so an entry copied into the LRU does not outlive it.
+type sharedEntry struct {
+	User    *user.User `json:"user"`
+	Expires int64      `json:"expires"`
+}
+
+func key(userID string) string {
+	return "user:" + userID
+}
+
+func (r *cachedRepo) GetUser(ctx context.Context, userID string) (*user.User, error) {
+	// The cached user may be stale, so it is replaced with the one read
+	if repo.ConsistentRead(ctx) {
+		e, err := r.read(ctx, r.writes.Load(), userID)
+		if err != nil {
+			return nil, err
+		}
+		return result(e)
+	}
+
+	if e, ok := r.local.get(userID); ok {
+		return result(e)
+	}
+
+	v, err, _ := r.group.Do(userID, func() (any, error) {
+		return r.load(ctx, userID)
+	})
+	if err != nil {
+		// The lookup was shared with a caller that gave up, which this caller
+		// has not
+		if ctx.Err() == nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+			return r.next.GetUser(ctx, userID)
+		}
+		return nil, err
+	}
+
+	return result(v.(entry))
+}
+
+// result returns a copy of the cached user, so callers cannot change the
+// cache by changing what they were given
+func result(e entry) (*user.User, error) {
+	if e.user == nil {
+		return nil, repo.ErrNotFound
+	}
+
+	u := *e.user
+	return &u, nil
+}
+
+func (r *cachedRepo) load(ctx context.Context, userID string) (entry, error) {
+	writes := r.writes.Load()
+
+	if e, ok := r.getShared(ctx, userID); ok {
+		r.store(ctx, writes, userID, e, false)
+		return e, nil
+	}
+
+	return r.read(ctx, writes, userID)
+}
+
+// read reads the user from the backend and caches what it finds
+func (r *cachedRepo) read(ctx context.Context, writes uint64, userID string) (entry, error) {
+	u, err := r.next.GetUser(ctx, userID)
+	switch {
+	case err == nil:
+		e := entry{user: u, expires: time.Now().Add(r.ttl)}
+		r.store(ctx, writes, userID, e, true)
+		return e, nil
+	case errors.Is(err, repo.ErrNotFound):
+		e := entry{expires: time.Now().Add(r.negativeTTL)}
+		r.store(ctx, writes, userID, e, true)
+		return e, nil
+	default:
+		return entry{}, err
+	}
+}
+
+// store caches e, unless a write finished since the lookup that found it
+// started
+func (r *cachedRepo) store(ctx context.Context, writes uint64, userID string, e entry, shared bool) {
+	if r.writes.Load() != writes {
+		return
+	}
+
+	r.local.set(userID, e)
+	if shared && r.shared != nil {
+		r.setShared(ctx, userID, e)
+	}
+}
+
+func (r *cachedRepo) getShared(ctx context.Context, userID string) (entry, bool) {
+	if r.shared == nil {
+		return entry{}, false
+	}
+
+	value, ok, err := r.shared.Get(ctx, key(userID))
+	if err != nil {
+		logging.FromContext(ctx).Warn("Failed to read from shared cache", zap.Error(err))
+		return entry{}, false
+	}
+	if !ok {
+		return entry{}, false
+	}
+
+	var cached sharedEntry
+	if err := json.Unmarshal(value, &cached); err != nil {
+		logging.FromContext(ctx).Warn("Failed to decode shared cache entry", zap.Error(err))
+		return entry{}, false
+	}
+
+	e := entry{user: cached.User, expires: time.UnixMilli(cached.Expires)}
+	return e, !e.expired()
+}
+
+func (r *cachedRepo) setShared(ctx context.Context, userID string, e entry) {
+	value, err := json.Marshal(sharedEntry{User: e.user, Expires: e.expires.UnixMilli()})
+	if err != nil {
+		logging.FromContext(ctx).Warn("Failed to encode shared cache entry", zap.Error(err))
+		return
+	}
+
+	if err := r.shared.Set(ctx, key(userID), value, time.Until(e.expires)); err != nil {
+		logging.FromContext(ctx).Warn("Failed to write to shared cache", zap.Error(err))
+	}
+}
+
+// written updates the cache after a write to the user. u is the user as
+// written, or nil when the write failed or deleted the user. Failed writes
+// still drop the cached user, since failures such as conflicts mean it is
+// likely stale.
+func (r *cachedRepo) written(ctx context.Context, userID string, u *user.User) {
+	r.writes.Add(1)
+	r.group.Forget(userID)
+
+	if u != nil {
+		r.local.refresh(userID, entry{user: u, expires: time.Now().Add(r.ttl)})
+	} else {
+		r.local.delete(userID)
+	}
+
+	// Other instances may be writing too, so the shared entry is dropped
+	// rather than replaced, which could overwrite a newer version
+	if r.shared != nil {
+		if err := r.shared.Delete(ctx, key(userID)); err != nil {
+			logging.FromContext(ctx).Warn("Failed to delete from shared cache", zap.Error(err))
+		}
+	}
+}
+
+func (r *cachedRepo) CreateUser(ctx context.Context, u user.User) (*user.User, error) {
+	created, err := r.next.CreateUser(ctx, u)
+	if err == nil {
+		r.written(ctx, created.ID, copyUser(created))
+	}
+
+	return created, err
+}
+
+func (r *cachedRepo) UpdateUser(ctx context.Context, u user.User, expectedVersion int64) (*user.User, error) {
+	updated, err := r.next.UpdateUser(ctx, u, expectedVersion)
+	r.written(ctx, u.ID, copyUser(updated))
+
+	return updated, err
+}
+
+func (r *cachedRepo) PatchUser(ctx context.Context, userID string, changes repo.UserChanges, expectedVersion int64) (*user.User, error) {
+	patched, err := r.next.PatchUser(ctx, userID, changes, expectedVersion)
+	r.written(ctx, userID, copyUser(patched))
+
+	return patched, err
+}
+
+func (r *cachedRepo) DeleteUser(ctx context.Context, userID string, expectedVersion int64) error {
+	err := r.next.DeleteUser(ctx, userID, expectedVersion)
+	r.written(ctx, userID, nil)
+
+	return err
+}
+
+func (r *cachedRepo) RestoreUser(ctx context.Context, userID string, expectedVersion int64) (*user.User, error) {
+	restored, err := r.next.RestoreUser(ctx, userID, expectedVersion)
+	r.written(ctx, userID, copyUser(restored))
+
+	return restored, err
+}
+
+func (r *cachedRepo) RevertUser(ctx context.Context, userID string, version int64, expectedVersion int64) (*user.User, error) {
+	reverted, err := r.next.RevertUser(ctx, userID, version, expectedVersion)
+	r.written(ctx, userID, copyUser(reverted))
+
+	return reverted, err
+}
+
+// PurgeDeletedUsers leaves the cache alone, since deleted users are never
+// cached as anything but missing
+func (r *cachedRepo) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int, error) {
+	return r.next.PurgeDeletedUsers(ctx, deletedBefore)
+}
+
+func (r *cachedRepo) GetUserByEmail(ctx context.Context, email string) (*user.User, error) {
+	return r.next.GetUserByEmail(ctx, email)
+}
+
+func (r *cachedRepo) ListUsers(ctx context.Context, opts repo.ListOptions) (repo.Page, error) {
+	return r.next.ListUsers(ctx, opts)
+}
+
+// GetUserAsOf is not cached, since past states are not invalidated by writes
+// and are rarely read
+func (r *cachedRepo) GetUserAsOf(ctx context.Context, userID string, asOf time.Time) (*user.User, error) {
+	return r.next.GetUserAsOf(ctx, userID, asOf)
+}
+
+func (r *cachedRepo) ListUserHistory(ctx context.Context, userID string, opts repo.ListOptions) (repo.HistoryPage, error) {
+	return r.next.ListUserHistory(ctx, userID, opts)
+}
+
+// copyUser keeps the cache apart from the user handed back to the caller
+func copyUser(u *user.User) *user.User {
+	if u == nil {
+		return nil
+	}
+
+	c := *u
+	return &c
+}
@@ -0,0 +1,286 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/repo/cache"
+	"github.com/crestenstclair/crud/internal/repo/cache/cachetest"
+	"github.com/crestenstclair/crud/internal/repo/mocks"
+	"github.com/crestenstclair/crud/internal/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestConfig() *config.Config {
+	return &config.Config{
+		UserCacheSize:          10,
+		UserCacheTTLMS:         1000,
+		UserCacheNegativeTTLMS: 1000,
+	}
+}
+
+func TestCache(t *testing.T) {
+	t.Run("Reads each user from the backend once", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(&user.User{ID: "123", Version: 1}, nil).Once()
+		cached := cache.WrapRepo(r, newTestConfig(), nil)
+
+		for i := 0; i < 3; i++ {
+			u, err := cached.GetUser(context.Background(), "123")
+			assert.NoError(t, err)
+			assert.Equal(t, "123", u.ID)
+		}
+	})
+
+	t.Run("Keeps callers from changing cached users", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(&user.User{ID: "123", FirstName: "Fred"}, nil).Once()
+		cached := cache.WrapRepo(r, newTestConfig(), nil)
+
+		u, _ := cached.GetUser(context.Background(), "123")
+		u.FirstName = "Barney"
+		u, _ = cached.GetUser(context.Background(), "123")
+
+		assert.Equal(t, "Fred", u.FirstName)
+	})
+
+	t.Run("Reads users again once they expire", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.UserCacheTTLMS = 10
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(&user.User{ID: "123"}, nil).Twice()
+		cached := cache.WrapRepo(r, cfg, nil)
+
+		_, _ = cached.GetUser(context.Background(), "123")
+		time.Sleep(20 * time.Millisecond)
+		_, err := cached.GetUser(context.Background(), "123")
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("Reads past the cache when asked to read consistently", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(&user.User{ID: "123", Version: 1}, nil).Once()
+		r.On("GetUser", mock.MatchedBy(repo.ConsistentRead), "123").Return(&user.User{ID: "123", Version: 2}, nil).Once()
+		cached := cache.WrapRepo(r, newTestConfig(), nil)
+
+		_, _ = cached.GetUser(context.Background(), "123")
+		u, err := cached.GetUser(repo.WithConsistentRead(context.Background()), "123")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), u.Version)
+
+		// The stale user is replaced by the one read
+		u, err = cached.GetUser(context.Background(), "123")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), u.Version)
+	})
+
+	t.Run("Caches users that were not found briefly", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.UserCacheNegativeTTLMS = 10
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(nil, repo.ErrNotFound).Twice()
+		cached := cache.WrapRepo(r, cfg, nil)
+
+		_, err := cached.GetUser(context.Background(), "123")
+		assert.ErrorIs(t, err, repo.ErrNotFound)
+		_, err = cached.GetUser(context.Background(), "123")
+		assert.ErrorIs(t, err, repo.ErrNotFound)
+
+		time.Sleep(20 * time.Millisecond)
+		_, err = cached.GetUser(context.Background(), "123")
+		assert.ErrorIs(t, err, repo.ErrNotFound)
+	})
+
+	t.Run("Does not cache failures", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(nil, repo.ErrUnavailable).Once()
+		r.On("GetUser", mock.Anything, "123").Return(&user.User{ID: "123"}, nil).Once()
+		cached := cache.WrapRepo(r, newTestConfig(), nil)
+
+		_, err := cached.GetUser(context.Background(), "123")
+		assert.ErrorIs(t, err, repo.ErrUnavailable)
+		_, err = cached.GetUser(context.Background(), "123")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Shares one lookup between concurrent callers", func(t *testing.T) {
+		release := make(chan struct{})
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").
+			Run(func(mock.Arguments) { <-release }).
+			Return(&user.User{ID: "123"}, nil).Once()
+		cached := cache.WrapRepo(r, newTestConfig(), nil)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				u, err := cached.GetUser(context.Background(), "123")
+				assert.NoError(t, err)
+				assert.Equal(t, "123", u.ID)
+			}()
+		}
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+		wg.Wait()
+	})
+
+	t.Run("Evicts the least recently used user", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.UserCacheSize = 2
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "1").Return(&user.User{ID: "1"}, nil).Once()
+		r.On("GetUser", mock.Anything, "2").Return(&user.User{ID: "2"}, nil).Twice()
+		r.On("GetUser", mock.Anything, "3").Return(&user.User{ID: "3"}, nil).Once()
+		cached := cache.WrapRepo(r, cfg, nil)
+
+		for _, id := range []string{"1", "2", "1", "3", "1", "2"} {
+			_, err := cached.GetUser(context.Background(), id)
+			assert.NoError(t, err)
+		}
+	})
+
+	t.Run("Is skipped when disabled", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+
+		assert.Same(t, r, cache.WrapRepo(r, &config.Config{}, nil))
+	})
+}
+
+func TestCacheWrites(t *testing.T) {
+	t.Run("Serves the user as written", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(&user.User{ID: "123", FirstName: "Fred", Version: 1}, nil).Once()
+		r.On("PatchUser", mock.Anything, "123", mock.Anything, int64(1)).
+			Return(&user.User{ID: "123", FirstName: "Barney", Version: 2}, nil).Once()
+		cached := cache.WrapRepo(r, newTestConfig(), nil)
+
+		_, _ = cached.GetUser(context.Background(), "123")
+		name := "Barney"
+		_, err := cached.PatchUser(context.Background(), "123", repo.UserChanges{FirstName: &name}, 1)
+		assert.NoError(t, err)
+
+		u, err := cached.GetUser(context.Background(), "123")
+		assert.NoError(t, err)
+		assert.Equal(t, "Barney", u.FirstName)
+		assert.Equal(t, int64(2), u.Version)
+	})
+
+	t.Run("Serves created users that were not found before", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(nil, repo.ErrNotFound).Once()
+		r.On("CreateUser", mock.Anything, mock.Anything).Return(&user.User{ID: "123", Version: 1}, nil).Once()
+		cached := cache.WrapRepo(r, newTestConfig(), nil)
+
+		_, _ = cached.GetUser(context.Background(), "123")
+		_, err := cached.CreateUser(context.Background(), user.User{ID: "123"})
+		assert.NoError(t, err)
+
+		u, err := cached.GetUser(context.Background(), "123")
+		assert.NoError(t, err)
+		assert.Equal(t, "123", u.ID)
+	})
+
+	t.Run("Forgets deleted users", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(&user.User{ID: "123"}, nil).Once()
+		r.On("DeleteUser", mock.Anything, "123", repo.AnyVersion).Return(nil).Once()
+		r.On("GetUser", mock.Anything, "123").Return(nil, repo.ErrNotFound).Once()
+		cached := cache.WrapRepo(r, newTestConfig(), nil)
+
+		_, _ = cached.GetUser(context.Background(), "123")
+		assert.NoError(t, cached.DeleteUser(context.Background(), "123", repo.AnyVersion))
+
+		_, err := cached.GetUser(context.Background(), "123")
+		assert.ErrorIs(t, err, repo.ErrNotFound)
+	})
+
+	t.Run("Forgets users that failed to update", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(&user.User{ID: "123", Version: 1}, nil).Once()
+		r.On("UpdateUser", mock.Anything, mock.Anything, int64(1)).Return(nil, repo.ErrConflict).Once()
+		r.On("GetUser", mock.Anything, "123").Return(&user.User{ID: "123", Version: 2}, nil).Once()
+		cached := cache.WrapRepo(r, newTestConfig(), nil)
+
+		_, _ = cached.GetUser(context.Background(), "123")
+		_, err := cached.UpdateUser(context.Background(), user.User{ID: "123"}, 1)
+		assert.ErrorIs(t, err, repo.ErrConflict)
+
+		u, err := cached.GetUser(context.Background(), "123")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), u.Version)
+	})
+
+	t.Run("Does not cache what a lookup read before a write", func(t *testing.T) {
+		release := make(chan struct{})
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").
+			Run(func(mock.Arguments) { <-release }).
+			Return(&user.User{ID: "123", Version: 1}, nil).Once()
+		r.On("DeleteUser", mock.Anything, "123", repo.AnyVersion).Return(nil).Once()
+		r.On("GetUser", mock.Anything, "123").Return(nil, repo.ErrNotFound).Once()
+		cached := cache.WrapRepo(r, newTestConfig(), nil)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = cached.GetUser(context.Background(), "123")
+		}()
+		time.Sleep(10 * time.Millisecond)
+		assert.NoError(t, cached.DeleteUser(context.Background(), "123", repo.AnyVersion))
+		close(release)
+		<-done
+
+		_, err := cached.GetUser(context.Background(), "123")
+		assert.ErrorIs(t, err, repo.ErrNotFound)
+	})
+}
+
+func TestSharedCache(t *testing.T) {
+	t.Run("Shares users between instances", func(t *testing.T) {
+		shared := cachetest.New()
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(&user.User{ID: "123"}, nil).Once()
+
+		_, err := cache.WrapRepo(r, newTestConfig(), shared).GetUser(context.Background(), "123")
+		assert.NoError(t, err)
+		u, err := cache.WrapRepo(r, newTestConfig(), shared).GetUser(context.Background(), "123")
+		assert.NoError(t, err)
+
+		assert.Equal(t, "123", u.ID)
+	})
+
+	t.Run("Drops shared entries on write", func(t *testing.T) {
+		shared := cachetest.New()
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(&user.User{ID: "123"}, nil).Once()
+		r.On("DeleteUser", mock.Anything, "123", repo.AnyVersion).Return(nil).Once()
+		cached := cache.WrapRepo(r, newTestConfig(), shared)
+
+		_, _ = cached.GetUser(context.Background(), "123")
+		assert.Equal(t, 1, shared.Len())
+		assert.NoError(t, cached.DeleteUser(context.Background(), "123", repo.AnyVersion))
+
+		assert.Equal(t, 0, shared.Len())
+	})
+
+	t.Run("Falls back to the repo when the shared cache fails", func(t *testing.T) {
+		shared := cachetest.New()
+		shared.Err = errors.New("connection refused")
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(&user.User{ID: "123"}, nil).Once()
+
+		u, err := cache.WrapRepo(r, newTestConfig(), shared).GetUser(context.Background(), "123")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "123", u.ID)
+	})
+}
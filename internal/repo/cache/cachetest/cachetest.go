@@ -0,0 +1,74 @@
+// Package cachetest provides a shared cache backend held in memory, so the
+// cache can be tested without running one.
+package cachetest
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Backend implements cache.Backend in memory. Err, when set, is returned by
+// every call, to test how the cache copes with a failing backend.
+type Backend struct {
+	mu    sync.Mutex
+	items map[string]item
+	Err   error
+}
+
+type item struct {
+	value   []byte
+	expires time.Time
+}
+
+func New() *Backend {
+	return &Backend{items: map[string]item{}}
+}
+
+func (b *Backend) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.Err != nil {
+		return nil, false, b.Err
+	}
+
+	i, ok := b.items[key]
+	if !ok || !time.Now().Before(i.expires) {
+		return nil, false, nil
+	}
+
+	return i.value, true, nil
+}
+
+func (b *Backend) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.Err != nil {
+		return b.Err
+	}
+
+	b.items[key] = item{value: value, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (b *Backend) Delete(ctx context.Context, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.Err != nil {
+		return b.Err
+	}
+
+	delete(b.items, key)
+	return nil
+}
+
+// Len is the number of entries held, including expired ones
+func (b *Backend) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.items)
+}
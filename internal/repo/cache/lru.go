@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/crestenstclair/crud/internal/user"
+)
+
+// entry is a cached lookup. A nil user caches that the user does not exist.
+type entry struct {
+	user    *user.User
+	expires time.Time
+}
+
+func (e entry) expired() bool {
+	return !time.Now().Before(e.expires)
+}
+
+// lru holds up to size entries, evicting the least recently used first
+type lru struct {
+	mu    sync.Mutex
+	size  int
+	items map[string]*list.Element
+	order *list.List
+}
+
+type lruItem struct {
+	key   string
+	entry entry
+}
+
+func newLRU(size int) *lru {
+	return &lru{size: size, items: map[string]*list.Element{}, order: list.New()}
+}
+
+func (c *lru) get(key string) (entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return entry{}, false
+	}
+
+	item := el.Value.(*lruItem)
+	if item.entry.expired() {
+		c.remove(el)
+		return entry{}, false
+	}
+
+	c.order.MoveToFront(el)
+	return item.entry, true
+}
+
+func (c *lru) set(key string, e entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.put(key, e)
+}
+
+// refresh caches e unless a newer version of the user is already cached,
+// which happens when concurrent writes finish out of order
+func (c *lru) refresh(key string, e entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		cached := el.Value.(*lruItem).entry
+		if cached.user != nil && e.user != nil && cached.user.Version > e.user.Version {
+			return
+		}
+	}
+
+	c.put(key, e)
+}
+
+func (c *lru) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+}
+
+func (c *lru) put(key string, e entry) {
+	if el, ok := c.items[key]; ok {
+		el.Value.(*lruItem).entry = e
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&lruItem{key: key, entry: e})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *lru) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*lruItem).key)
+}
@@ -0,0 +1,77 @@
+package cursor
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrInvalid is returned when a cursor is malformed or was not issued by a
+// Codec holding the same secret.
+var ErrInvalid = errors.New("invalid cursor")
+
+// Codec turns backend specific pagination state into opaque cursor tokens.
+// Tokens are signed so clients cannot forge or alter them to read outside
+// the listing they were handed.
+type Codec struct {
+	secret []byte
+}
+
+func New(secret []byte) (*Codec, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("cursor secret must not be empty")
+	}
+
+	return &Codec{
+		secret: secret,
+	}, nil
+}
+
+func (c *Codec) Encode(state any) (string, error) {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+
+	return encode(payload) + "." + encode(c.sign(payload)), nil
+}
+
+func (c *Codec) Decode(token string, state any) error {
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return ErrInvalid
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return ErrInvalid
+	}
+
+	if !hmac.Equal(signature, c.sign(payload)) {
+		return ErrInvalid
+	}
+
+	if err := json.Unmarshal(payload, state); err != nil {
+		return ErrInvalid
+	}
+
+	return nil
+}
+
+func (c *Codec) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,61 @@
+package cursor_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/crestenstclair/crud/internal/repo/cursor"
+	"github.com/stretchr/testify/assert"
+)
+
+type state struct {
+	ID string
+}
+
+func TestCodec(t *testing.T) {
+	t.Run("Errors when secret is empty", func(t *testing.T) {
+		_, err := cursor.New(nil)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Round trips state through a token", func(t *testing.T) {
+		codec, _ := cursor.New([]byte("secret"))
+
+		token, err := codec.Encode(state{ID: "userID"})
+		assert.NoError(t, err)
+
+		result := state{}
+		err = codec.Decode(token, &result)
+		assert.NoError(t, err)
+		assert.Equal(t, "userID", result.ID)
+	})
+
+	t.Run("Rejects tokens that were tampered with", func(t *testing.T) {
+		codec, _ := cursor.New([]byte("secret"))
+		token, _ := codec.Encode(state{ID: "userID"})
+		forged, _ := codec.Encode(state{ID: "otherID"})
+
+		payload, _, _ := strings.Cut(forged, ".")
+		_, signature, _ := strings.Cut(token, ".")
+
+		err := codec.Decode(payload+"."+signature, &state{})
+		assert.ErrorIs(t, err, cursor.ErrInvalid)
+	})
+
+	t.Run("Rejects tokens signed with a different secret", func(t *testing.T) {
+		codec, _ := cursor.New([]byte("secret"))
+		other, _ := cursor.New([]byte("other"))
+		token, _ := other.Encode(state{ID: "userID"})
+
+		err := codec.Decode(token, &state{})
+		assert.ErrorIs(t, err, cursor.ErrInvalid)
+	})
+
+	t.Run("Rejects malformed tokens", func(t *testing.T) {
+		codec, _ := cursor.New([]byte("secret"))
+
+		assert.ErrorIs(t, codec.Decode("garbage", &state{}), cursor.ErrInvalid)
+		assert.ErrorIs(t, codec.Decode("!!.!!", &state{}), cursor.ErrInvalid)
+	})
+}
@@ -0,0 +1,98 @@
+package dynamo
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/crestenstclair/crud/internal/user"
+)
+
+// BackfillResult is what BackfillEmailReservations did
+type BackfillResult struct {
+	// Reserved is how many users were given a reservation
+	Reserved int
+	// Conflicts are the IDs of users whose email is reserved by another user.
+	// Users created before reservations existed may share an email, and
+	// which of them keeps it is left to whoever runs the backfill.
+	Conflicts []string
+}
+
+// BackfillEmailReservations gives every user created before reservations
+// existed a reservation for its email, so the email cannot be taken by another
+// user. Users that already hold their reservation are left alone, so it is
+// safe to run more than once. It scans the whole table, so it is meant to be
+// run once after deploying rather than while handling a request.
+func (d DynamoRepo) BackfillEmailReservations(ctx context.Context) (BackfillResult, error) {
+	var result BackfillResult
+
+	var startKey map[string]*dynamodb.AttributeValue
+	for {
+		// Deleted users are given a reservation when they are deleted
+		response, err := d.client.ScanWithContext(ctx, &dynamodb.ScanInput{
+			TableName:            &d.tableName,
+			ExclusiveStartKey:    startKey,
+			FilterExpression:     aws.String("NOT begins_with(ID, :prefix) AND attribute_not_exists(DeletedAt)"),
+			ProjectionExpression: aws.String("ID, Email"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":prefix": {
+					S: aws.String(emailReservationPrefix),
+				},
+			},
+		})
+		if err != nil {
+			return result, translateError(ctx, err)
+		}
+
+		var users []user.User
+		if err := dynamodbattribute.UnmarshalListOfMaps(response.Items, &users); err != nil {
+			return result, err
+		}
+
+		for _, u := range users {
+			reserved, owner, err := d.backfillReservation(ctx, u)
+			if err != nil {
+				return result, err
+			}
+			if reserved {
+				result.Reserved++
+			} else if owner != u.ID {
+				result.Conflicts = append(result.Conflicts, u.ID)
+			}
+		}
+
+		startKey = response.LastEvaluatedKey
+		if len(startKey) == 0 {
+			return result, nil
+		}
+	}
+}
+
+// backfillReservation claims u's email for u. When the email is already
+// reserved, it returns the user holding it instead.
+func (d DynamoRepo) backfillReservation(ctx context.Context, u user.User) (bool, string, error) {
+	reservation := d.reserveEmail(u.Email, u.ID).Put
+
+	_, err := d.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName:                           reservation.TableName,
+		Item:                                reservation.Item,
+		ConditionExpression:                 reservation.ConditionExpression,
+		ExpressionAttributeValues:           reservation.ExpressionAttributeValues,
+		ReturnValuesOnConditionCheckFailure: aws.String("ALL_OLD"),
+	})
+	var failed *dynamodb.ConditionalCheckFailedException
+	if errors.As(err, &failed) {
+		var existing emailReservation
+		if err := dynamodbattribute.UnmarshalMap(failed.Item, &existing); err != nil {
+			return false, "", err
+		}
+		return false, existing.UserID, nil
+	}
+	if err != nil {
+		return false, "", translateError(ctx, err)
+	}
+
+	return true, u.ID, nil
+}
@@ -0,0 +1,71 @@
+package dynamo
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/crestenstclair/crud/internal/repo"
+)
+
+// failedCondition returns the cancellation reason for the item at index when
+// err is a cancelled transaction and that item failed its condition expression.
+func failedCondition(err error, index int) *dynamodb.CancellationReason {
+	var canceled *dynamodb.TransactionCanceledException
+	if !errors.As(err, &canceled) || index >= len(canceled.CancellationReasons) {
+		return nil
+	}
+
+	reason := canceled.CancellationReasons[index]
+	if reason == nil || aws.StringValue(reason.Code) != "ConditionalCheckFailed" {
+		return nil
+	}
+
+	return reason
+}
+
+func conditionFailedAt(err error, index int) bool {
+	return failedCondition(err, index) != nil
+}
+
+func notFound(userID string) error {
+	return fmt.Errorf("%w: %s", repo.ErrNotFound, userID)
+}
+
+// checkExpectedVersion returns ErrConflict when the caller expects a version
+// other than the one stored.
+func checkExpectedVersion(stored int64, expected int64) error {
+	if expected == repo.AnyVersion || stored == expected {
+		return nil
+	}
+
+	return fmt.Errorf("%w: expected version %d, found %d", repo.ErrConflict, expected, stored)
+}
+
+// versionCondition guards a write on the user item against changes made after
+// the item was read at version current. Users written before versioning was
+// introduced have no Version attribute.
+func versionCondition(current int64, values map[string]*dynamodb.AttributeValue) string {
+	if current == 0 {
+		return "attribute_not_exists(Version)"
+	}
+
+	values[":expectedVersion"] = &dynamodb.AttributeValue{
+		N: aws.String(fmt.Sprint(current)),
+	}
+
+	return "Version = :expectedVersion"
+}
+
+// conflictOrNotFound interprets a failed condition on the user item. DynamoDB
+// only returns the existing item when it exists, in which case the write lost a
+// race with another writer rather than targeting a missing user. A user
+// deleted by that writer is missing all the same.
+func conflictOrNotFound(userID string, item map[string]*dynamodb.AttributeValue) error {
+	if _, deleted := item["DeletedAt"]; item == nil || deleted {
+		return notFound(userID)
+	}
+
+	return fmt.Errorf("%w: %s was modified by another request", repo.ErrConflict, userID)
+}
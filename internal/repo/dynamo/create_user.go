@@ -2,36 +2,54 @@ package dynamo
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/crestenstclair/crud/internal/history"
+	"github.com/crestenstclair/crud/internal/repo"
 	"github.com/crestenstclair/crud/internal/user"
 )
 
 func (d DynamoRepo) CreateUser(ctx context.Context, u user.User) (*user.User, error) {
+	u.Version = 1
+
 	av, err := dynamodbattribute.MarshalMap(u)
 	if err != nil {
 		return nil, err
 	}
 
-	existingUser, err := d.GetUserByEmail(ctx, u.Email)
+	// The user and its email reservation are written together, so two concurrent
+	// creates with the same email can never both succeed.
+	items, err := d.withHistory(ctx, []*dynamodb.TransactWriteItem{
+		{
+			Put: &dynamodb.Put{
+				Item:                av,
+				TableName:           &d.tableName,
+				ConditionExpression: aws.String("attribute_not_exists(ID)"),
+			},
+		},
+		d.reserveEmail(u.Email, u.ID),
+	}, history.Create, nil, u)
 	if err != nil {
 		return nil, err
 	}
 
-	if existingUser != nil && existingUser.ID != u.ID {
-		return nil, &UniqueConstraintViolation{
-			Message: "User creation failed. Email already in use by existing user.",
-		}
+	_, err = d.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+
+	if conditionFailedAt(err, 1) {
+		return nil, &repo.ErrUnique{Field: "email"}
 	}
 
-	_, err = d.client.PutItem(&dynamodb.PutItemInput{
-		Item:      av,
-		TableName: &d.tableName,
-	})
+	if conditionFailedAt(err, 0) {
+		return nil, fmt.Errorf("%w: %s already exists", repo.ErrConflict, u.ID)
+	}
 
 	if err != nil {
-		return nil, err
+		return nil, translateError(ctx, err)
 	}
 
 	return &u, nil
@@ -2,24 +2,86 @@ package dynamo
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/crestenstclair/crud/internal/history"
 )
 
-func (d DynamoRepo) DeleteUser(ctx context.Context, userID string) error {
-	_, err := d.client.DeleteItem(&dynamodb.DeleteItemInput{
-		TableName:           &d.tableName,
-		ConditionExpression: aws.String("attribute_exists(ID)"),
-		Key: map[string]*dynamodb.AttributeValue{
-			"ID": {
-				S: aws.String(userID),
+// DeleteUser marks the user deleted, keeping it to be restored or purged
+func (d DynamoRepo) DeleteUser(ctx context.Context, userID string, expectedVersion int64) error {
+	existingUser, err := d.getUser(ctx, userID, true)
+	if err != nil {
+		return err
+	}
+
+	if err := checkExpectedVersion(existingUser.Version, expectedVersion); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	expressionValues := map[string]*dynamodb.AttributeValue{
+		":email": {
+			S: aws.String(existingUser.Email),
+		},
+		// Deletion times are compared as strings when purging, so they are
+		// always written in UTC
+		":deletedAt": {
+			S: aws.String(now.UTC().Format(time.RFC3339)),
+		},
+		":lastModified": {
+			S: aws.String(now.Format(time.RFC3339)),
+		},
+		":version": {
+			N: aws.String(fmt.Sprint(existingUser.Version + 1)),
+		},
+	}
+	conditionExpression := fmt.Sprintf(
+		"attribute_exists(ID) AND attribute_not_exists(DeletedAt) AND Email = :email AND %s",
+		versionCondition(existingUser.Version, expressionValues),
+	)
+
+	deleted := *existingUser
+	deleted.DeletedAt = *expressionValues[":deletedAt"].S
+	deleted.LastModified = *expressionValues[":lastModified"].S
+	deleted.Version = existingUser.Version + 1
+
+	// Hold the email in the same transaction, so it cannot be claimed until the
+	// hold is over
+	items, err := d.withHistory(ctx, []*dynamodb.TransactWriteItem{
+		{
+			Update: &dynamodb.Update{
+				TableName:                           &d.tableName,
+				ConditionExpression:                 aws.String(conditionExpression),
+				UpdateExpression:                    aws.String("SET DeletedAt = :deletedAt, LastModified = :lastModified, Version = :version"),
+				ExpressionAttributeValues:           expressionValues,
+				ReturnValuesOnConditionCheckFailure: aws.String("ALL_OLD"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"ID": {
+						S: aws.String(userID),
+					},
+				},
 			},
 		},
-	})
+		d.holdEmail(existingUser.Email, userID, now.Add(d.emailHold)),
+	}, history.Delete, existingUser, deleted)
 	if err != nil {
 		return err
 	}
 
+	_, err = d.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+
+	if reason := failedCondition(err, 0); reason != nil {
+		return conflictOrNotFound(userID, reason.Item)
+	}
+
+	if err != nil {
+		return translateError(ctx, err)
+	}
+
 	return nil
 }
@@ -1,25 +1,55 @@
 package dynamo
 
 import (
+	"time"
+
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/crestenstclair/crud/internal/repo/cursor"
 )
 
 type DynamoRepo struct {
 	client    dynamodbiface.DynamoDBAPI
 	tableName string
+	cursors   *cursor.Codec
+	emailHold time.Duration
+	// historyTable is empty when history is not recorded
+	historyTable string
 }
 
-type UniqueConstraintViolation struct {
-	Message string
+// Option configures a DynamoRepo
+type Option func(*DynamoRepo)
+
+// WithEmailHold keeps the email of a deleted user from being taken by another
+// user for hold, so the deleted user can still be restored with it. Emails
+// are free to take as soon as their user is deleted by default.
+func WithEmailHold(hold time.Duration) Option {
+	return func(d *DynamoRepo) {
+		d.emailHold = hold
+	}
 }
 
-func (u UniqueConstraintViolation) Error() string {
-	return u.Message
+// WithHistoryTable records the history of every user in table, which is keyed
+// by UserID and Version. History is not recorded by default.
+func WithHistoryTable(table string) Option {
+	return func(d *DynamoRepo) {
+		d.historyTable = table
+	}
 }
 
-func New(tableName string, db dynamodbiface.DynamoDBAPI) (*DynamoRepo, error) {
-	return &DynamoRepo{
+func New(tableName string, db dynamodbiface.DynamoDBAPI, cursorSecret []byte, opts ...Option) (*DynamoRepo, error) {
+	cursors, err := cursor.New(cursorSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DynamoRepo{
 		client:    db,
 		tableName: tableName,
-	}, nil
+		cursors:   cursors,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d, nil
 }
@@ -3,11 +3,22 @@ package dynamo_test
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/crestenstclair/crud/internal/history"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/repo/cursor"
 	"github.com/crestenstclair/crud/internal/repo/dynamo"
 	"github.com/crestenstclair/crud/internal/user"
 	"github.com/stretchr/testify/assert"
@@ -23,14 +34,17 @@ var (
 	DOB       = "1979-12-09T00:00:00Z"
 )
 
+// anyVersion is repo.AnyVersion, for tests whose repo shadows the package
+const anyVersion = repo.AnyVersion
+
 type DynamodbMockClient struct {
 	dynamodbiface.DynamoDBAPI
 	mock.Mock
 }
 
-func (m *DynamodbMockClient) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+func (m *DynamodbMockClient) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, _ ...request.Option) (*dynamodb.GetItemOutput, error) {
 	// Ferry arguments into mock call
-	args := m.Called(input)
+	args := m.Called(ctx, input)
 
 	arg0 := args.Get(0)
 	var resultOne *dynamodb.GetItemOutput
@@ -45,9 +59,9 @@ func (m *DynamodbMockClient) GetItem(input *dynamodb.GetItemInput) (*dynamodb.Ge
 	return resultOne, args.Error(1)
 }
 
-func (m *DynamodbMockClient) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+func (m *DynamodbMockClient) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, _ ...request.Option) (*dynamodb.UpdateItemOutput, error) {
 	// Ferry arguments into mock call
-	args := m.Called(input)
+	args := m.Called(ctx, input)
 
 	arg0 := args.Get(0)
 	var resultOne *dynamodb.UpdateItemOutput
@@ -62,20 +76,40 @@ func (m *DynamodbMockClient) UpdateItem(input *dynamodb.UpdateItemInput) (*dynam
 	return resultOne, args.Error(1)
 }
 
-func (m *DynamodbMockClient) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
-	args := m.Called(input)
+func (m *DynamodbMockClient) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, _ ...request.Option) (*dynamodb.PutItemOutput, error) {
+	args := m.Called(ctx, input)
 
 	return &dynamodb.PutItemOutput{}, args.Error(1)
 }
 
-func (m *DynamodbMockClient) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
-	args := m.Called(input)
+func (m *DynamodbMockClient) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, _ ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	args := m.Called(ctx, input)
 
 	return nil, args.Error(1)
 }
 
-func (m *DynamodbMockClient) Query(input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
-	args := m.Called(input)
+func (m *DynamodbMockClient) TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, _ ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	args := m.Called(ctx, input)
+
+	return &dynamodb.TransactWriteItemsOutput{}, args.Error(1)
+}
+
+func (m *DynamodbMockClient) ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, _ ...request.Option) (*dynamodb.ScanOutput, error) {
+	args := m.Called(ctx, input)
+
+	arg0 := args.Get(0)
+	var resultOne *dynamodb.ScanOutput
+	if arg0 != nil {
+		resultOne = arg0.(*dynamodb.ScanOutput)
+	} else {
+		resultOne = &dynamodb.ScanOutput{}
+	}
+
+	return resultOne, args.Error(1)
+}
+
+func (m *DynamodbMockClient) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, _ ...request.Option) (*dynamodb.QueryOutput, error) {
+	args := m.Called(ctx, input)
 
 	arg0 := args.Get(0)
 	var resultOne *dynamodb.QueryOutput
@@ -88,32 +122,129 @@ func (m *DynamodbMockClient) Query(input *dynamodb.QueryInput) (*dynamodb.QueryO
 	return resultOne, args.Error(1)
 }
 
+// transactionCanceled builds the error DynamoDB returns when the items at the
+// given indexes fail their condition expressions.
+func transactionCanceled(size int, failed ...int) error {
+	reasons := make([]*dynamodb.CancellationReason, size)
+	for i := range reasons {
+		reasons[i] = &dynamodb.CancellationReason{Code: aws.String("None")}
+	}
+	for _, i := range failed {
+		reasons[i].Code = aws.String("ConditionalCheckFailed")
+	}
+
+	return &dynamodb.TransactionCanceledException{CancellationReasons: reasons}
+}
+
+// TransactingClient is a minimal in-memory stand in for DynamoDB that applies
+// transactions atomically, honoring attribute_not_exists(ID) conditions on puts.
+// Items with a ReleaseAt are treated as still held.
+type TransactingClient struct {
+	dynamodbiface.DynamoDBAPI
+	mu    sync.Mutex
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func (c *TransactingClient) TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, _ ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var failed []int
+	for i, item := range input.TransactItems {
+		if item.Put == nil || !strings.HasPrefix(aws.StringValue(item.Put.ConditionExpression), "attribute_not_exists(ID)") {
+			continue
+		}
+		if _, ok := c.items[*item.Put.Item["ID"].S]; ok {
+			failed = append(failed, i)
+		}
+	}
+
+	if len(failed) > 0 {
+		return nil, transactionCanceled(len(input.TransactItems), failed...)
+	}
+
+	for _, item := range input.TransactItems {
+		if item.Put != nil {
+			c.items[*item.Put.Item["ID"].S] = item.Put.Item
+		}
+	}
+
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
 func TestGetUser(t *testing.T) {
 	t.Run("Returns error when error occurs", func(t *testing.T) {
 		client := &DynamodbMockClient{}
-		repo, _ := dynamo.New("tableName", client)
-		client.On("GetItem", mock.Anything).Return(nil, errors.New("test error"))
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(nil, errors.New("test error"))
 		ctx := context.Background()
 		_, err := repo.GetUser(ctx, userID)
 
 		assert.Error(t, err)
 	})
 
-	t.Run("Returns nil, no error when user is not found", func(t *testing.T) {
+	t.Run("Returns ErrNotFound when user is not found", func(t *testing.T) {
 		client := &DynamodbMockClient{}
-		repo, _ := dynamo.New("tableName", client)
-		client.On("GetItem", mock.Anything).Return(nil, nil)
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(nil, nil)
 		ctx := context.Background()
 		res, err := repo.GetUser(ctx, userID)
 
+		assert.ErrorIs(t, err, errNotFound)
+		assert.Nil(t, res)
+	})
+
+	t.Run("Passes the caller's context through to DynamoDB", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		client.On("GetItemWithContext", ctx, mock.Anything).Return(fullUserItem(), nil)
+
+		_, err := repo.GetUser(ctx, userID)
+
 		assert.NoError(t, err)
+		client.AssertExpectations(t)
+	})
+
+	t.Run("Reads consistently when the context asks to", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		d, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.MatchedBy(func(input *dynamodb.GetItemInput) bool {
+			return aws.BoolValue(input.ConsistentRead)
+		})).Return(fullUserItem(), nil)
+
+		_, err := d.GetUser(repo.WithConsistentRead(context.Background()), userID)
+
+		assert.NoError(t, err)
+		client.AssertExpectations(t)
+	})
+
+	t.Run("Returns ErrNotFound when user was deleted", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(deletedUserItem(email), nil)
+		ctx := context.Background()
+		_, err := repo.GetUser(ctx, userID)
+
+		assert.ErrorIs(t, err, errNotFound)
+	})
+
+	t.Run("Does not return email reservations as users", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		ctx := context.Background()
+		res, err := repo.GetUser(ctx, "email#"+email)
+
+		assert.ErrorIs(t, err, errNotFound)
 		assert.Nil(t, res)
+		client.AssertNotCalled(t, "GetItemWithContext", mock.Anything, mock.Anything)
 	})
 
 	t.Run("Mashalls properties as expected when User is found", func(t *testing.T) {
 		client := &DynamodbMockClient{}
-		repo, _ := dynamo.New("tableName", client)
-		client.On("GetItem", &dynamodb.GetItemInput{
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, &dynamodb.GetItemInput{
 			Key: map[string]*dynamodb.AttributeValue{
 				"ID": {
 					S: aws.String(userID),
@@ -152,36 +283,94 @@ func TestGetUser(t *testing.T) {
 	})
 }
 
+// fullUserItem is a user as stored in the table, with every attribute set
+func fullUserItem() *dynamodb.GetItemOutput {
+	return &dynamodb.GetItemOutput{
+		Item: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(userID),
+			},
+			"FirstName": {
+				S: aws.String(firstName),
+			},
+			"LastName": {
+				S: aws.String(lastName),
+			},
+			"Email": {
+				S: aws.String(email),
+			},
+			"DOB": {
+				S: aws.String(DOB),
+			},
+		},
+	}
+}
+
+func getItemFor(id string) interface{} {
+	return mock.MatchedBy(func(input *dynamodb.GetItemInput) bool {
+		return *input.Key["ID"].S == id
+	})
+}
+
 func TestGetUserByEmail(t *testing.T) {
 	t.Run("Returns error when error occurs", func(t *testing.T) {
 		client := &DynamodbMockClient{}
-		repo, _ := dynamo.New("tableName", client)
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
 
-		client.On("Query", mock.Anything).Return(&dynamodb.QueryOutput{}, errors.New("test error"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(nil, errors.New("test error"))
 
 		ctx := context.Background()
-		_, err := repo.GetUserByEmail(ctx, userID)
+		_, err := repo.GetUserByEmail(ctx, email)
 
 		assert.Error(t, err)
 	})
 
-	t.Run("Returns nil, no error when user is not found", func(t *testing.T) {
+	t.Run("Returns ErrNotFound when user is not found", func(t *testing.T) {
 		client := &DynamodbMockClient{}
-		repo, _ := dynamo.New("tableName", client)
-		client.On("Query", mock.Anything).Return(&dynamodb.QueryOutput{
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		client.On("QueryWithContext", mock.Anything, mock.Anything).Return(&dynamodb.QueryOutput{
 			Items: []map[string]*dynamodb.AttributeValue{},
 		}, nil)
 		ctx := context.Background()
-		res, err := repo.GetUserByEmail(ctx, userID)
+		res, err := repo.GetUserByEmail(ctx, email)
 
-		assert.NoError(t, err)
+		assert.ErrorIs(t, err, errNotFound)
 		assert.Nil(t, res)
 	})
 
-	t.Run("Mashalls properties as expected when User is found", func(t *testing.T) {
+	t.Run("Follows the case insensitive email reservation to the full user", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, getItemFor("email#"+email)).Return(&dynamodb.GetItemOutput{
+			Item: map[string]*dynamodb.AttributeValue{
+				"ID": {
+					S: aws.String("email#" + email),
+				},
+				"UserID": {
+					S: aws.String(userID),
+				},
+			},
+		}, nil)
+		client.On("GetItemWithContext", mock.Anything, getItemFor(userID)).Return(fullUserItem(), nil)
+		ctx := context.Background()
+		result, err := repo.GetUserByEmail(ctx, "Example@EXAMPLE.com")
+
+		assert.NoError(t, err)
+
+		assert.Equal(t, "userID", result.ID)
+		assert.Equal(t, "firstName", result.FirstName)
+		assert.Equal(t, "lastName", result.LastName)
+		assert.Equal(t, "example@example.com", result.Email)
+		assert.Equal(t, "1979-12-09T00:00:00Z", result.DOB)
+		client.AssertNotCalled(t, "QueryWithContext", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Falls back to the email index and fetches the full user", func(t *testing.T) {
 		client := &DynamodbMockClient{}
-		repo, _ := dynamo.New("tableName", client)
-		client.On("Query", &dynamodb.QueryInput{
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, getItemFor("email#"+email)).Return(nil, nil)
+		client.On("QueryWithContext", mock.Anything, &dynamodb.QueryInput{
 			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
 				":email": {
 					S: aws.String(email),
@@ -191,24 +380,17 @@ func TestGetUserByEmail(t *testing.T) {
 			IndexName:              aws.String("email"),
 			TableName:              aws.String("tableName"),
 		}).Return(&dynamodb.QueryOutput{
+			// The index is KEYS_ONLY, so only keys come back
 			Items: []map[string]*dynamodb.AttributeValue{{
 				"ID": {
 					S: aws.String(userID),
 				},
-				"FirstName": {
-					S: aws.String(firstName),
-				},
-				"LastName": {
-					S: aws.String(lastName),
-				},
 				"Email": {
 					S: aws.String(email),
 				},
-				"DOB": {
-					S: aws.String(DOB),
-				},
 			}},
 		}, nil)
+		client.On("GetItemWithContext", mock.Anything, getItemFor(userID)).Return(fullUserItem(), nil)
 		ctx := context.Background()
 		result, err := repo.GetUserByEmail(ctx, email)
 
@@ -217,7 +399,6 @@ func TestGetUserByEmail(t *testing.T) {
 		assert.Equal(t, "userID", result.ID)
 		assert.Equal(t, "firstName", result.FirstName)
 		assert.Equal(t, "lastName", result.LastName)
-		assert.Equal(t, "example@example.com", result.Email)
 		assert.Equal(t, "1979-12-09T00:00:00Z", result.DOB)
 	})
 }
@@ -225,9 +406,8 @@ func TestGetUserByEmail(t *testing.T) {
 func TestCreateUser(t *testing.T) {
 	t.Run("Returns error when error occurs", func(t *testing.T) {
 		client := &DynamodbMockClient{}
-		repo, _ := dynamo.New("tableName", client)
-		client.On("Query", mock.Anything).Return(&dynamodb.QueryOutput{}, nil)
-		client.On("PutItem", mock.Anything).Return(nil, errors.New("test error"))
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, errors.New("test error"))
 		ctx := context.Background()
 		_, err := repo.CreateUser(ctx, user.User{})
 
@@ -236,34 +416,8 @@ func TestCreateUser(t *testing.T) {
 
 	t.Run("Properly marshalls passed in user into attribute struct", func(t *testing.T) {
 		client := &DynamodbMockClient{}
-		repo, _ := dynamo.New("tableName", client)
-		client.On("Query", mock.Anything).Return(&dynamodb.QueryOutput{}, nil)
-		client.On("PutItem", &dynamodb.PutItemInput{
-			Item: map[string]*dynamodb.AttributeValue{
-				"ID": {
-					S: aws.String(userID),
-				},
-				"FirstName": {
-					S: aws.String(firstName),
-				},
-				"LastName": {
-					S: aws.String(lastName),
-				},
-				"Email": {
-					S: aws.String(email),
-				},
-				"DOB": {
-					S: aws.String(DOB),
-				},
-				"CreatedAt": {
-					S: aws.String(DOB),
-				},
-				"LastModified": {
-					S: aws.String(DOB),
-				},
-			},
-			TableName: aws.String("tableName"),
-		}).Return(nil, nil)
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		transactMock := client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, nil)
 		ctx := context.Background()
 		_, err := repo.CreateUser(ctx, user.User{
 			ID:           userID,
@@ -276,53 +430,216 @@ func TestCreateUser(t *testing.T) {
 		})
 
 		assert.NoError(t, err)
+		arg := transactMock.Parent.Calls[0].Arguments[1].(*dynamodb.TransactWriteItemsInput)
+		// Released reservations may be claimed, which depends on the time
+		now := arg.TransactItems[1].Put.ExpressionAttributeValues[":now"]
+		releasedBefore, _ := strconv.ParseInt(*now.N, 10, 64)
+		assert.InDelta(t, time.Now().Unix(), releasedBefore, 5)
+		assert.Equal(t, &dynamodb.TransactWriteItemsInput{
+			TransactItems: []*dynamodb.TransactWriteItem{
+				{
+					Put: &dynamodb.Put{
+						Item: map[string]*dynamodb.AttributeValue{
+							"ID": {
+								S: aws.String(userID),
+							},
+							"FirstName": {
+								S: aws.String(firstName),
+							},
+							"LastName": {
+								S: aws.String(lastName),
+							},
+							"Email": {
+								S: aws.String(email),
+							},
+							"DOB": {
+								S: aws.String(DOB),
+							},
+							"CreatedAt": {
+								S: aws.String(DOB),
+							},
+							"LastModified": {
+								S: aws.String(DOB),
+							},
+							"Version": {
+								N: aws.String("1"),
+							},
+						},
+						TableName:           aws.String("tableName"),
+						ConditionExpression: aws.String("attribute_not_exists(ID)"),
+					},
+				},
+				{
+					Put: &dynamodb.Put{
+						Item: map[string]*dynamodb.AttributeValue{
+							"ID": {
+								S: aws.String("email#" + email),
+							},
+							"UserID": {
+								S: aws.String(userID),
+							},
+						},
+						TableName:           aws.String("tableName"),
+						ConditionExpression: aws.String("attribute_not_exists(ID) OR ReleaseAt <= :now"),
+						ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+							":now": now,
+						},
+					},
+				},
+			},
+		}, arg)
+	})
+
+	t.Run("Starts new users at version 1", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := context.Background()
+		result, err := repo.CreateUser(ctx, user.User{ID: userID, Email: email})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), result.Version)
+	})
+
+	t.Run("Returns ErrUnique when email reservation exists", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, transactionCanceled(2, 1))
+		ctx := context.Background()
+		_, err := repo.CreateUser(ctx, user.User{ID: userID, Email: email})
+
+		assert.True(t, isEmailUnique(err))
+	})
+
+	t.Run("Returns ErrUnique when the cancellation is wrapped", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).
+			Return(nil, fmt.Errorf("traced: %w", transactionCanceled(2, 1)))
+		ctx := context.Background()
+		_, err := repo.CreateUser(ctx, user.User{ID: userID, Email: email})
+
+		assert.True(t, isEmailUnique(err))
+	})
+
+	t.Run("Allows exactly one of two concurrent creates with the same email", func(t *testing.T) {
+		client := &TransactingClient{items: map[string]map[string]*dynamodb.AttributeValue{}}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		ctx := context.Background()
+
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = repo.CreateUser(ctx, user.User{ID: fmt.Sprint(userID, i), Email: email})
+			}(i)
+		}
+		wg.Wait()
+
+		violations := 0
+		successes := 0
+		for _, err := range errs {
+			switch {
+			case err == nil:
+				successes++
+			case isEmailUnique(err):
+				violations++
+			}
+		}
+		assert.Equal(t, 1, successes)
+		assert.Equal(t, 1, violations)
 	})
 }
 
+// existingUserItem is the stored user returned by the consistent read that
+// precedes updates and deletes.
+func existingUserItem(storedEmail string) *dynamodb.GetItemOutput {
+	return &dynamodb.GetItemOutput{
+		Item: map[string]*dynamodb.AttributeValue{
+			"Version": {
+				N: aws.String("3"),
+			},
+			"ID": {
+				S: aws.String(userID),
+			},
+			"Email": {
+				S: aws.String(storedEmail),
+			},
+			"CreatedAt": {
+				S: aws.String(DOB),
+			},
+			"LastModified": {
+				S: aws.String(DOB),
+			},
+		},
+	}
+}
+
+// deletedUserItem is a stored user that was deleted and not yet purged
+func deletedUserItem(storedEmail string) *dynamodb.GetItemOutput {
+	item := existingUserItem(storedEmail)
+	item.Item["DeletedAt"] = &dynamodb.AttributeValue{S: aws.String(DOB)}
+	return item
+}
+
 func TestUpdateUser(t *testing.T) {
 	t.Run("Returns error when error occurs", func(t *testing.T) {
 		client := &DynamodbMockClient{}
-		repo, _ := dynamo.New("tableName", client)
-		client.On("Query", mock.Anything).Return(&dynamodb.QueryOutput{
-			Items: []map[string]*dynamodb.AttributeValue{
-				{
-					"LastModified": {
-						S: aws.String("1234"),
-					}},
-				{
-					"CreatedAt": {
-						S: aws.String("1234"),
-					}},
-			},
-		}, nil)
-		client.On("UpdateItem", mock.Anything).Return(nil, errors.New("test error"))
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem(email), nil)
+		client.On("UpdateItemWithContext", mock.Anything, mock.Anything).Return(nil, errors.New("test error"))
 		ctx := context.Background()
-		_, err := repo.UpdateUser(ctx, user.User{})
+		_, err := repo.UpdateUser(ctx, user.User{ID: userID, Email: email}, anyVersion)
 
 		assert.Error(t, err)
 	})
 
+	t.Run("Returns ErrNotFound when user does not exist", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := context.Background()
+		_, err := repo.UpdateUser(ctx, user.User{ID: userID, Email: email}, anyVersion)
+
+		assert.ErrorIs(t, err, errNotFound)
+	})
+
+	t.Run("Updates users stored before versioning when version 0 is expected", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		legacy := existingUserItem(email)
+		delete(legacy.Item, "Version")
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(legacy, nil)
+		client.On("UpdateItemWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := context.Background()
+
+		_, err := repo.UpdateUser(ctx, user.User{ID: userID, Email: email}, 0)
+
+		assert.NoError(t, err)
+		input := client.Calls[1].Arguments[1].(*dynamodb.UpdateItemInput)
+		assert.Contains(t, *input.ConditionExpression, "attribute_not_exists(Version)")
+	})
+
+	t.Run("Rejects version 0 for users that have been versioned", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem(email), nil)
+		ctx := context.Background()
+
+		_, err := repo.UpdateUser(ctx, user.User{ID: userID, Email: email}, 0)
+
+		assert.ErrorIs(t, err, errConflict)
+		client.AssertNotCalled(t, "UpdateItemWithContext", mock.Anything, mock.Anything)
+	})
+
 	t.Run("Properly marshalls passed in user into attribute struct", func(t *testing.T) {
 		client := &DynamodbMockClient{}
-		repo, _ := dynamo.New("tableName", client)
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
 
-		client.On("Query", mock.Anything, mock.Anything).Return(&dynamodb.QueryOutput{
-			Items: []map[string]*dynamodb.AttributeValue{{
-				"ID": {
-					S: aws.String(userID),
-				},
-				"Email": {
-					S: aws.String(email),
-				},
-				"CreatedAt": {
-					S: aws.String(DOB),
-				},
-				"LastModified": {
-					S: aws.String(DOB),
-				},
-			}},
-		}, nil)
-		putMock := client.On("UpdateItem", mock.Anything).Return(nil, nil)
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem(email), nil)
+		putMock := client.On("UpdateItemWithContext", mock.Anything, mock.Anything).Return(nil, nil)
 		ctx := context.Background()
 		_, err := repo.UpdateUser(ctx, user.User{
 			ID:           userID,
@@ -332,67 +649,89 @@ func TestUpdateUser(t *testing.T) {
 			DOB:          DOB,
 			CreatedAt:    DOB,
 			LastModified: DOB,
-		})
+		}, anyVersion)
 
 		assert.NoError(t, err)
 		call := putMock.Parent.Calls[1]
-		arg := call.Arguments[0].(*dynamodb.UpdateItemInput)
+		arg := call.Arguments[1].(*dynamodb.UpdateItemInput)
 
 		assert.Equal(t, firstName, *arg.ExpressionAttributeValues[":FirstName"].S)
 		assert.Equal(t, lastName, *arg.ExpressionAttributeValues[":LastName"].S)
 		assert.Equal(t, email, *arg.ExpressionAttributeValues[":Email"].S)
 		assert.Equal(t, DOB, *arg.ExpressionAttributeValues[":DOB"].S)
+		assert.Equal(t, email, *arg.ExpressionAttributeValues[":expectedEmail"].S)
+		assert.Equal(t, "3", *arg.ExpressionAttributeValues[":expectedVersion"].N)
+		assert.Equal(t, "4", *arg.ExpressionAttributeValues[":Version"].N)
 	})
 
-	t.Run("Properly detects when a user's email is taken", func(t *testing.T) {
+	t.Run("Returns ErrConflict when expected version is stale", func(t *testing.T) {
 		client := &DynamodbMockClient{}
-		repo, _ := dynamo.New("tableName", client)
-
-		client.On("Query", mock.Anything, mock.Anything).Return(&dynamodb.QueryOutput{
-			Items: []map[string]*dynamodb.AttributeValue{{
-				"ID": {
-					S: aws.String("DifferentID"),
-				},
-				"Email": {
-					S: aws.String(email),
-				},
-			}},
-		}, nil)
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem(email), nil)
 		ctx := context.Background()
-		_, err := repo.UpdateUser(ctx, user.User{
-			ID:           userID,
-			FirstName:    firstName,
-			LastName:     lastName,
-			Email:        email,
-			DOB:          DOB,
-			CreatedAt:    DOB,
-			LastModified: DOB,
+		_, err := repo.UpdateUser(ctx, user.User{ID: userID, Email: email}, 2)
+
+		assert.ErrorIs(t, err, errConflict)
+		client.AssertNotCalled(t, "UpdateItemWithContext", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Returns ErrConflict when user changes between read and write", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem(email), nil)
+		client.On("UpdateItemWithContext", mock.Anything, mock.Anything).Return(nil, &dynamodb.ConditionalCheckFailedException{
+			Item: existingUserItem(email).Item,
 		})
+		ctx := context.Background()
+		_, err := repo.UpdateUser(ctx, user.User{ID: userID, Email: email}, 3)
 
-		assert.Error(t, err, "User email update failed. Attempted to change email")
+		assert.ErrorIs(t, err, errConflict)
 	})
-	t.Run("Does not false positive email dupe when same user is found", func(t *testing.T) {
+
+	t.Run("Swaps email reservations in the same transaction when email changes", func(t *testing.T) {
 		client := &DynamodbMockClient{}
-		repo, _ := dynamo.New("tableName", client)
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
 
-		client.On("Query", mock.Anything, mock.Anything).Return(&dynamodb.QueryOutput{
-			Items: []map[string]*dynamodb.AttributeValue{
-				{
-					"ID": {
-						S: aws.String(userID),
-					}},
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem("old@example.com"), nil)
+		transactMock := client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := context.Background()
+		result, err := repo.UpdateUser(ctx, user.User{
+			ID:        userID,
+			FirstName: firstName,
+			LastName:  lastName,
+			Email:     email,
+			DOB:       DOB,
+		}, anyVersion)
 
-				{
-					"LastModified": {
-						S: aws.String("1234"),
-					}},
-				{
-					"CreatedAt": {
-						S: aws.String("1234"),
-					}},
-			},
-		}, nil)
-		client.On("UpdateItem", mock.Anything).Return(nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, DOB, result.CreatedAt)
+
+		arg := transactMock.Parent.Calls[1].Arguments[1].(*dynamodb.TransactWriteItemsInput)
+		assert.Len(t, arg.TransactItems, 3)
+		assert.Equal(t, "old@example.com", *arg.TransactItems[0].Update.ExpressionAttributeValues[":expectedEmail"].S)
+		assert.Equal(t, "email#"+email, *arg.TransactItems[1].Put.Item["ID"].S)
+		assert.Equal(t, "email#old@example.com", *arg.TransactItems[2].Delete.Key["ID"].S)
+	})
+
+	t.Run("Does not move the reservation when only the email's case changes", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem(email), nil)
+		client.On("UpdateItemWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := context.Background()
+		_, err := repo.UpdateUser(ctx, user.User{ID: userID, Email: "EXAMPLE@example.com"}, anyVersion)
+
+		assert.NoError(t, err)
+		client.AssertNotCalled(t, "TransactWriteItemsWithContext", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Properly detects when a user's email is taken", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem("old@example.com"), nil)
+		client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, transactionCanceled(3, 1))
 		ctx := context.Background()
 		_, err := repo.UpdateUser(ctx, user.User{
 			ID:           userID,
@@ -402,38 +741,893 @@ func TestUpdateUser(t *testing.T) {
 			DOB:          DOB,
 			CreatedAt:    DOB,
 			LastModified: DOB,
-		})
+		}, anyVersion)
 
-		assert.NoError(t, err)
+		assert.True(t, isEmailUnique(err))
 	})
 }
 
-func TestDeleteUser(t *testing.T) {
-	t.Run("Returns error when error occurs", func(t *testing.T) {
+func TestPatchUser(t *testing.T) {
+	t.Run("Returns ErrNotFound when user does not exist", func(t *testing.T) {
 		client := &DynamodbMockClient{}
-		repo, _ := dynamo.New("tableName", client)
-		client.On("DeleteItem", mock.Anything).Return(nil, errors.New("test error"))
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(nil, nil)
 		ctx := context.Background()
-		err := repo.DeleteUser(ctx, userID)
+		_, err := repo.PatchUser(ctx, userID, userChanges(aws.String(lastName), nil), anyVersion)
 
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, errNotFound)
 	})
 
-	t.Run("Returns nil when no error occurs", func(t *testing.T) {
+	t.Run("Writes only the changed attributes", func(t *testing.T) {
 		client := &DynamodbMockClient{}
-		repo, _ := dynamo.New("tableName", client)
-		client.On("DeleteItem", &dynamodb.DeleteItemInput{
-			ConditionExpression: aws.String("attribute_exists(ID)"),
-			TableName:           aws.String("tableName"),
-			Key: map[string]*dynamodb.AttributeValue{
-				"ID": {
-					S: aws.String(userID),
-				},
-			},
-		}).Return(nil, nil)
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem(email), nil)
+		updateMock := client.On("UpdateItemWithContext", mock.Anything, mock.Anything).Return(nil, nil)
 		ctx := context.Background()
-		err := repo.DeleteUser(ctx, userID)
+		_, err := repo.PatchUser(ctx, userID, userChanges(aws.String(lastName), nil), 3)
 
 		assert.NoError(t, err)
+		arg := updateMock.Parent.Calls[1].Arguments[1].(*dynamodb.UpdateItemInput)
+
+		assert.Equal(t, lastName, *arg.ExpressionAttributeValues[":LastName"].S)
+		assert.Equal(t, "4", *arg.ExpressionAttributeValues[":Version"].N)
+		assert.Contains(t, arg.ExpressionAttributeValues, ":LastModified")
+		assert.NotContains(t, arg.ExpressionAttributeValues, ":FirstName")
+		assert.NotContains(t, arg.ExpressionAttributeValues, ":Email")
+		assert.NotContains(t, arg.ExpressionAttributeValues, ":DOB")
+		assert.NotContains(t, *arg.UpdateExpression, "FirstName")
+	})
+
+	t.Run("Returns ErrConflict when expected version is stale", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem(email), nil)
+		ctx := context.Background()
+		_, err := repo.PatchUser(ctx, userID, userChanges(aws.String(lastName), nil), 2)
+
+		assert.ErrorIs(t, err, errConflict)
+		client.AssertNotCalled(t, "UpdateItemWithContext", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Moves the email reservation when the email changes", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem("old@example.com"), nil)
+		transactMock := client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := context.Background()
+		result, err := repo.PatchUser(ctx, userID, userChanges(nil, aws.String(email)), anyVersion)
+
+		assert.NoError(t, err)
+		assert.Equal(t, email, result.Email)
+		assert.Equal(t, int64(4), result.Version)
+
+		arg := transactMock.Parent.Calls[1].Arguments[1].(*dynamodb.TransactWriteItemsInput)
+		assert.Len(t, arg.TransactItems, 3)
+		assert.Equal(t, "email#"+email, *arg.TransactItems[1].Put.Item["ID"].S)
+		assert.Equal(t, "email#old@example.com", *arg.TransactItems[2].Delete.Key["ID"].S)
+	})
+}
+
+func TestDeleteUser(t *testing.T) {
+	t.Run("Returns error when error occurs", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem(email), nil)
+		client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, errors.New("test error"))
+		ctx := context.Background()
+		err := repo.DeleteUser(ctx, userID, anyVersion)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Returns ErrNotFound when user does not exist", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := context.Background()
+		err := repo.DeleteUser(ctx, userID, anyVersion)
+
+		assert.ErrorIs(t, err, errNotFound)
+	})
+
+	t.Run("Marks the user deleted and holds its email reservation", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"), dynamo.WithEmailHold(time.Hour))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem(email), nil)
+		transactMock := client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := context.Background()
+		err := repo.DeleteUser(ctx, userID, anyVersion)
+
+		assert.NoError(t, err)
+		arg := transactMock.Parent.Calls[1].Arguments[1].(*dynamodb.TransactWriteItemsInput)
+		deleted := arg.TransactItems[0].Update
+		assert.Equal(t, userID, *deleted.Key["ID"].S)
+		assert.Contains(t, *deleted.UpdateExpression, "DeletedAt = :deletedAt")
+		assert.Equal(t, "3", *deleted.ExpressionAttributeValues[":expectedVersion"].N)
+		assert.Equal(t, "4", *deleted.ExpressionAttributeValues[":version"].N)
+
+		held := arg.TransactItems[1].Update
+		assert.Equal(t, "email#"+email, *held.Key["ID"].S)
+		releaseAt, _ := strconv.ParseInt(*held.ExpressionAttributeValues[":releaseAt"].N, 10, 64)
+		assert.InDelta(t, time.Now().Add(time.Hour).Unix(), releaseAt, 5)
+	})
+
+	t.Run("Returns ErrNotFound when user was already deleted", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(deletedUserItem(email), nil)
+		ctx := context.Background()
+		err := repo.DeleteUser(ctx, userID, anyVersion)
+
+		assert.ErrorIs(t, err, errNotFound)
+		client.AssertNotCalled(t, "TransactWriteItemsWithContext", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Returns ErrConflict when expected version is stale", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem(email), nil)
+		ctx := context.Background()
+		err := repo.DeleteUser(ctx, userID, 1)
+
+		assert.ErrorIs(t, err, errConflict)
+		client.AssertNotCalled(t, "TransactWriteItemsWithContext", mock.Anything, mock.Anything)
+	})
+}
+
+func TestRestoreUser(t *testing.T) {
+	t.Run("Returns ErrNotFound when user does not exist", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := context.Background()
+		_, err := repo.RestoreUser(ctx, userID, anyVersion)
+
+		assert.ErrorIs(t, err, errNotFound)
+	})
+
+	t.Run("Returns users that are not deleted unchanged", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem(email), nil)
+		ctx := context.Background()
+		result, err := repo.RestoreUser(ctx, userID, anyVersion)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), result.Version)
+		client.AssertNotCalled(t, "TransactWriteItemsWithContext", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Clears DeletedAt and reclaims the email reservation", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(deletedUserItem(email), nil)
+		transactMock := client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := context.Background()
+		result, err := repo.RestoreUser(ctx, userID, 3)
+
+		assert.NoError(t, err)
+		assert.False(t, result.IsDeleted())
+		assert.Equal(t, int64(4), result.Version)
+		arg := transactMock.Parent.Calls[1].Arguments[1].(*dynamodb.TransactWriteItemsInput)
+		assert.Contains(t, *arg.TransactItems[0].Update.UpdateExpression, "REMOVE DeletedAt")
+		assert.Equal(t, "email#"+email, *arg.TransactItems[1].Update.Key["ID"].S)
+	})
+
+	t.Run("Returns ErrUnique when the email was claimed after the hold", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(deletedUserItem(email), nil)
+		client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, transactionCanceled(2, 1))
+		ctx := context.Background()
+		_, err := repo.RestoreUser(ctx, userID, anyVersion)
+
+		assert.True(t, isEmailUnique(err))
+	})
+
+	t.Run("Returns ErrConflict when expected version is stale", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(deletedUserItem(email), nil)
+		ctx := context.Background()
+		_, err := repo.RestoreUser(ctx, userID, 1)
+
+		assert.ErrorIs(t, err, errConflict)
+	})
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	deletedItem := func(id string) map[string]*dynamodb.AttributeValue {
+		item := userItem(id)
+		item["DeletedAt"] = &dynamodb.AttributeValue{S: aws.String(DOB)}
+		return item
+	}
+	historyRecord := func(id string, version int64) map[string]*dynamodb.AttributeValue {
+		item, _ := dynamodbattribute.MarshalMap(history.Record{
+			UserID:  id,
+			Version: version,
+			Changes: []history.Change{{Field: "email", Before: "a@example.com", After: "b@example.com"}},
+			User:    &user.User{ID: id, Email: "b@example.com"},
+		})
+		return item
+	}
+
+	t.Run("Scans for users deleted before the cutoff", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("ScanWithContext", mock.Anything, mock.Anything).Return(&dynamodb.ScanOutput{}, nil)
+		ctx := context.Background()
+		cutoff := time.Date(2023, 1, 2, 3, 4, 5, 0, time.FixedZone("PST", -8*60*60))
+
+		purged, err := repo.PurgeDeletedUsers(ctx, cutoff)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, purged)
+		input := client.Calls[0].Arguments[1].(*dynamodb.ScanInput)
+		assert.Equal(t, "DeletedAt < :deletedBefore", *input.FilterExpression)
+		assert.Equal(t, "2023-01-02T11:04:05Z", *input.ExpressionAttributeValues[":deletedBefore"].S)
+	})
+
+	t.Run("Deletes each user and its email reservation", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("ScanWithContext", mock.Anything, mock.Anything).Return(&dynamodb.ScanOutput{
+			Items: []map[string]*dynamodb.AttributeValue{deletedItem("a"), deletedItem("b")},
+		}, nil)
+		client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		client.On("DeleteItemWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := context.Background()
+
+		purged, err := repo.PurgeDeletedUsers(ctx, time.Now())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, purged)
+		client.AssertNumberOfCalls(t, "TransactWriteItemsWithContext", 2)
+		client.AssertNumberOfCalls(t, "DeleteItemWithContext", 2)
+		remove := client.Calls[1].Arguments[1].(*dynamodb.TransactWriteItemsInput).TransactItems[0].Delete
+		assert.Equal(t, "a", *remove.Key["ID"].S)
+		assert.Equal(t, "DeletedAt = :deletedAt", *remove.ConditionExpression)
+		reservation := client.Calls[2].Arguments[1].(*dynamodb.DeleteItemInput)
+		assert.Equal(t, "email#a@example.com", *reservation.Key["ID"].S)
+		assert.Equal(t, "a", *reservation.ExpressionAttributeValues[":userID"].S)
+	})
+
+	t.Run("Scrubs the history of each user in the transaction deleting it", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"), dynamo.WithHistoryTable("historyTable"))
+		client.On("ScanWithContext", mock.Anything, mock.Anything).Return(&dynamodb.ScanOutput{
+			Items: []map[string]*dynamodb.AttributeValue{deletedItem("a")},
+		}, nil)
+		client.On("QueryWithContext", mock.Anything, mock.Anything).Return(&dynamodb.QueryOutput{
+			Items: []map[string]*dynamodb.AttributeValue{historyRecord("a", 2)},
+		}, nil)
+		client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		client.On("DeleteItemWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := context.Background()
+
+		purged, err := repo.PurgeDeletedUsers(ctx, time.Now())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, purged)
+		query := client.Calls[1].Arguments[1].(*dynamodb.QueryInput)
+		assert.Equal(t, "historyTable", *query.TableName)
+		assert.Equal(t, "attribute_not_exists(Scrubbed)", *query.FilterExpression)
+		items := client.Calls[2].Arguments[1].(*dynamodb.TransactWriteItemsInput).TransactItems
+		assert.Len(t, items, 2)
+		update := items[0].Update
+		assert.Equal(t, "historyTable", *update.TableName)
+		assert.Equal(t, "2", *update.Key["Version"].N)
+		assert.Contains(t, *update.UpdateExpression, "REMOVE #user")
+		var changes []history.Change
+		assert.NoError(t, dynamodbattribute.Unmarshal(update.ExpressionAttributeValues[":changes"], &changes))
+		assert.Equal(t, []history.Change{{Field: "email"}}, changes)
+		assert.Equal(t, "a", *items[1].Delete.Key["ID"].S)
+	})
+
+	t.Run("Checks the user is still deleted while scrubbing long histories", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"), dynamo.WithHistoryTable("historyTable"))
+		client.On("ScanWithContext", mock.Anything, mock.Anything).Return(&dynamodb.ScanOutput{
+			Items: []map[string]*dynamodb.AttributeValue{deletedItem("a")},
+		}, nil)
+		records := make([]map[string]*dynamodb.AttributeValue, 150)
+		for i := range records {
+			records[i] = historyRecord("a", int64(i+1))
+		}
+		client.On("QueryWithContext", mock.Anything, mock.Anything).Return(&dynamodb.QueryOutput{Items: records}, nil)
+		client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		client.On("DeleteItemWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := context.Background()
+
+		purged, err := repo.PurgeDeletedUsers(ctx, time.Now())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, purged)
+		first := client.Calls[2].Arguments[1].(*dynamodb.TransactWriteItemsInput).TransactItems
+		assert.Len(t, first, 100)
+		assert.Equal(t, "DeletedAt = :deletedAt", *first[99].ConditionCheck.ConditionExpression)
+		last := client.Calls[3].Arguments[1].(*dynamodb.TransactWriteItemsInput).TransactItems
+		assert.Len(t, last, 52)
+		assert.NotNil(t, last[51].Delete)
+	})
+
+	t.Run("Leaves users whose history could not be read", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"), dynamo.WithHistoryTable("historyTable"))
+		client.On("ScanWithContext", mock.Anything, mock.Anything).Return(&dynamodb.ScanOutput{
+			Items: []map[string]*dynamodb.AttributeValue{deletedItem("a")},
+		}, nil)
+		client.On("QueryWithContext", mock.Anything, mock.Anything).Return(nil, errors.New("test error"))
+		ctx := context.Background()
+
+		purged, err := repo.PurgeDeletedUsers(ctx, time.Now())
+
+		assert.Error(t, err)
+		assert.Equal(t, 0, purged)
+		client.AssertNotCalled(t, "TransactWriteItemsWithContext", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Skips users restored since the scan, leaving their history", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"), dynamo.WithHistoryTable("historyTable"))
+		client.On("ScanWithContext", mock.Anything, mock.Anything).Return(&dynamodb.ScanOutput{
+			Items: []map[string]*dynamodb.AttributeValue{deletedItem("a")},
+		}, nil)
+		client.On("QueryWithContext", mock.Anything, mock.Anything).Return(&dynamodb.QueryOutput{
+			Items: []map[string]*dynamodb.AttributeValue{historyRecord("a", 2)},
+		}, nil)
+		// The user's delete is last in the transaction, after the scrubbed record
+		client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, transactionCanceled(2, 1))
+		ctx := context.Background()
+
+		purged, err := repo.PurgeDeletedUsers(ctx, time.Now())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, purged)
+		client.AssertNotCalled(t, "DeleteItemWithContext", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Returns the users purged before an error", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("ScanWithContext", mock.Anything, mock.Anything).Return(&dynamodb.ScanOutput{
+			Items: []map[string]*dynamodb.AttributeValue{deletedItem("a"), deletedItem("b")},
+		}, nil)
+		client.On("TransactWriteItemsWithContext", mock.Anything, mock.MatchedBy(func(input *dynamodb.TransactWriteItemsInput) bool {
+			return *input.TransactItems[0].Delete.Key["ID"].S == "b"
+		})).Return(nil, errors.New("test error"))
+		client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		client.On("DeleteItemWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := context.Background()
+
+		purged, err := repo.PurgeDeletedUsers(ctx, time.Now())
+
+		assert.Error(t, err)
+		assert.Equal(t, 1, purged)
+	})
+}
+
+func TestBackfillEmailReservations(t *testing.T) {
+	t.Run("Reserves the email of every user that is not deleted", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("ScanWithContext", mock.Anything, mock.Anything).Return(&dynamodb.ScanOutput{
+			Items: []map[string]*dynamodb.AttributeValue{userItem("a"), userItem("b")},
+		}, nil)
+		client.On("PutItemWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := context.Background()
+
+		result, err := repo.BackfillEmailReservations(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, result.Reserved)
+		assert.Empty(t, result.Conflicts)
+		scan := client.Calls[0].Arguments[1].(*dynamodb.ScanInput)
+		assert.Equal(t, "NOT begins_with(ID, :prefix) AND attribute_not_exists(DeletedAt)", *scan.FilterExpression)
+		put := client.Calls[1].Arguments[1].(*dynamodb.PutItemInput)
+		assert.Equal(t, "email#a@example.com", *put.Item["ID"].S)
+		assert.Equal(t, "a", *put.Item["UserID"].S)
+		assert.Equal(t, "attribute_not_exists(ID) OR ReleaseAt <= :now", *put.ConditionExpression)
+	})
+
+	t.Run("Reports users whose email another user holds", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("ScanWithContext", mock.Anything, mock.Anything).Return(&dynamodb.ScanOutput{
+			Items: []map[string]*dynamodb.AttributeValue{userItem("a"), userItem("b")},
+		}, nil)
+		client.On("PutItemWithContext", mock.Anything, mock.MatchedBy(func(input *dynamodb.PutItemInput) bool {
+			return *input.Item["UserID"].S == "a"
+		})).Return(nil, &dynamodb.ConditionalCheckFailedException{
+			Item: map[string]*dynamodb.AttributeValue{"UserID": {S: aws.String("a")}},
+		})
+		client.On("PutItemWithContext", mock.Anything, mock.Anything).Return(nil, &dynamodb.ConditionalCheckFailedException{
+			Item: map[string]*dynamodb.AttributeValue{"UserID": {S: aws.String("c")}},
+		})
+		ctx := context.Background()
+
+		result, err := repo.BackfillEmailReservations(ctx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, result.Reserved)
+		assert.Equal(t, []string{"b"}, result.Conflicts)
+	})
+}
+
+func TestHistory(t *testing.T) {
+	historyRepo := func(client dynamodbiface.DynamoDBAPI) *dynamo.DynamoRepo {
+		r, _ := dynamo.New("tableName", client, []byte("secret"), dynamo.WithHistoryTable("historyTable"))
+		return r
+	}
+	recordOf := func(t *testing.T, item *dynamodb.TransactWriteItem) history.Record {
+		assert.Equal(t, "historyTable", *item.Put.TableName)
+		assert.Equal(t, "attribute_not_exists(Version)", *item.Put.ConditionExpression)
+
+		var record history.Record
+		assert.NoError(t, dynamodbattribute.UnmarshalMap(item.Put.Item, &record))
+		return record
+	}
+
+	t.Run("Records creates in the same transaction", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		transactMock := client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := history.WithActor(context.Background(), "fred")
+
+		_, err := historyRepo(client).CreateUser(ctx, user.User{ID: userID, Email: email, LastModified: DOB})
+
+		assert.NoError(t, err)
+		arg := transactMock.Parent.Calls[0].Arguments[1].(*dynamodb.TransactWriteItemsInput)
+		assert.Len(t, arg.TransactItems, 3)
+		record := recordOf(t, arg.TransactItems[2])
+		assert.Equal(t, userID, record.UserID)
+		assert.Equal(t, int64(1), record.Version)
+		assert.Equal(t, history.Create, record.Operation)
+		assert.Equal(t, "fred", record.Actor)
+		assert.Equal(t, DOB, record.Timestamp)
+	})
+
+	t.Run("Records updates that keep the email in a transaction", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem(email), nil)
+		transactMock := client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := context.Background()
+
+		result, err := historyRepo(client).UpdateUser(ctx, user.User{ID: userID, Email: email, LastName: lastName}, anyVersion)
+
+		assert.NoError(t, err)
+		assert.Equal(t, lastName, result.LastName)
+		client.AssertNotCalled(t, "UpdateItemWithContext", mock.Anything, mock.Anything)
+		arg := transactMock.Parent.Calls[1].Arguments[1].(*dynamodb.TransactWriteItemsInput)
+		assert.Len(t, arg.TransactItems, 2)
+		record := recordOf(t, arg.TransactItems[1])
+		assert.Equal(t, int64(4), record.Version)
+		assert.Equal(t, []history.Change{{Field: "lastName", After: lastName}}, record.Changes)
+	})
+
+	t.Run("Reports conflicts rather than taken emails when the email is kept", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem(email), nil)
+		client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, transactionCanceled(2, 0, 1))
+		ctx := context.Background()
+
+		_, err := historyRepo(client).UpdateUser(ctx, user.User{ID: userID, Email: email}, anyVersion)
+
+		assert.False(t, isEmailUnique(err))
+		assert.ErrorIs(t, err, errNotFound)
+	})
+
+	t.Run("Records the email change with the reservations", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem("old@example.com"), nil)
+		transactMock := client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := context.Background()
+
+		_, err := historyRepo(client).PatchUser(ctx, userID, userChanges(nil, &email), anyVersion)
+
+		assert.NoError(t, err)
+		arg := transactMock.Parent.Calls[1].Arguments[1].(*dynamodb.TransactWriteItemsInput)
+		assert.Len(t, arg.TransactItems, 4)
+		record := recordOf(t, arg.TransactItems[3])
+		assert.Equal(t, []history.Change{{Field: "email", Before: "old@example.com", After: email}}, record.Changes)
+	})
+
+	t.Run("Records deletes", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem(email), nil)
+		transactMock := client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := context.Background()
+
+		err := historyRepo(client).DeleteUser(ctx, userID, anyVersion)
+
+		assert.NoError(t, err)
+		arg := transactMock.Parent.Calls[1].Arguments[1].(*dynamodb.TransactWriteItemsInput)
+		record := recordOf(t, arg.TransactItems[2])
+		assert.Equal(t, history.Delete, record.Operation)
+		assert.Equal(t, "deletedAt", record.Changes[0].Field)
+	})
+
+	t.Run("Lists a user's history newest first", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		item, _ := dynamodbattribute.MarshalMap(history.Record{UserID: userID, Version: 2, Operation: history.Update})
+		lastKey := map[string]*dynamodb.AttributeValue{"UserID": {S: aws.String(userID)}, "Version": {N: aws.String("2")}}
+		client.On("QueryWithContext", mock.Anything, mock.Anything).Return(&dynamodb.QueryOutput{
+			Items:            []map[string]*dynamodb.AttributeValue{item},
+			LastEvaluatedKey: lastKey,
+		}, nil).Once()
+		r := historyRepo(client)
+		ctx := context.Background()
+
+		page, err := r.ListUserHistory(ctx, userID, repoListOptions(1, ""))
+
+		assert.NoError(t, err)
+		assert.Len(t, page.Records, 1)
+		assert.Equal(t, history.Update, page.Records[0].Operation)
+		assert.NotEmpty(t, page.NextCursor)
+		input := client.Calls[0].Arguments[1].(*dynamodb.QueryInput)
+		assert.Equal(t, "historyTable", *input.TableName)
+		assert.False(t, *input.ScanIndexForward)
+		assert.Equal(t, int64(1), *input.Limit)
+
+		client.On("QueryWithContext", mock.Anything, mock.MatchedBy(func(input *dynamodb.QueryInput) bool {
+			return input.ExclusiveStartKey != nil && *input.ExclusiveStartKey["Version"].N == "2"
+		})).Return(&dynamodb.QueryOutput{}, nil).Once()
+
+		next, err := r.ListUserHistory(ctx, userID, repoListOptions(1, page.NextCursor))
+
+		assert.NoError(t, err)
+		assert.Empty(t, next.Records)
+		assert.Empty(t, next.NextCursor)
+
+		_, err = r.ListUserHistory(ctx, "otherUser", repoListOptions(1, page.NextCursor))
+
+		assert.ErrorIs(t, err, cursor.ErrInvalid)
+	})
+
+	t.Run("Returns ErrNotFound for users with no history that do not exist", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		client.On("QueryWithContext", mock.Anything, mock.Anything).Return(&dynamodb.QueryOutput{}, nil)
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := context.Background()
+
+		_, err := historyRepo(client).ListUserHistory(ctx, userID, repoListOptions(10, ""))
+
+		assert.ErrorIs(t, err, errNotFound)
+	})
+
+	t.Run("Returns an empty history for users written before history was recorded", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		client.On("QueryWithContext", mock.Anything, mock.Anything).Return(&dynamodb.QueryOutput{}, nil)
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem(email), nil)
+		ctx := context.Background()
+
+		page, err := historyRepo(client).ListUserHistory(ctx, userID, repoListOptions(10, ""))
+
+		assert.NoError(t, err)
+		assert.Empty(t, page.Records)
+	})
+
+	// snapshot is a history record of the user as it was after a write at
+	// timestamp
+	snapshot := func(version int64, timestamp string, u user.User) map[string]*dynamodb.AttributeValue {
+		u.ID = userID
+		u.Version = version
+		u.LastModified = timestamp
+		item, _ := dynamodbattribute.MarshalMap(history.New(context.Background(), history.Update, nil, u))
+		return item
+	}
+	onTable := func(table string) any {
+		return mock.MatchedBy(func(input *dynamodb.GetItemInput) bool {
+			return *input.TableName == table
+		})
+	}
+	march := snapshot(3, "2023-03-01T00:00:00Z", user.User{LastName: "Rubble", Email: email})
+	february := snapshot(2, "2023-02-01T00:00:00Z", user.User{LastName: "Flintstone", Email: "old@example.com"})
+
+	t.Run("Reads the snapshot of the newest record written by the time", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		lastKey := map[string]*dynamodb.AttributeValue{"UserID": {S: aws.String(userID)}, "Version": {N: aws.String("3")}}
+		client.On("QueryWithContext", mock.Anything, mock.MatchedBy(func(input *dynamodb.QueryInput) bool {
+			return input.ExclusiveStartKey == nil
+		})).Return(&dynamodb.QueryOutput{
+			Items:            []map[string]*dynamodb.AttributeValue{march},
+			LastEvaluatedKey: lastKey,
+		}, nil)
+		client.On("QueryWithContext", mock.Anything, mock.MatchedBy(func(input *dynamodb.QueryInput) bool {
+			return input.ExclusiveStartKey != nil && *input.ExclusiveStartKey["Version"].N == "3"
+		})).Return(&dynamodb.QueryOutput{
+			Items: []map[string]*dynamodb.AttributeValue{february},
+		}, nil)
+		ctx := context.Background()
+
+		result, err := historyRepo(client).GetUserAsOf(ctx, userID, time.Date(2023, 2, 15, 0, 0, 0, 0, time.UTC))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Flintstone", result.LastName)
+		assert.Equal(t, int64(2), result.Version)
+		input := client.Calls[0].Arguments[1].(*dynamodb.QueryInput)
+		assert.Equal(t, "historyTable", *input.TableName)
+		assert.False(t, *input.ScanIndexForward)
+	})
+
+	t.Run("Returns ErrNotFound when the user was deleted at the time", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		deleted := snapshot(4, "2023-04-01T00:00:00Z", user.User{Email: email, DeletedAt: "2023-04-01T00:00:00Z"})
+		client.On("QueryWithContext", mock.Anything, mock.Anything).Return(&dynamodb.QueryOutput{
+			Items: []map[string]*dynamodb.AttributeValue{deleted, march},
+		}, nil)
+		ctx := context.Background()
+
+		_, err := historyRepo(client).GetUserAsOf(ctx, userID, time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC))
+
+		assert.ErrorIs(t, err, errNotFound)
+	})
+
+	t.Run("Reads users written before history was recorded as they are now", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		client.On("QueryWithContext", mock.Anything, mock.Anything).Return(&dynamodb.QueryOutput{}, nil)
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(existingUserItem(email), nil)
+		r := historyRepo(client)
+		ctx := context.Background()
+
+		result, err := r.GetUserAsOf(ctx, userID, time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+
+		assert.NoError(t, err)
+		assert.Equal(t, email, result.Email)
+
+		// The stored user was last modified in 1979
+		_, err = r.GetUserAsOf(ctx, userID, time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC))
+
+		assert.ErrorIs(t, err, errNotFound)
+	})
+
+	t.Run("Reverts to the snapshot as a new version in a conditional transaction", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		client.On("GetItemWithContext", mock.Anything, onTable("tableName")).Return(existingUserItem(email), nil)
+		client.On("GetItemWithContext", mock.Anything, onTable("historyTable")).Return(&dynamodb.GetItemOutput{Item: february}, nil)
+		transactMock := client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+		ctx := context.Background()
+
+		result, err := historyRepo(client).RevertUser(ctx, userID, 2, 3)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Flintstone", result.LastName)
+		assert.Equal(t, "old@example.com", result.Email)
+		assert.Equal(t, DOB, result.CreatedAt)
+		assert.Equal(t, int64(4), result.Version)
+		arg := transactMock.Parent.Calls[2].Arguments[1].(*dynamodb.TransactWriteItemsInput)
+		assert.Len(t, arg.TransactItems, 4)
+		assert.Contains(t, *arg.TransactItems[0].Update.ConditionExpression, "Version = :expectedVersion")
+		record := recordOf(t, arg.TransactItems[3])
+		assert.Equal(t, history.Revert, record.Operation)
+		assert.Equal(t, int64(4), record.Version)
+	})
+
+	t.Run("Returns ErrUnique when the earlier email was taken", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		client.On("GetItemWithContext", mock.Anything, onTable("tableName")).Return(existingUserItem(email), nil)
+		client.On("GetItemWithContext", mock.Anything, onTable("historyTable")).Return(&dynamodb.GetItemOutput{Item: february}, nil)
+		client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, transactionCanceled(4, 1))
+		ctx := context.Background()
+
+		_, err := historyRepo(client).RevertUser(ctx, userID, 2, 3)
+
+		assert.True(t, isEmailUnique(err))
+	})
+
+	t.Run("Returns ErrConflict without reverting when expected version is stale", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		client.On("GetItemWithContext", mock.Anything, onTable("tableName")).Return(existingUserItem(email), nil)
+		ctx := context.Background()
+
+		_, err := historyRepo(client).RevertUser(ctx, userID, 2, 2)
+
+		assert.ErrorIs(t, err, repo.ErrConflict)
+		client.AssertNotCalled(t, "TransactWriteItemsWithContext", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Returns ErrVersionNotFound for versions not in the history", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		client.On("GetItemWithContext", mock.Anything, onTable("tableName")).Return(existingUserItem(email), nil)
+		client.On("GetItemWithContext", mock.Anything, onTable("historyTable")).Return(&dynamodb.GetItemOutput{}, nil)
+		ctx := context.Background()
+
+		_, err := historyRepo(client).RevertUser(ctx, userID, 9, anyVersion)
+
+		assert.ErrorIs(t, err, repo.ErrVersionNotFound)
+	})
+
+	t.Run("Cannot list history without a history table", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		r, _ := dynamo.New("tableName", client, []byte("secret"))
+
+		_, err := r.ListUserHistory(context.Background(), userID, repoListOptions(10, ""))
+
+		assert.Error(t, err)
+		client.AssertNotCalled(t, "QueryWithContext", mock.Anything, mock.Anything)
+	})
+}
+
+func userItem(id string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"ID": {
+			S: aws.String(id),
+		},
+		"Email": {
+			S: aws.String(id + "@example.com"),
+		},
+	}
+}
+
+// The helpers below exist because the repo package is shadowed inside tests
+var (
+	errNotFound    = repo.ErrNotFound
+	errConflict    = repo.ErrConflict
+	errThrottled   = repo.ErrThrottled
+	errUnavailable = repo.ErrUnavailable
+)
+
+func isEmailUnique(err error) bool {
+	var unique *repo.ErrUnique
+	return errors.As(err, &unique) && unique.Field == "email"
+}
+
+func userChanges(lastName *string, email *string) repo.UserChanges {
+	return repo.UserChanges{LastName: lastName, Email: email}
+}
+
+func repoListOptions(limit int, cursor string) repo.ListOptions {
+	return repo.ListOptions{
+		Limit:  limit,
+		Cursor: cursor,
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	t.Run("Returns error when error occurs", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("ScanWithContext", mock.Anything, mock.Anything).Return(nil, errors.New("test error"))
+		ctx := context.Background()
+		_, err := repo.ListUsers(ctx, repoListOptions(10, ""))
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Keeps scanning until the page is full and returns a cursor", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		lastKey := map[string]*dynamodb.AttributeValue{"ID": {S: aws.String("b")}}
+		client.On("ScanWithContext", mock.Anything, mock.MatchedBy(func(input *dynamodb.ScanInput) bool {
+			return input.ExclusiveStartKey == nil
+		})).Return(&dynamodb.ScanOutput{
+			Items:            []map[string]*dynamodb.AttributeValue{userItem("a")},
+			LastEvaluatedKey: map[string]*dynamodb.AttributeValue{"ID": {S: aws.String("email#a")}},
+		}, nil)
+		client.On("ScanWithContext", mock.Anything, mock.MatchedBy(func(input *dynamodb.ScanInput) bool {
+			return input.ExclusiveStartKey != nil && *input.Limit == 1
+		})).Return(&dynamodb.ScanOutput{
+			Items:            []map[string]*dynamodb.AttributeValue{userItem("b")},
+			LastEvaluatedKey: lastKey,
+		}, nil)
+		ctx := context.Background()
+
+		page, err := repo.ListUsers(ctx, repoListOptions(2, ""))
+
+		assert.NoError(t, err)
+		assert.Len(t, page.Users, 2)
+		assert.Equal(t, "a", page.Users[0].ID)
+		assert.Equal(t, "b", page.Users[1].ID)
+		assert.NotEmpty(t, page.NextCursor)
+		assert.Equal(t, "attribute_exists(Email) AND attribute_not_exists(DeletedAt)", *client.Calls[0].Arguments[1].(*dynamodb.ScanInput).FilterExpression)
+
+		client.On("ScanWithContext", mock.Anything, mock.MatchedBy(func(input *dynamodb.ScanInput) bool {
+			return input.ExclusiveStartKey != nil && *input.ExclusiveStartKey["ID"].S == "b"
+		})).Return(&dynamodb.ScanOutput{
+			Items: []map[string]*dynamodb.AttributeValue{userItem("c")},
+		}, nil).Once()
+
+		next, err := repo.ListUsers(ctx, repoListOptions(2, page.NextCursor))
+
+		assert.NoError(t, err)
+		assert.Len(t, next.Users, 1)
+		assert.Empty(t, next.NextCursor)
+	})
+
+	t.Run("Rejects cursors it did not issue", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		other, _ := dynamo.New("tableName", client, []byte("other"))
+		client.On("ScanWithContext", mock.Anything, mock.Anything).Return(&dynamodb.ScanOutput{
+			Items:            []map[string]*dynamodb.AttributeValue{userItem("a")},
+			LastEvaluatedKey: map[string]*dynamodb.AttributeValue{"ID": {S: aws.String("a")}},
+		}, nil)
+		ctx := context.Background()
+		page, _ := other.ListUsers(ctx, repoListOptions(1, ""))
+
+		_, err := repo.ListUsers(ctx, repoListOptions(1, page.NextCursor))
+
+		assert.ErrorIs(t, err, cursor.ErrInvalid)
+	})
+}
+
+func TestErrorTranslation(t *testing.T) {
+	t.Run("Translates throttling into ErrThrottled", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(nil, awserr.New(
+			dynamodb.ErrCodeProvisionedThroughputExceededException, "slow down", nil,
+		))
+
+		_, err := repo.GetUser(context.Background(), userID)
+
+		assert.ErrorIs(t, err, errThrottled)
+	})
+
+	t.Run("Translates server errors into ErrUnavailable", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("ScanWithContext", mock.Anything, mock.Anything).Return(nil, awserr.NewRequestFailure(
+			awserr.New("UnknownError", "bad gateway", nil), 502, "requestID",
+		))
+
+		_, err := repo.ListUsers(context.Background(), repoListOptions(1, ""))
+
+		assert.ErrorIs(t, err, errUnavailable)
+	})
+
+	t.Run("Translates failed connections into ErrUnavailable", func(t *testing.T) {
+		for _, code := range []string{request.ErrCodeRequestError, request.ErrCodeResponseTimeout} {
+			client := &DynamodbMockClient{}
+			repo, _ := dynamo.New("tableName", client, []byte("secret"))
+			client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(nil, awserr.New(
+				code, "send request failed", errors.New("read: connection reset by peer"),
+			))
+
+			_, err := repo.GetUser(context.Background(), userID)
+
+			assert.ErrorIs(t, err, errUnavailable, code)
+		}
+	})
+
+	t.Run("Translates cancelled transactions caused by conflicts into ErrConflict", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, &dynamodb.TransactionCanceledException{
+			CancellationReasons: []*dynamodb.CancellationReason{
+				{Code: aws.String("TransactionConflict")},
+				{Code: aws.String("None")},
+			},
+		})
+
+		_, err := repo.CreateUser(context.Background(), user.User{ID: userID, Email: email})
+
+		assert.ErrorIs(t, err, errConflict)
+	})
+
+	t.Run("Does not panic on cancelled transactions of another type", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		canceled := awserr.New(dynamodb.ErrCodeTransactionCanceledException, "test error", nil)
+		client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, canceled)
+
+		_, err := repo.CreateUser(context.Background(), user.User{ID: userID, Email: email})
+
+		assert.ErrorIs(t, err, canceled)
+	})
+
+	t.Run("Surfaces the context's error when a request is cancelled", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", client, []byte("secret"))
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+		defer cancel()
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(nil, awserr.New(
+			request.CanceledErrorCode, "request context canceled", context.DeadlineExceeded,
+		))
+
+		_, err := repo.GetUser(ctx, userID)
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
 	})
 }
@@ -0,0 +1,77 @@
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/crestenstclair/crud/internal/logging"
+	"github.com/crestenstclair/crud/internal/repo"
+	"go.uber.org/zap"
+)
+
+// translateError maps errors returned by the DynamoDB client onto the repo
+// error taxonomy. Errors without a repo equivalent are returned unchanged.
+func translateError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return err
+	}
+
+	// AWS's request ID is what support needs to trace a failed call
+	fields := []zap.Field{zap.String("code", aerr.Code())}
+	var failure awserr.RequestFailure
+	if errors.As(err, &failure) {
+		fields = append(fields, zap.String("awsRequestId", failure.RequestID()))
+	}
+	logging.FromContext(ctx).Debug("DynamoDB request failed", fields...)
+
+	switch aerr.Code() {
+	case request.CanceledErrorCode:
+		// The SDK does not wrap the context's error, so recover it for callers
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: %s", ctx.Err(), err)
+		}
+	case dynamodb.ErrCodeTransactionCanceledException:
+		// Failed conditions are interpreted by each operation, which knows what
+		// its conditions mean. Other reasons are translated here.
+		var canceled *dynamodb.TransactionCanceledException
+		if !errors.As(err, &canceled) {
+			break
+		}
+		for _, reason := range canceled.CancellationReasons {
+			switch aws.StringValue(reason.Code) {
+			case "TransactionConflict":
+				return fmt.Errorf("%w: %s", repo.ErrConflict, err)
+			case "ThrottlingError", "ProvisionedThroughputExceeded":
+				return fmt.Errorf("%w: %s", repo.ErrThrottled, err)
+			}
+		}
+	case dynamodb.ErrCodeTransactionConflictException:
+		return fmt.Errorf("%w: %s", repo.ErrConflict, err)
+	case dynamodb.ErrCodeProvisionedThroughputExceededException,
+		dynamodb.ErrCodeRequestLimitExceeded,
+		"ThrottlingException":
+		return fmt.Errorf("%w: %s", repo.ErrThrottled, err)
+	case dynamodb.ErrCodeInternalServerError, "ServiceUnavailable":
+		return fmt.Errorf("%w: %s", repo.ErrUnavailable, err)
+	case request.ErrCodeRequestError, request.ErrCodeResponseTimeout:
+		// The request never got a response, e.g. the connection was reset.
+		// The SDK does not retry these, so the resilience decorator must.
+		return fmt.Errorf("%w: %s", repo.ErrUnavailable, err)
+	}
+
+	if errors.As(err, &failure) && failure.StatusCode() >= 500 {
+		return fmt.Errorf("%w: %s", repo.ErrUnavailable, err)
+	}
+
+	return err
+}
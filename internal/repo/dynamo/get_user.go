@@ -2,31 +2,59 @@ package dynamo
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/crestenstclair/crud/internal/repo"
 	"github.com/crestenstclair/crud/internal/user"
 )
 
 func (d DynamoRepo) GetUser(ctx context.Context, userID string) (*user.User, error) {
-	response, err := d.client.GetItem(&dynamodb.GetItemInput{
+	return d.getUser(ctx, userID, repo.ConsistentRead(ctx))
+}
+
+// getUser reads a user that has not been deleted
+func (d DynamoRepo) getUser(ctx context.Context, userID string, consistentRead bool) (*user.User, error) {
+	u, err := d.getStoredUser(ctx, userID, consistentRead)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.IsDeleted() {
+		return nil, notFound(userID)
+	}
+
+	return u, nil
+}
+
+// getStoredUser reads a user whether or not it has been deleted
+func (d DynamoRepo) getStoredUser(ctx context.Context, userID string, consistentRead bool) (*user.User, error) {
+	// Email reservations share the table with users but are never users themselves
+	if isReservationKey(userID) {
+		return nil, notFound(userID)
+	}
+
+	input := &dynamodb.GetItemInput{
 		Key: map[string]*dynamodb.AttributeValue{
 			"ID": {
 				S: aws.String(userID),
 			},
 		},
 		TableName: &d.tableName,
-	})
+	}
+	if consistentRead {
+		input.ConsistentRead = aws.Bool(true)
+	}
+
+	response, err := d.client.GetItemWithContext(ctx, input)
 	if err != nil {
-		return nil, err
+		return nil, translateError(ctx, err)
 	}
 
 	if response.Item == nil {
-		// We don't return an error in this case b/c it is not
-		// an error specific to querying DynamoDB.
-		// That will be handled at a higher level.
-		return nil, nil
+		return nil, notFound(userID)
 	}
 
 	var result *user.User
@@ -40,8 +68,39 @@ func (d DynamoRepo) GetUser(ctx context.Context, userID string) (*user.User, err
 	return result, nil
 }
 
+// GetUserByEmail finds a user by email regardless of case. The owning user is
+// looked up through its email reservation. Users created before reservations
+// existed are found through the email index instead, which only matches the
+// exact address that was stored.
 func (d DynamoRepo) GetUserByEmail(ctx context.Context, email string) (*user.User, error) {
-	response, err := d.client.Query(&dynamodb.QueryInput{
+	response, err := d.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(emailReservationKey(email)),
+			},
+		},
+		TableName: &d.tableName,
+	})
+	if err != nil {
+		return nil, translateError(ctx, err)
+	}
+
+	if response.Item != nil {
+		var reservation emailReservation
+
+		err = dynamodbattribute.UnmarshalMap(response.Item, &reservation)
+		if err != nil {
+			return nil, err
+		}
+
+		return d.GetUser(ctx, reservation.UserID)
+	}
+
+	return d.getUserByEmailIndex(ctx, email)
+}
+
+func (d DynamoRepo) getUserByEmailIndex(ctx context.Context, email string) (*user.User, error) {
+	response, err := d.client.QueryWithContext(ctx, &dynamodb.QueryInput{
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
 			":email": {
 				S: aws.String(email),
@@ -52,20 +111,23 @@ func (d DynamoRepo) GetUserByEmail(ctx context.Context, email string) (*user.Use
 		TableName:              &d.tableName,
 	})
 	if err != nil {
-		return nil, err
+		return nil, translateError(ctx, err)
 	}
 
 	if len(response.Items) == 0 {
-		return nil, nil
+		// Emails are PII, so keep them out of errors that may be logged
+		return nil, fmt.Errorf("%w: no user has that email", repo.ErrNotFound)
 	}
 
-	var result *user.User
-
-	err = dynamodbattribute.UnmarshalMap(response.Items[0], &result)
+	// The email index only projects keys, so fetch the full user from the table
+	var key struct {
+		ID string
+	}
 
+	err = dynamodbattribute.UnmarshalMap(response.Items[0], &key)
 	if err != nil {
 		return nil, err
 	}
 
-	return result, nil
+	return d.GetUser(ctx, key.ID)
 }
@@ -0,0 +1,279 @@
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/crestenstclair/crud/internal/history"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/repo/cursor"
+	"github.com/crestenstclair/crud/internal/user"
+)
+
+// errHistoryDisabled is returned when history is read without a history table
+// to read it from
+var errHistoryDisabled = errors.New("history is not recorded without a history table")
+
+// withHistory appends the write recording the change of before into after to
+// items, so the history record is written in the same transaction as the
+// change itself. items is returned as it is when history is not recorded.
+func (d DynamoRepo) withHistory(ctx context.Context, items []*dynamodb.TransactWriteItem, op history.Operation, before *user.User, after user.User) ([]*dynamodb.TransactWriteItem, error) {
+	if d.historyTable == "" {
+		return items, nil
+	}
+
+	av, err := dynamodbattribute.MarshalMap(history.New(ctx, op, before, after))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(items, &dynamodb.TransactWriteItem{
+		Put: &dynamodb.Put{
+			TableName: &d.historyTable,
+			Item:      av,
+			// Records are never overwritten. Versions only ever increase, so
+			// this can only fail if the write to the user fails too.
+			ConditionExpression: aws.String("attribute_not_exists(Version)"),
+		},
+	}), nil
+}
+
+func (d DynamoRepo) ListUserHistory(ctx context.Context, userID string, opts repo.ListOptions) (repo.HistoryPage, error) {
+	if opts.Limit < 1 {
+		return repo.HistoryPage{}, fmt.Errorf("list limit must be positive, got %d", opts.Limit)
+	}
+
+	if d.historyTable == "" {
+		return repo.HistoryPage{}, errHistoryDisabled
+	}
+
+	var startKey map[string]*dynamodb.AttributeValue
+	if opts.Cursor != "" {
+		if err := d.cursors.Decode(opts.Cursor, &startKey); err != nil {
+			return repo.HistoryPage{}, err
+		}
+
+		// A cursor for another user's history would fail the query
+		if id := startKey["UserID"]; id == nil || aws.StringValue(id.S) != userID {
+			return repo.HistoryPage{}, fmt.Errorf("%w: cursor is for another user", cursor.ErrInvalid)
+		}
+	}
+
+	response, err := d.client.QueryWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              &d.historyTable,
+		KeyConditionExpression: aws.String("UserID = :userID"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":userID": {
+				S: aws.String(userID),
+			},
+		},
+		ScanIndexForward:  aws.Bool(false),
+		Limit:             aws.Int64(int64(opts.Limit)),
+		ExclusiveStartKey: startKey,
+	})
+	if err != nil {
+		return repo.HistoryPage{}, translateError(ctx, err)
+	}
+
+	records := []history.Record{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(response.Items, &records); err != nil {
+		return repo.HistoryPage{}, err
+	}
+
+	// Users written before history was recorded have none, so an empty
+	// history only means the user does not exist when it is not stored either
+	if len(records) == 0 && opts.Cursor == "" {
+		if _, err := d.getStoredUser(ctx, userID, false); err != nil {
+			return repo.HistoryPage{}, err
+		}
+	}
+
+	page := repo.HistoryPage{
+		Records: records,
+	}
+
+	if len(response.LastEvaluatedKey) > 0 {
+		next, err := d.cursors.Encode(response.LastEvaluatedKey)
+		if err != nil {
+			return repo.HistoryPage{}, err
+		}
+		page.NextCursor = next
+	}
+
+	return page, nil
+}
+
+// GetUserAsOf pages through the user's history from the newest record until
+// it finds one written at or before asOf, whose snapshot is the user as it was
+// then.
+func (d DynamoRepo) GetUserAsOf(ctx context.Context, userID string, asOf time.Time) (*user.User, error) {
+	if d.historyTable == "" {
+		return nil, errHistoryDisabled
+	}
+
+	var startKey map[string]*dynamodb.AttributeValue
+	for {
+		response, err := d.client.QueryWithContext(ctx, &dynamodb.QueryInput{
+			TableName:              &d.historyTable,
+			KeyConditionExpression: aws.String("UserID = :userID"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":userID": {
+					S: aws.String(userID),
+				},
+			},
+			ScanIndexForward:  aws.Bool(false),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, translateError(ctx, err)
+		}
+
+		records := []history.Record{}
+		if err := dynamodbattribute.UnmarshalListOfMaps(response.Items, &records); err != nil {
+			return nil, err
+		}
+
+		for _, record := range records {
+			at, err := record.At()
+			if err != nil {
+				return nil, err
+			}
+			if at.After(asOf) {
+				continue
+			}
+			if record.User == nil || record.User.IsDeleted() {
+				return nil, notFound(userID)
+			}
+			return record.User, nil
+		}
+
+		if len(response.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = response.LastEvaluatedKey
+	}
+
+	// Users written before history was recorded have no record of their
+	// earlier states, but are known to have been as they are now if they have
+	// not been written since asOf
+	u, err := d.getUser(ctx, userID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	lastModified, err := time.Parse(time.RFC3339, u.LastModified)
+	if err != nil || lastModified.After(asOf) {
+		return nil, notFound(userID)
+	}
+
+	return u, nil
+}
+
+// getHistoryRecord reads the record of the write that made version of the
+// user. nil is returned when there is none.
+func (d DynamoRepo) getHistoryRecord(ctx context.Context, userID string, version int64) (*history.Record, error) {
+	response, err := d.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"UserID": {
+				S: aws.String(userID),
+			},
+			"Version": {
+				N: aws.String(strconv.FormatInt(version, 10)),
+			},
+		},
+		TableName: &d.historyTable,
+	})
+	if err != nil {
+		return nil, translateError(ctx, err)
+	}
+
+	if response.Item == nil {
+		return nil, nil
+	}
+
+	var record *history.Record
+
+	err = dynamodbattribute.UnmarshalMap(response.Item, &record)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// unscrubbedHistory reads the records of the user's history that still hold
+// its details. None are returned when history is not recorded.
+func (d DynamoRepo) unscrubbedHistory(ctx context.Context, userID string) ([]history.Record, error) {
+	if d.historyTable == "" {
+		return nil, nil
+	}
+
+	var result []history.Record
+	var startKey map[string]*dynamodb.AttributeValue
+	for {
+		response, err := d.client.QueryWithContext(ctx, &dynamodb.QueryInput{
+			TableName:              &d.historyTable,
+			KeyConditionExpression: aws.String("UserID = :userID"),
+			FilterExpression:       aws.String("attribute_not_exists(Scrubbed)"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":userID": {
+					S: aws.String(userID),
+				},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, translateError(ctx, err)
+		}
+
+		records := []history.Record{}
+		if err := dynamodbattribute.UnmarshalListOfMaps(response.Items, &records); err != nil {
+			return nil, err
+		}
+		result = append(result, records...)
+
+		if len(response.LastEvaluatedKey) == 0 {
+			return result, nil
+		}
+		startKey = response.LastEvaluatedKey
+	}
+}
+
+// scrubItem writes the scrubbed record over the one it was made from. Only
+// the purge's IAM role may update records.
+func (d DynamoRepo) scrubItem(record history.Record) (*dynamodb.TransactWriteItem, error) {
+	changes, err := dynamodbattribute.Marshal(record.Changes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			TableName: &d.historyTable,
+			Key: map[string]*dynamodb.AttributeValue{
+				"UserID": {
+					S: aws.String(record.UserID),
+				},
+				"Version": {
+					N: aws.String(strconv.FormatInt(record.Version, 10)),
+				},
+			},
+			UpdateExpression: aws.String("SET Changes = :changes, Scrubbed = :scrubbed REMOVE #user"),
+			// USER is a reserved word
+			ExpressionAttributeNames: map[string]*string{
+				"#user": aws.String("User"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":changes":  changes,
+				":scrubbed": {BOOL: aws.Bool(true)},
+			},
+		},
+	}, nil
+}
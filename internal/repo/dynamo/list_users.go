@@ -0,0 +1,70 @@
+package dynamo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/user"
+)
+
+func (d DynamoRepo) ListUsers(ctx context.Context, opts repo.ListOptions) (repo.Page, error) {
+	if opts.Limit < 1 {
+		return repo.Page{}, fmt.Errorf("list limit must be positive, got %d", opts.Limit)
+	}
+
+	var startKey map[string]*dynamodb.AttributeValue
+	if opts.Cursor != "" {
+		if err := d.cursors.Decode(opts.Cursor, &startKey); err != nil {
+			return repo.Page{}, err
+		}
+	}
+
+	users := []user.User{}
+
+	// Scan applies its limit before the filter drops email reservations and
+	// deleted users, so keep scanning until the page is full or the table is
+	// exhausted.
+	for {
+		response, err := d.client.ScanWithContext(ctx, &dynamodb.ScanInput{
+			TableName:         &d.tableName,
+			Limit:             aws.Int64(int64(opts.Limit - len(users))),
+			ExclusiveStartKey: startKey,
+			FilterExpression:  aws.String("attribute_exists(Email) AND attribute_not_exists(DeletedAt)"),
+		})
+		if err != nil {
+			return repo.Page{}, translateError(ctx, err)
+		}
+
+		var items []user.User
+
+		err = dynamodbattribute.UnmarshalListOfMaps(response.Items, &items)
+		if err != nil {
+			return repo.Page{}, err
+		}
+
+		users = append(users, items...)
+		startKey = response.LastEvaluatedKey
+
+		if len(startKey) == 0 || len(users) >= opts.Limit {
+			break
+		}
+	}
+
+	page := repo.Page{
+		Users: users,
+	}
+
+	if len(startKey) > 0 {
+		next, err := d.cursors.Encode(startKey)
+		if err != nil {
+			return repo.Page{}, err
+		}
+		page.NextCursor = next
+	}
+
+	return page, nil
+}
@@ -0,0 +1,63 @@
+package dynamo
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/crestenstclair/crud/internal/history"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/user"
+)
+
+func (d DynamoRepo) PatchUser(ctx context.Context, userID string, changes repo.UserChanges, expectedVersion int64) (*user.User, error) {
+	existingUser, err := d.getUser(ctx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkExpectedVersion(existingUser.Version, expectedVersion); err != nil {
+		return nil, err
+	}
+
+	updated := changes.Apply(*existingUser)
+	updated.LastModified = time.Now().Format(time.RFC3339)
+	updated.Version = existingUser.Version + 1
+
+	av, err := dynamodbattribute.MarshalMap(updated)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the changed attributes are written, along with the bookkeeping
+	// attributes every write updates
+	written := map[string]*dynamodb.AttributeValue{
+		"LastModified": av["LastModified"],
+		"Version":      av["Version"],
+	}
+	for _, name := range changedAttributes(changes) {
+		written[name] = av[name]
+	}
+
+	return d.writeUpdate(ctx, history.Update, existingUser, updated, written)
+}
+
+func changedAttributes(changes repo.UserChanges) []string {
+	var names []string
+
+	if changes.FirstName != nil {
+		names = append(names, "FirstName")
+	}
+	if changes.LastName != nil {
+		names = append(names, "LastName")
+	}
+	if changes.Email != nil {
+		names = append(names, "Email")
+	}
+	if changes.DOB != nil {
+		names = append(names, "DOB")
+	}
+
+	return names
+}
@@ -0,0 +1,167 @@
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/crestenstclair/crud/internal/history"
+	"github.com/crestenstclair/crud/internal/user"
+)
+
+// PurgeDeletedUsers scans the whole table, so it is meant to be run in the
+// background rather than while handling a request
+func (d DynamoRepo) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int, error) {
+	purged := 0
+
+	var startKey map[string]*dynamodb.AttributeValue
+	for {
+		response, err := d.client.ScanWithContext(ctx, &dynamodb.ScanInput{
+			TableName:            &d.tableName,
+			ExclusiveStartKey:    startKey,
+			FilterExpression:     aws.String("DeletedAt < :deletedBefore"),
+			ProjectionExpression: aws.String("ID, Email, DeletedAt"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":deletedBefore": {
+					S: aws.String(deletedBefore.UTC().Format(time.RFC3339)),
+				},
+			},
+		})
+		if err != nil {
+			return purged, translateError(ctx, err)
+		}
+
+		var users []user.User
+		if err := dynamodbattribute.UnmarshalListOfMaps(response.Items, &users); err != nil {
+			return purged, err
+		}
+
+		for _, u := range users {
+			removed, err := d.purgeUser(ctx, u)
+			if removed {
+				purged++
+			}
+			if err != nil {
+				return purged, err
+			}
+		}
+
+		startKey = response.LastEvaluatedKey
+		if len(startKey) == 0 {
+			return purged, nil
+		}
+	}
+}
+
+// maxTransactItems is the most items DynamoDB accepts in one transaction
+const maxTransactItems = 100
+
+// purgeUser removes a deleted user and its email reservation, and scrubs its
+// details from its history. It returns false when the user was restored since
+// it was scanned.
+func (d DynamoRepo) purgeUser(ctx context.Context, u user.User) (bool, error) {
+	records, err := d.unscrubbedHistory(ctx, u.ID)
+	if err != nil {
+		return false, err
+	}
+
+	// History is scrubbed in transactions that only apply while the user is
+	// still deleted, and the last of them removes the user, so a user restored
+	// since the scan keeps its history. Only a restore made between batches of
+	// a very long history can leave part of it scrubbed.
+	key := map[string]*dynamodb.AttributeValue{
+		"ID": {
+			S: aws.String(u.ID),
+		},
+	}
+	condition := aws.String("DeletedAt = :deletedAt")
+	values := map[string]*dynamodb.AttributeValue{
+		":deletedAt": {
+			S: aws.String(u.DeletedAt),
+		},
+	}
+
+	for len(records) >= maxTransactItems {
+		batch := records[:maxTransactItems-1]
+		records = records[len(batch):]
+
+		stillDeleted := &dynamodb.TransactWriteItem{
+			ConditionCheck: &dynamodb.ConditionCheck{
+				TableName:                 &d.tableName,
+				Key:                       key,
+				ConditionExpression:       condition,
+				ExpressionAttributeValues: values,
+			},
+		}
+		if applied, err := d.scrubBatch(ctx, batch, stillDeleted); !applied || err != nil {
+			return false, err
+		}
+	}
+
+	remove := &dynamodb.TransactWriteItem{
+		Delete: &dynamodb.Delete{
+			TableName:                 &d.tableName,
+			Key:                       key,
+			ConditionExpression:       condition,
+			ExpressionAttributeValues: values,
+		},
+	}
+	if applied, err := d.scrubBatch(ctx, records, remove); !applied || err != nil {
+		return false, err
+	}
+
+	// The reservation is only removed while it is still the user's, since
+	// another user may have claimed the email after the hold. A reservation
+	// left behind is released, so it does no harm.
+	_, err = d.client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName:           &d.tableName,
+		ConditionExpression: aws.String("UserID = :userID"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":userID": {
+				S: aws.String(u.ID),
+			},
+		},
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(emailReservationKey(u.Email)),
+			},
+		},
+	})
+	if errors.As(err, new(*dynamodb.ConditionalCheckFailedException)) {
+		return true, nil
+	}
+	if err != nil {
+		return true, translateError(ctx, err)
+	}
+
+	return true, nil
+}
+
+// scrubBatch scrubs records in a single transaction with target, which checks
+// or deletes the user. It returns false when target's condition failed.
+func (d DynamoRepo) scrubBatch(ctx context.Context, records []history.Record, target *dynamodb.TransactWriteItem) (bool, error) {
+	items := make([]*dynamodb.TransactWriteItem, 0, len(records)+1)
+	for _, record := range records {
+		item, err := d.scrubItem(record.Scrub())
+		if err != nil {
+			return false, err
+		}
+		items = append(items, item)
+	}
+	items = append(items, target)
+
+	_, err := d.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	if conditionFailedAt(err, len(items)-1) {
+		return false, nil
+	}
+	if err != nil {
+		return false, translateError(ctx, err)
+	}
+
+	return true, nil
+}
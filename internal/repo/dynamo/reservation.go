@@ -0,0 +1,126 @@
+package dynamo
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Email uniqueness is enforced with reservation items stored in the user table
+// alongside the users themselves. Each reservation is keyed by the email it
+// holds, so claiming an email is a conditional put that DynamoDB evaluates
+// atomically with the write to the owning user inside a transaction.
+//
+// Deleting a user keeps its reservation until ReleaseAt, in epoch seconds, so
+// the email cannot be taken while the user may be restored. Released
+// reservations can be claimed by any user.
+const emailReservationPrefix = "email#"
+
+type emailReservation struct {
+	ID        string
+	UserID    string
+	ReleaseAt int64 `dynamodbav:",omitempty"`
+}
+
+// emailReservationKey normalizes case so that addresses differing only in case
+// are treated as the same email.
+func emailReservationKey(email string) string {
+	return emailReservationPrefix + strings.ToLower(email)
+}
+
+func isReservationKey(id string) bool {
+	return strings.HasPrefix(id, emailReservationPrefix)
+}
+
+func epochSeconds(t time.Time) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(t.Unix(), 10))}
+}
+
+func (d DynamoRepo) reserveEmail(email string, userID string) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Put: &dynamodb.Put{
+			TableName:           &d.tableName,
+			ConditionExpression: aws.String("attribute_not_exists(ID) OR ReleaseAt <= :now"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":now": epochSeconds(time.Now()),
+			},
+			Item: map[string]*dynamodb.AttributeValue{
+				"ID": {
+					S: aws.String(emailReservationKey(email)),
+				},
+				"UserID": {
+					S: aws.String(userID),
+				},
+			},
+		},
+	}
+}
+
+func (d DynamoRepo) releaseEmail(email string, userID string) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Delete: &dynamodb.Delete{
+			TableName: &d.tableName,
+			// Users created before reservations existed have nothing to release
+			ConditionExpression: aws.String("attribute_not_exists(ID) OR UserID = :userID"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":userID": {
+					S: aws.String(userID),
+				},
+			},
+			Key: map[string]*dynamodb.AttributeValue{
+				"ID": {
+					S: aws.String(emailReservationKey(email)),
+				},
+			},
+		},
+	}
+}
+
+// holdEmail keeps a deleted user's reservation until releaseAt. Users created
+// before reservations existed are given one.
+func (d DynamoRepo) holdEmail(email string, userID string, releaseAt time.Time) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			TableName:           &d.tableName,
+			ConditionExpression: aws.String("attribute_not_exists(ID) OR UserID = :userID"),
+			UpdateExpression:    aws.String("SET UserID = :userID, ReleaseAt = :releaseAt"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":userID": {
+					S: aws.String(userID),
+				},
+				":releaseAt": epochSeconds(releaseAt),
+			},
+			Key: map[string]*dynamodb.AttributeValue{
+				"ID": {
+					S: aws.String(emailReservationKey(email)),
+				},
+			},
+		},
+	}
+}
+
+// reclaimEmail takes back the reservation of a user being restored, provided
+// no other user has claimed the email since it was released
+func (d DynamoRepo) reclaimEmail(email string, userID string) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			TableName:           &d.tableName,
+			ConditionExpression: aws.String("attribute_not_exists(ID) OR UserID = :userID OR ReleaseAt <= :now"),
+			UpdateExpression:    aws.String("SET UserID = :userID REMOVE ReleaseAt"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":userID": {
+					S: aws.String(userID),
+				},
+				":now": epochSeconds(time.Now()),
+			},
+			Key: map[string]*dynamodb.AttributeValue{
+				"ID": {
+					S: aws.String(emailReservationKey(email)),
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,94 @@
+package dynamo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/crestenstclair/crud/internal/history"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/user"
+)
+
+func (d DynamoRepo) RestoreUser(ctx context.Context, userID string, expectedVersion int64) (*user.User, error) {
+	existingUser, err := d.getStoredUser(ctx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkExpectedVersion(existingUser.Version, expectedVersion); err != nil {
+		return nil, err
+	}
+
+	if !existingUser.IsDeleted() {
+		return existingUser, nil
+	}
+
+	restored := *existingUser
+	restored.DeletedAt = ""
+	restored.LastModified = time.Now().Format(time.RFC3339)
+	restored.Version = existingUser.Version + 1
+
+	expressionValues := map[string]*dynamodb.AttributeValue{
+		":deletedAt": {
+			S: aws.String(existingUser.DeletedAt),
+		},
+		":lastModified": {
+			S: aws.String(restored.LastModified),
+		},
+		":version": {
+			N: aws.String(fmt.Sprint(restored.Version)),
+		},
+	}
+	conditionExpression := fmt.Sprintf(
+		"DeletedAt = :deletedAt AND %s",
+		versionCondition(existingUser.Version, expressionValues),
+	)
+
+	// The email is taken back in the same transaction, which fails if another
+	// user claimed it after the hold
+	items, err := d.withHistory(ctx, []*dynamodb.TransactWriteItem{
+		{
+			Update: &dynamodb.Update{
+				TableName:                           &d.tableName,
+				ConditionExpression:                 aws.String(conditionExpression),
+				UpdateExpression:                    aws.String("SET LastModified = :lastModified, Version = :version REMOVE DeletedAt"),
+				ExpressionAttributeValues:           expressionValues,
+				ReturnValuesOnConditionCheckFailure: aws.String("ALL_OLD"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"ID": {
+						S: aws.String(userID),
+					},
+				},
+			},
+		},
+		d.reclaimEmail(existingUser.Email, userID),
+	}, history.Restore, existingUser, restored)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = d.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+
+	if conditionFailedAt(err, 1) {
+		return nil, &repo.ErrUnique{Field: "email"}
+	}
+
+	// The user was purged, or changed by another request, since it was read
+	if reason := failedCondition(err, 0); reason != nil {
+		if reason.Item == nil {
+			return nil, notFound(userID)
+		}
+		return nil, fmt.Errorf("%w: %s was modified by another request", repo.ErrConflict, userID)
+	}
+
+	if err != nil {
+		return nil, translateError(ctx, err)
+	}
+
+	return &restored, nil
+}
@@ -0,0 +1,65 @@
+package dynamo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/crestenstclair/crud/internal/history"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/user"
+)
+
+// RevertUser writes the fields of version of the user, as snapshotted in its
+// history, as a new version. The write goes through writeUpdate, so it fails
+// like any other update when the user has changed since it was read or the
+// earlier email has since been taken.
+func (d DynamoRepo) RevertUser(ctx context.Context, userID string, version int64, expectedVersion int64) (*user.User, error) {
+	if d.historyTable == "" {
+		return nil, errHistoryDisabled
+	}
+
+	existingUser, err := d.getUser(ctx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkExpectedVersion(existingUser.Version, expectedVersion); err != nil {
+		return nil, err
+	}
+
+	record, err := d.getHistoryRecord(ctx, userID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if record == nil || record.User == nil {
+		return nil, fmt.Errorf("%w: %s has no version %d", repo.ErrVersionNotFound, userID, version)
+	}
+
+	reverted := *existingUser
+	reverted.FirstName = record.User.FirstName
+	reverted.LastName = record.User.LastName
+	reverted.Email = record.User.Email
+	reverted.DOB = record.User.DOB
+	reverted.LastModified = time.Now().Format(time.RFC3339)
+	reverted.Version = existingUser.Version + 1
+
+	av, err := dynamodbattribute.MarshalMap(reverted)
+	if err != nil {
+		return nil, err
+	}
+
+	written := map[string]*dynamodb.AttributeValue{
+		"FirstName":    av["FirstName"],
+		"LastName":     av["LastName"],
+		"Email":        av["Email"],
+		"DOB":          av["DOB"],
+		"LastModified": av["LastModified"],
+		"Version":      av["Version"],
+	}
+
+	return d.writeUpdate(ctx, history.Revert, existingUser, reverted, written)
+}
@@ -0,0 +1,222 @@
+package dynamo
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/crestenstclair/crud/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedClient records a span for each DynamoDB call, carrying the table,
+// the operation and the capacity it consumed. Only the calls the repo makes
+// are traced.
+type tracedClient struct {
+	dynamodbiface.DynamoDBAPI
+}
+
+// NewTracedClient wraps client so each call the repo makes to it is traced
+func NewTracedClient(client dynamodbiface.DynamoDBAPI) dynamodbiface.DynamoDBAPI {
+	return &tracedClient{client}
+}
+
+func (c *tracedClient) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+	ctx, span := startSpan(ctx, "GetItem", aws.StringValue(input.TableName))
+	if span.IsRecording() && input.ReturnConsumedCapacity == nil {
+		in := *input
+		in.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
+		input = &in
+	}
+
+	output, err := c.DynamoDBAPI.GetItemWithContext(ctx, input, opts...)
+	if output != nil {
+		endSpan(span, err, output.ConsumedCapacity)
+	} else {
+		endSpan(span, err)
+	}
+
+	return output, err
+}
+
+func (c *tracedClient) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error) {
+	ctx, span := startSpan(ctx, "Query", aws.StringValue(input.TableName))
+	if span.IsRecording() && input.ReturnConsumedCapacity == nil {
+		in := *input
+		in.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
+		input = &in
+	}
+
+	output, err := c.DynamoDBAPI.QueryWithContext(ctx, input, opts...)
+	if output != nil {
+		endSpan(span, err, output.ConsumedCapacity)
+	} else {
+		endSpan(span, err)
+	}
+
+	return output, err
+}
+
+func (c *tracedClient) ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, opts ...request.Option) (*dynamodb.ScanOutput, error) {
+	ctx, span := startSpan(ctx, "Scan", aws.StringValue(input.TableName))
+	if span.IsRecording() && input.ReturnConsumedCapacity == nil {
+		in := *input
+		in.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
+		input = &in
+	}
+
+	output, err := c.DynamoDBAPI.ScanWithContext(ctx, input, opts...)
+	if output != nil {
+		endSpan(span, err, output.ConsumedCapacity)
+	} else {
+		endSpan(span, err)
+	}
+
+	return output, err
+}
+
+func (c *tracedClient) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+	ctx, span := startSpan(ctx, "PutItem", aws.StringValue(input.TableName))
+	if span.IsRecording() && input.ReturnConsumedCapacity == nil {
+		in := *input
+		in.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
+		input = &in
+	}
+
+	output, err := c.DynamoDBAPI.PutItemWithContext(ctx, input, opts...)
+	if output != nil {
+		endSpan(span, err, output.ConsumedCapacity)
+	} else {
+		endSpan(span, err)
+	}
+
+	return output, err
+}
+
+func (c *tracedClient) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	ctx, span := startSpan(ctx, "UpdateItem", aws.StringValue(input.TableName))
+	if span.IsRecording() && input.ReturnConsumedCapacity == nil {
+		in := *input
+		in.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
+		input = &in
+	}
+
+	output, err := c.DynamoDBAPI.UpdateItemWithContext(ctx, input, opts...)
+	if output != nil {
+		endSpan(span, err, output.ConsumedCapacity)
+	} else {
+		endSpan(span, err)
+	}
+
+	return output, err
+}
+
+func (c *tracedClient) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, opts ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	ctx, span := startSpan(ctx, "DeleteItem", aws.StringValue(input.TableName))
+	if span.IsRecording() && input.ReturnConsumedCapacity == nil {
+		in := *input
+		in.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
+		input = &in
+	}
+
+	output, err := c.DynamoDBAPI.DeleteItemWithContext(ctx, input, opts...)
+	if output != nil {
+		endSpan(span, err, output.ConsumedCapacity)
+	} else {
+		endSpan(span, err)
+	}
+
+	return output, err
+}
+
+func (c *tracedClient) TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	ctx, span := startSpan(ctx, "TransactWriteItems", transactTableNames(input.TransactItems)...)
+	if span.IsRecording() && input.ReturnConsumedCapacity == nil {
+		in := *input
+		in.ReturnConsumedCapacity = aws.String(dynamodb.ReturnConsumedCapacityTotal)
+		input = &in
+	}
+
+	output, err := c.DynamoDBAPI.TransactWriteItemsWithContext(ctx, input, opts...)
+	if output != nil {
+		endSpan(span, err, output.ConsumedCapacity...)
+	} else {
+		endSpan(span, err)
+	}
+
+	return output, err
+}
+
+func startSpan(ctx context.Context, operation string, tableNames ...string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "DynamoDB."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.RPCSystemKey.String("aws-api"),
+			semconv.RPCService("DynamoDB"),
+			semconv.RPCMethod(operation),
+			semconv.DBSystemDynamoDB,
+			semconv.DBOperation(operation),
+			semconv.AWSDynamoDBTableNames(tableNames...),
+		),
+	)
+}
+
+func endSpan(span trace.Span, err error, consumed ...*dynamodb.ConsumedCapacity) {
+	defer span.End()
+
+	capacities := make([]string, 0, len(consumed))
+	var units float64
+	for _, c := range consumed {
+		if c == nil {
+			continue
+		}
+		encoded, _ := json.Marshal(c)
+		capacities = append(capacities, string(encoded))
+		units += aws.Float64Value(c.CapacityUnits)
+	}
+	if len(capacities) > 0 {
+		span.SetAttributes(
+			semconv.AWSDynamoDBConsumedCapacity(capacities...),
+			attribute.Float64("aws.dynamodb.consumed_capacity_units", units),
+		)
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// transactTableNames lists each table a transaction writes to once
+func transactTableNames(items []*dynamodb.TransactWriteItem) []string {
+	seen := map[string]bool{}
+	names := []string{}
+
+	add := func(name *string) {
+		if name != nil && !seen[*name] {
+			seen[*name] = true
+			names = append(names, *name)
+		}
+	}
+
+	for _, item := range items {
+		switch {
+		case item.Put != nil:
+			add(item.Put.TableName)
+		case item.Update != nil:
+			add(item.Update.TableName)
+		case item.Delete != nil:
+			add(item.Delete.TableName)
+		case item.ConditionCheck != nil:
+			add(item.ConditionCheck.TableName)
+		}
+	}
+
+	return names
+}
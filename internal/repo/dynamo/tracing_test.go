@@ -0,0 +1,114 @@
+package dynamo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/crestenstclair/crud/internal/repo/dynamo"
+	"github.com/crestenstclair/crud/internal/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+
+	return recorder
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attributes := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attributes[kv.Key] = kv.Value
+	}
+
+	return attributes
+}
+
+func TestTracedClient(t *testing.T) {
+	t.Run("Records a span with the table, operation and consumed capacity", func(t *testing.T) {
+		recorder := recordSpans(t)
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", dynamo.NewTracedClient(client), []byte("secret"))
+
+		output := fullUserItem()
+		output.ConsumedCapacity = &dynamodb.ConsumedCapacity{
+			TableName:     aws.String("tableName"),
+			CapacityUnits: aws.Float64(0.5),
+		}
+		client.On("GetItemWithContext", mock.Anything, mock.MatchedBy(func(input *dynamodb.GetItemInput) bool {
+			return aws.StringValue(input.ReturnConsumedCapacity) == dynamodb.ReturnConsumedCapacityTotal
+		})).Return(output, nil)
+
+		_, err := repo.GetUser(context.Background(), userID)
+		assert.NoError(t, err)
+
+		spans := recorder.Ended()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, "DynamoDB.GetItem", spans[0].Name())
+
+		attributes := spanAttributes(spans[0])
+		assert.Equal(t, "GetItem", attributes["db.operation"].AsString())
+		assert.Equal(t, "dynamodb", attributes["db.system"].AsString())
+		assert.Equal(t, []string{"tableName"}, attributes["aws.dynamodb.table_names"].AsStringSlice())
+		assert.Equal(t, 0.5, attributes["aws.dynamodb.consumed_capacity_units"].AsFloat64())
+		assert.Len(t, attributes["aws.dynamodb.consumed_capacity"].AsStringSlice(), 1)
+	})
+
+	t.Run("Marks the span as failed when the call fails", func(t *testing.T) {
+		recorder := recordSpans(t)
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", dynamo.NewTracedClient(client), []byte("secret"))
+
+		client.On("GetItemWithContext", mock.Anything, mock.Anything).Return(nil, errors.New("test error"))
+
+		_, err := repo.GetUser(context.Background(), userID)
+		assert.Error(t, err)
+
+		spans := recorder.Ended()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, codes.Error, spans[0].Status().Code)
+		assert.Equal(t, "test error", spans[0].Status().Description)
+	})
+
+	t.Run("Lists every table a transaction writes to", func(t *testing.T) {
+		recorder := recordSpans(t)
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", dynamo.NewTracedClient(client), []byte("secret"))
+
+		client.On("TransactWriteItemsWithContext", mock.Anything, mock.Anything).Return(nil, nil)
+
+		_, err := repo.CreateUser(context.Background(), user.User{ID: userID, Email: email})
+		assert.NoError(t, err)
+
+		spans := recorder.Ended()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, "DynamoDB.TransactWriteItems", spans[0].Name())
+		assert.Equal(t, []string{"tableName"}, spanAttributes(spans[0])["aws.dynamodb.table_names"].AsStringSlice())
+	})
+
+	t.Run("Leaves requests untouched when tracing is off", func(t *testing.T) {
+		client := &DynamodbMockClient{}
+		repo, _ := dynamo.New("tableName", dynamo.NewTracedClient(client), []byte("secret"))
+
+		client.On("GetItemWithContext", mock.Anything, mock.MatchedBy(func(input *dynamodb.GetItemInput) bool {
+			return input.ReturnConsumedCapacity == nil
+		})).Return(fullUserItem(), nil)
+
+		_, err := repo.GetUser(context.Background(), userID)
+		assert.NoError(t, err)
+	})
+}
@@ -2,29 +2,31 @@ package dynamo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/crestenstclair/crud/internal/history"
+	"github.com/crestenstclair/crud/internal/repo"
 	"github.com/crestenstclair/crud/internal/user"
 )
 
-func (d DynamoRepo) UpdateUser(ctx context.Context, u user.User) (*user.User, error) {
-	existingUser, err := d.GetUserByEmail(ctx, u.Email)
+func (d DynamoRepo) UpdateUser(ctx context.Context, u user.User, expectedVersion int64) (*user.User, error) {
+	existingUser, err := d.getUser(ctx, u.ID, true)
 	if err != nil {
 		return nil, err
 	}
 
-	if existingUser != nil && existingUser.ID != u.ID {
-		return nil, &UniqueConstraintViolation{
-			Message: "User email update failed. Attempted to change email to existing users email.",
-		}
+	if err := checkExpectedVersion(existingUser.Version, expectedVersion); err != nil {
+		return nil, err
 	}
 
 	// Update last modified to right now
 	u.LastModified = time.Now().Format(time.RFC3339)
+	u.Version = existingUser.Version + 1
 
 	// Marshal into map to avoid a bunch of boilerplate
 	av, err := dynamodbattribute.MarshalMap(u)
@@ -36,9 +38,27 @@ func (d DynamoRepo) UpdateUser(ctx context.Context, u user.User) (*user.User, er
 	delete(av, "CreatedAt")
 	delete(av, "ID")
 
+	// Transactions cannot return the updated item, so it is rebuilt from what
+	// was written
+	u.CreatedAt = existingUser.CreatedAt
+
+	return d.writeUpdate(ctx, history.Update, existingUser, u, av)
+}
+
+// writeUpdate sets the attributes in av on the user read as existingUser,
+// provided it has not changed since. updated is the user as it will be after
+// the write, and is used to move the email reservation when the email changes.
+// The write is recorded in the user's history as op.
+func (d DynamoRepo) writeUpdate(ctx context.Context, op history.Operation, existingUser *user.User, updated user.User, av map[string]*dynamodb.AttributeValue) (*user.User, error) {
 	// Initialize update expression in order to ensure CreatedAt is preserved between updates
 	updateExpression := "set CreatedAt = CreatedAt"
-	expressionValues := map[string]*dynamodb.AttributeValue{}
+	expressionValues := map[string]*dynamodb.AttributeValue{
+		// The email reservations below are only correct if the stored email
+		// has not changed since it was read
+		":expectedEmail": {
+			S: aws.String(existingUser.Email),
+		},
+	}
 
 	// Populate expression and value map with escaped "expressionvalue" keys
 	for k, v := range av {
@@ -47,30 +67,91 @@ func (d DynamoRepo) UpdateUser(ctx context.Context, u user.User) (*user.User, er
 		expressionValues[key] = v
 	}
 
-	response, err := d.client.UpdateItem(&dynamodb.UpdateItemInput{
-		Key: map[string]*dynamodb.AttributeValue{
-			"ID": {
-				S: aws.String(u.ID),
+	key := map[string]*dynamodb.AttributeValue{
+		"ID": {
+			S: aws.String(existingUser.ID),
+		},
+	}
+	conditionExpression := aws.String(fmt.Sprintf(
+		"attribute_exists(ID) AND attribute_not_exists(DeletedAt) AND Email = :expectedEmail AND %s",
+		versionCondition(existingUser.Version, expressionValues),
+	))
+
+	items := []*dynamodb.TransactWriteItem{
+		{
+			Update: &dynamodb.Update{
+				Key:                                 key,
+				TableName:                           &d.tableName,
+				ConditionExpression:                 conditionExpression,
+				UpdateExpression:                    aws.String(updateExpression),
+				ExpressionAttributeValues:           expressionValues,
+				ReturnValuesOnConditionCheckFailure: aws.String("ALL_OLD"),
 			},
 		},
-		TableName:                 &d.tableName,
-		ConditionExpression:       aws.String("attribute_exists(ID)"),
-		UpdateExpression:          aws.String(updateExpression),
-		ExpressionAttributeValues: expressionValues,
-		ReturnValues:              aws.String("ALL_NEW"),
-	})
+	}
 
+	// Reservations are case insensitive, so only a change to a different address
+	// needs to move the reservation. Changing email claims the new address and
+	// releases the old one atomically with the update itself.
+	emailChanged := emailReservationKey(existingUser.Email) != emailReservationKey(updated.Email)
+	if emailChanged {
+		items = append(items,
+			d.reserveEmail(updated.Email, existingUser.ID),
+			d.releaseEmail(existingUser.Email, existingUser.ID),
+		)
+	}
+
+	items, err := d.withHistory(ctx, items, op, existingUser, updated)
 	if err != nil {
 		return nil, err
 	}
 
-	var result *user.User
+	if len(items) == 1 {
+		response, err := d.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			Key:                                 key,
+			TableName:                           &d.tableName,
+			ConditionExpression:                 conditionExpression,
+			UpdateExpression:                    aws.String(updateExpression),
+			ExpressionAttributeValues:           expressionValues,
+			ReturnValues:                        aws.String("ALL_NEW"),
+			ReturnValuesOnConditionCheckFailure: aws.String("ALL_OLD"),
+		})
+
+		var failed *dynamodb.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			return nil, conflictOrNotFound(existingUser.ID, failed.Item)
+		}
+
+		if err != nil {
+			return nil, translateError(ctx, err)
+		}
+
+		var result *user.User
+
+		err = dynamodbattribute.UnmarshalMap(response.Attributes, &result)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return result, nil
+	}
+
+	_, err = d.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
 
-	err = dynamodbattribute.UnmarshalMap(response.Attributes, &result)
+	if emailChanged && conditionFailedAt(err, 1) {
+		return nil, &repo.ErrUnique{Field: "email"}
+	}
+
+	if reason := failedCondition(err, 0); reason != nil {
+		return nil, conflictOrNotFound(existingUser.ID, reason.Item)
+	}
 
 	if err != nil {
-		return nil, err
+		return nil, translateError(ctx, err)
 	}
 
-	return result, nil
+	return &updated, nil
 }
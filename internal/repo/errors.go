@@ -0,0 +1,34 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Every backend translates its failures into the errors below, so callers can
+// handle them without knowing which backend is in use. Backends wrap these
+// with detail, so compare them using errors.Is and errors.As.
+var (
+	// ErrNotFound is returned when the user does not exist
+	ErrNotFound = errors.New("user not found")
+	// ErrConflict is returned when the user changed concurrently, or did not
+	// match the version the caller expected
+	ErrConflict = errors.New("user was modified concurrently")
+	// ErrThrottled is returned when the backend is rejecting requests due to load
+	ErrThrottled = errors.New("request throttled by backend")
+	// ErrUnavailable is returned when the backend is failing or unreachable
+	ErrUnavailable = errors.New("backend unavailable")
+	// ErrVersionNotFound is returned when the user's history has no snapshot
+	// of the version asked for
+	ErrVersionNotFound = errors.New("version not found in user history")
+)
+
+// ErrUnique is returned when a write would give a user the same value as
+// another user for a field that must be unique
+type ErrUnique struct {
+	Field string
+}
+
+func (e *ErrUnique) Error() string {
+	return fmt.Sprintf("%s already in use by another user", e.Field)
+}
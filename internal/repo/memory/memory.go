@@ -0,0 +1,449 @@
+package memory
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crestenstclair/crud/internal/history"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/repo/cursor"
+	"github.com/crestenstclair/crud/internal/user"
+)
+
+// MemoryRepo is an in-process implementation of repo.Repo intended for local
+// development and tests. It mirrors the behavior of dynamo.DynamoRepo,
+// including the errors it returns, so handlers behave the same against either.
+type MemoryRepo struct {
+	mu        sync.RWMutex
+	users     map[string]user.User
+	history   map[string][]history.Record
+	cursors   *cursor.Codec
+	emailHold time.Duration
+}
+
+// Option configures a MemoryRepo
+type Option func(*MemoryRepo)
+
+// WithEmailHold keeps the email of a deleted user from being taken by another
+// user for hold, like dynamo.WithEmailHold
+func WithEmailHold(hold time.Duration) Option {
+	return func(m *MemoryRepo) {
+		m.emailHold = hold
+	}
+}
+
+func New(opts ...Option) (*MemoryRepo, error) {
+	// Cursors only need to be valid for as long as the data they point into
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	cursors, err := cursor.New(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &MemoryRepo{
+		users:   map[string]user.User{},
+		history: map[string][]history.Record{},
+		cursors: cursors,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m, nil
+}
+
+func (m *MemoryRepo) GetUser(ctx context.Context, userID string) (*user.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	u, ok := m.users[userID]
+	if !ok || u.IsDeleted() {
+		return nil, notFound(userID)
+	}
+
+	return &u, nil
+}
+
+// GetUserAsOf finds the newest history record written at or before asOf
+func (m *MemoryRepo) GetUserAsOf(ctx context.Context, userID string, asOf time.Time) (*user.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	records := m.history[userID]
+	for i := len(records) - 1; i >= 0; i-- {
+		at, err := records[i].At()
+		if err != nil {
+			return nil, err
+		}
+		if at.After(asOf) {
+			continue
+		}
+		if records[i].User == nil || records[i].User.IsDeleted() {
+			return nil, notFound(userID)
+		}
+		u := *records[i].User
+		return &u, nil
+	}
+
+	return nil, notFound(userID)
+}
+
+func (m *MemoryRepo) GetUserByEmail(ctx context.Context, email string) (*user.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	u := m.findByEmail(email)
+	if u == nil || u.IsDeleted() {
+		return nil, fmt.Errorf("%w: no user has that email", repo.ErrNotFound)
+	}
+
+	return u, nil
+}
+
+func (m *MemoryRepo) CreateUser(ctx context.Context, u user.User) (*user.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findByEmail(u.Email) != nil {
+		return nil, &repo.ErrUnique{Field: "email"}
+	}
+
+	if _, ok := m.users[u.ID]; ok {
+		return nil, fmt.Errorf("%w: user %s already exists", repo.ErrConflict, u.ID)
+	}
+
+	u.Version = 1
+	m.users[u.ID] = u
+	m.record(ctx, history.Create, nil, u)
+
+	return &u, nil
+}
+
+func (m *MemoryRepo) UpdateUser(ctx context.Context, u user.User, expectedVersion int64) (*user.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[u.ID]
+	if !ok || stored.IsDeleted() {
+		return nil, notFound(u.ID)
+	}
+
+	if err := checkExpectedVersion(stored.Version, expectedVersion); err != nil {
+		return nil, err
+	}
+
+	existingUser := m.findByEmail(u.Email)
+	if existingUser != nil && existingUser.ID != u.ID {
+		return nil, &repo.ErrUnique{Field: "email"}
+	}
+
+	// CreatedAt is preserved between updates, matching the DynamoDB update expression
+	u.CreatedAt = stored.CreatedAt
+	u.LastModified = time.Now().Format(time.RFC3339)
+	u.Version = stored.Version + 1
+
+	m.users[u.ID] = u
+	m.record(ctx, history.Update, &stored, u)
+
+	return &u, nil
+}
+
+func (m *MemoryRepo) PatchUser(ctx context.Context, userID string, changes repo.UserChanges, expectedVersion int64) (*user.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[userID]
+	if !ok || stored.IsDeleted() {
+		return nil, notFound(userID)
+	}
+
+	if err := checkExpectedVersion(stored.Version, expectedVersion); err != nil {
+		return nil, err
+	}
+
+	if changes.Email != nil {
+		existingUser := m.findByEmail(*changes.Email)
+		if existingUser != nil && existingUser.ID != userID {
+			return nil, &repo.ErrUnique{Field: "email"}
+		}
+	}
+
+	u := changes.Apply(stored)
+	u.LastModified = time.Now().Format(time.RFC3339)
+	u.Version = stored.Version + 1
+
+	m.users[userID] = u
+	m.record(ctx, history.Update, &stored, u)
+
+	return &u, nil
+}
+
+func (m *MemoryRepo) RevertUser(ctx context.Context, userID string, version int64, expectedVersion int64) (*user.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[userID]
+	if !ok || stored.IsDeleted() {
+		return nil, notFound(userID)
+	}
+
+	if err := checkExpectedVersion(stored.Version, expectedVersion); err != nil {
+		return nil, err
+	}
+
+	var target *user.User
+	for _, r := range m.history[userID] {
+		if r.Version == version {
+			target = r.User
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("%w: %s has no version %d", repo.ErrVersionNotFound, userID, version)
+	}
+
+	existingUser := m.findByEmail(target.Email)
+	if existingUser != nil && existingUser.ID != userID {
+		return nil, &repo.ErrUnique{Field: "email"}
+	}
+
+	u := stored
+	u.FirstName = target.FirstName
+	u.LastName = target.LastName
+	u.Email = target.Email
+	u.DOB = target.DOB
+	u.LastModified = time.Now().Format(time.RFC3339)
+	u.Version = stored.Version + 1
+
+	m.users[userID] = u
+	m.record(ctx, history.Revert, &stored, u)
+
+	return &u, nil
+}
+
+// DeleteUser marks the user deleted, keeping it to be restored or purged
+func (m *MemoryRepo) DeleteUser(ctx context.Context, userID string, expectedVersion int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[userID]
+	if !ok || stored.IsDeleted() {
+		return notFound(userID)
+	}
+
+	if err := checkExpectedVersion(stored.Version, expectedVersion); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	deleted := stored
+	deleted.DeletedAt = now.UTC().Format(time.RFC3339)
+	deleted.LastModified = now.Format(time.RFC3339)
+	deleted.Version++
+	m.users[userID] = deleted
+	m.record(ctx, history.Delete, &stored, deleted)
+
+	return nil
+}
+
+func (m *MemoryRepo) RestoreUser(ctx context.Context, userID string, expectedVersion int64) (*user.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.users[userID]
+	if !ok {
+		return nil, notFound(userID)
+	}
+
+	if err := checkExpectedVersion(stored.Version, expectedVersion); err != nil {
+		return nil, err
+	}
+
+	if !stored.IsDeleted() {
+		return &stored, nil
+	}
+
+	holder := m.findByEmail(stored.Email)
+	if holder != nil && holder.ID != userID {
+		return nil, &repo.ErrUnique{Field: "email"}
+	}
+
+	restored := stored
+	restored.DeletedAt = ""
+	restored.LastModified = time.Now().Format(time.RFC3339)
+	restored.Version++
+	m.users[userID] = restored
+	m.record(ctx, history.Restore, &stored, restored)
+
+	return &restored, nil
+}
+
+func (m *MemoryRepo) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := 0
+	for id, u := range m.users {
+		if u.IsDeleted() && deletedAt(u).Before(deletedBefore) {
+			delete(m.users, id)
+			for i, record := range m.history[id] {
+				m.history[id][i] = record.Scrub()
+			}
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// ListUsers pages through users ordered by ID
+func (m *MemoryRepo) ListUsers(ctx context.Context, opts repo.ListOptions) (repo.Page, error) {
+	if opts.Limit < 1 {
+		return repo.Page{}, fmt.Errorf("list limit must be positive, got %d", opts.Limit)
+	}
+
+	var after string
+	if opts.Cursor != "" {
+		if err := m.cursors.Decode(opts.Cursor, &after); err != nil {
+			return repo.Page{}, err
+		}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]string, 0, len(m.users))
+	for id, u := range m.users {
+		if id > after && !u.IsDeleted() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	page := repo.Page{
+		Users: []user.User{},
+	}
+
+	for _, id := range ids {
+		if len(page.Users) == opts.Limit {
+			next, err := m.cursors.Encode(page.Users[len(page.Users)-1].ID)
+			if err != nil {
+				return repo.Page{}, err
+			}
+			page.NextCursor = next
+			break
+		}
+		page.Users = append(page.Users, m.users[id])
+	}
+
+	return page, nil
+}
+
+// historyCursor is where a page of history ends
+type historyCursor struct {
+	UserID  string
+	Version int64
+}
+
+func (m *MemoryRepo) ListUserHistory(ctx context.Context, userID string, opts repo.ListOptions) (repo.HistoryPage, error) {
+	if opts.Limit < 1 {
+		return repo.HistoryPage{}, fmt.Errorf("list limit must be positive, got %d", opts.Limit)
+	}
+
+	var before historyCursor
+	if opts.Cursor != "" {
+		if err := m.cursors.Decode(opts.Cursor, &before); err != nil {
+			return repo.HistoryPage{}, err
+		}
+		if before.UserID != userID {
+			return repo.HistoryPage{}, fmt.Errorf("%w: cursor is for another user", cursor.ErrInvalid)
+		}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	records := m.history[userID]
+	if len(records) == 0 {
+		if _, ok := m.users[userID]; !ok {
+			return repo.HistoryPage{}, notFound(userID)
+		}
+	}
+
+	page := repo.HistoryPage{
+		Records: []history.Record{},
+	}
+
+	// Records are appended in version order, so they are walked backwards to
+	// list the newest first
+	for i := len(records) - 1; i >= 0; i-- {
+		if opts.Cursor != "" && records[i].Version >= before.Version {
+			continue
+		}
+		if len(page.Records) == opts.Limit {
+			last := page.Records[len(page.Records)-1]
+			next, err := m.cursors.Encode(historyCursor{UserID: userID, Version: last.Version})
+			if err != nil {
+				return repo.HistoryPage{}, err
+			}
+			page.NextCursor = next
+			break
+		}
+		page.Records = append(page.Records, records[i])
+	}
+
+	return page, nil
+}
+
+// record appends the change of before into after to the user's history. It
+// must be called with m.mu held.
+func (m *MemoryRepo) record(ctx context.Context, op history.Operation, before *user.User, after user.User) {
+	m.history[after.ID] = append(m.history[after.ID], history.New(ctx, op, before, after))
+}
+
+// findByEmail returns the user holding email, which is either a user that has
+// not been deleted or one whose email hold has not ended. It must be called
+// with m.mu held. Emails are matched case insensitively, like the
+// reservations used by the DynamoDB repo.
+func (m *MemoryRepo) findByEmail(email string) *user.User {
+	now := time.Now()
+
+	for _, u := range m.users {
+		if !strings.EqualFold(u.Email, email) {
+			continue
+		}
+		if u.IsDeleted() && !now.Before(deletedAt(u).Add(m.emailHold)) {
+			continue
+		}
+		return &u
+	}
+
+	return nil
+}
+
+// deletedAt parses when u was deleted. DeletedAt is only ever written by the
+// repo, so it always parses.
+func deletedAt(u user.User) time.Time {
+	t, _ := time.Parse(time.RFC3339, u.DeletedAt)
+	return t
+}
+
+func notFound(userID string) error {
+	return fmt.Errorf("%w: %s", repo.ErrNotFound, userID)
+}
+
+func checkExpectedVersion(stored int64, expected int64) error {
+	if expected == repo.AnyVersion || stored == expected {
+		return nil
+	}
+
+	return fmt.Errorf("%w: expected version %d, found %d", repo.ErrConflict, expected, stored)
+}
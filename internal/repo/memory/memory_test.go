@@ -0,0 +1,572 @@
+package memory_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/crestenstclair/crud/internal/history"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/repo/cursor"
+	"github.com/crestenstclair/crud/internal/repo/memory"
+	"github.com/crestenstclair/crud/internal/user"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// Ensure the in-memory repo stays in sync with the interface
+var _ repo.Repo = &memory.MemoryRepo{}
+
+func makeTestUser() user.User {
+	testTime := "1979-12-09T00:00:00Z"
+	return user.User{
+		ID:           uuid.NewString(),
+		FirstName:    "firstName",
+		LastName:     "lastName",
+		Email:        "example@example.com",
+		DOB:          testTime,
+		CreatedAt:    testTime,
+		LastModified: testTime,
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	t.Run("Returns ErrNotFound when user is not found", func(t *testing.T) {
+		r, _ := memory.New()
+
+		res, err := r.GetUser(context.Background(), "missing")
+
+		assert.ErrorIs(t, err, repo.ErrNotFound)
+		assert.Nil(t, res)
+	})
+
+	t.Run("Returns a copy of the stored user", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		testUser := makeTestUser()
+		created, err := r.CreateUser(ctx, testUser)
+		assert.NoError(t, err)
+
+		res, err := r.GetUser(ctx, testUser.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, *created, *res)
+
+		res.FirstName = "changed"
+		again, _ := r.GetUser(ctx, testUser.ID)
+		assert.Equal(t, testUser.FirstName, again.FirstName)
+	})
+}
+
+func TestGetUserByEmail(t *testing.T) {
+	t.Run("Matches email case insensitively", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		testUser := makeTestUser()
+		_, _ = r.CreateUser(ctx, testUser)
+
+		res, err := r.GetUserByEmail(ctx, "EXAMPLE@example.com")
+
+		assert.NoError(t, err)
+		assert.Equal(t, testUser.ID, res.ID)
+	})
+
+	t.Run("Returns ErrNotFound when no user has the email", func(t *testing.T) {
+		r, _ := memory.New()
+
+		res, err := r.GetUserByEmail(context.Background(), "missing@example.com")
+
+		assert.ErrorIs(t, err, repo.ErrNotFound)
+		assert.Nil(t, res)
+	})
+}
+
+func TestCreateUser(t *testing.T) {
+	t.Run("Returns ErrUnique when email is in use", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		_, err := r.CreateUser(ctx, makeTestUser())
+		assert.NoError(t, err)
+
+		_, err = r.CreateUser(ctx, makeTestUser())
+
+		var unique *repo.ErrUnique
+		assert.ErrorAs(t, err, &unique)
+		assert.Equal(t, "email", unique.Field)
+	})
+
+	t.Run("Allows exactly one of many concurrent creates with the same email", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		successes := 0
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := r.CreateUser(ctx, makeTestUser()); err == nil {
+					mu.Lock()
+					successes++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 1, successes)
+	})
+}
+
+func TestUpdateUser(t *testing.T) {
+	t.Run("Returns ErrNotFound when user does not exist", func(t *testing.T) {
+		r, _ := memory.New()
+
+		_, err := r.UpdateUser(context.Background(), makeTestUser(), repo.AnyVersion)
+
+		assert.ErrorIs(t, err, repo.ErrNotFound)
+	})
+
+	t.Run("Returns ErrNotFound rather than ErrUnique when user does not exist and email is taken", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		_, err := r.CreateUser(ctx, makeTestUser())
+		assert.NoError(t, err)
+
+		_, err = r.UpdateUser(ctx, makeTestUser(), repo.AnyVersion)
+
+		assert.ErrorIs(t, err, repo.ErrNotFound)
+	})
+
+	t.Run("Preserves CreatedAt and refreshes LastModified", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		testUser := makeTestUser()
+		_, err := r.CreateUser(ctx, testUser)
+		assert.NoError(t, err)
+
+		update := testUser
+		update.FirstName = "Wilma"
+		update.CreatedAt = "2000-01-01T00:00:00Z"
+		result, err := r.UpdateUser(ctx, update, repo.AnyVersion)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), result.Version)
+		assert.Equal(t, "Wilma", result.FirstName)
+		assert.Equal(t, testUser.CreatedAt, result.CreatedAt)
+		assert.NotEqual(t, testUser.LastModified, result.LastModified)
+	})
+
+	t.Run("Properly detects when a user's email is taken", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		first := makeTestUser()
+		second := makeTestUser()
+		second.Email = "other@example.com"
+		_, _ = r.CreateUser(ctx, first)
+		_, _ = r.CreateUser(ctx, second)
+
+		second.Email = first.Email
+		_, err := r.UpdateUser(ctx, second, repo.AnyVersion)
+
+		var unique *repo.ErrUnique
+		assert.ErrorAs(t, err, &unique)
+		assert.Equal(t, "email", unique.Field)
+	})
+
+	t.Run("Returns ErrConflict when expected version is stale", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		testUser := makeTestUser()
+		_, _ = r.CreateUser(ctx, testUser)
+		_, err := r.UpdateUser(ctx, testUser, 1)
+		assert.NoError(t, err)
+
+		_, err = r.UpdateUser(ctx, testUser, 1)
+
+		assert.ErrorIs(t, err, repo.ErrConflict)
+	})
+}
+
+func TestPatchUser(t *testing.T) {
+	t.Run("Returns ErrNotFound when user does not exist", func(t *testing.T) {
+		r, _ := memory.New()
+		lastName := "Rubble"
+
+		_, err := r.PatchUser(context.Background(), "missing", repo.UserChanges{LastName: &lastName}, repo.AnyVersion)
+
+		assert.ErrorIs(t, err, repo.ErrNotFound)
+	})
+
+	t.Run("Changes only the given attributes", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		testUser := makeTestUser()
+		_, _ = r.CreateUser(ctx, testUser)
+		lastName := "Rubble"
+
+		result, err := r.PatchUser(ctx, testUser.ID, repo.UserChanges{LastName: &lastName}, 1)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Rubble", result.LastName)
+		assert.Equal(t, testUser.FirstName, result.FirstName)
+		assert.Equal(t, testUser.Email, result.Email)
+		assert.Equal(t, int64(2), result.Version)
+	})
+
+	t.Run("Properly detects when a user's email is taken", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		first := makeTestUser()
+		second := makeTestUser()
+		second.Email = "other@example.com"
+		_, _ = r.CreateUser(ctx, first)
+		_, _ = r.CreateUser(ctx, second)
+
+		_, err := r.PatchUser(ctx, second.ID, repo.UserChanges{Email: &first.Email}, repo.AnyVersion)
+
+		var unique *repo.ErrUnique
+		assert.ErrorAs(t, err, &unique)
+	})
+}
+
+func TestDeleteUser(t *testing.T) {
+	t.Run("Returns ErrNotFound when user does not exist", func(t *testing.T) {
+		r, _ := memory.New()
+
+		err := r.DeleteUser(context.Background(), "missing", repo.AnyVersion)
+
+		assert.ErrorIs(t, err, repo.ErrNotFound)
+	})
+
+	t.Run("Hides the user", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		testUser := makeTestUser()
+		_, _ = r.CreateUser(ctx, testUser)
+
+		err := r.DeleteUser(ctx, testUser.ID, 2)
+		assert.ErrorIs(t, err, repo.ErrConflict)
+
+		err = r.DeleteUser(ctx, testUser.ID, 1)
+		assert.NoError(t, err)
+
+		res, err := r.GetUser(ctx, testUser.ID)
+		assert.ErrorIs(t, err, repo.ErrNotFound)
+		assert.Nil(t, res)
+	})
+}
+
+func TestSoftDelete(t *testing.T) {
+	t.Run("Hides deleted users from email lookups and listings", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		testUser := makeTestUser()
+		_, _ = r.CreateUser(ctx, testUser)
+		_ = r.DeleteUser(ctx, testUser.ID, repo.AnyVersion)
+
+		_, err := r.GetUserByEmail(ctx, testUser.Email)
+		assert.ErrorIs(t, err, repo.ErrNotFound)
+
+		page, err := r.ListUsers(ctx, repo.ListOptions{Limit: 10})
+		assert.NoError(t, err)
+		assert.Empty(t, page.Users)
+	})
+
+	t.Run("Holds a deleted user's email until the hold is over", func(t *testing.T) {
+		held, _ := memory.New(memory.WithEmailHold(time.Hour))
+		released, _ := memory.New()
+		ctx := context.Background()
+		for _, r := range []*memory.MemoryRepo{held, released} {
+			testUser := makeTestUser()
+			_, _ = r.CreateUser(ctx, testUser)
+			_ = r.DeleteUser(ctx, testUser.ID, repo.AnyVersion)
+		}
+
+		_, err := held.CreateUser(ctx, makeTestUser())
+		var unique *repo.ErrUnique
+		assert.ErrorAs(t, err, &unique)
+
+		_, err = released.CreateUser(ctx, makeTestUser())
+		assert.NoError(t, err)
+	})
+
+	t.Run("Restores a deleted user", func(t *testing.T) {
+		r, _ := memory.New(memory.WithEmailHold(time.Hour))
+		ctx := context.Background()
+		testUser := makeTestUser()
+		_, _ = r.CreateUser(ctx, testUser)
+		_ = r.DeleteUser(ctx, testUser.ID, repo.AnyVersion)
+
+		_, err := r.RestoreUser(ctx, testUser.ID, 1)
+		assert.ErrorIs(t, err, repo.ErrConflict)
+
+		restored, err := r.RestoreUser(ctx, testUser.ID, 2)
+		assert.NoError(t, err)
+		assert.False(t, restored.IsDeleted())
+		assert.Equal(t, int64(3), restored.Version)
+
+		res, err := r.GetUser(ctx, testUser.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, restored, res)
+	})
+
+	t.Run("Does not restore a user whose email was taken after the hold", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		testUser := makeTestUser()
+		_, _ = r.CreateUser(ctx, testUser)
+		_ = r.DeleteUser(ctx, testUser.ID, repo.AnyVersion)
+		_, _ = r.CreateUser(ctx, makeTestUser())
+
+		_, err := r.RestoreUser(ctx, testUser.ID, repo.AnyVersion)
+
+		var unique *repo.ErrUnique
+		assert.ErrorAs(t, err, &unique)
+	})
+
+	t.Run("Purges only users deleted before the cutoff", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		deleted := makeTestUser()
+		_, _ = r.CreateUser(ctx, deleted)
+		_ = r.DeleteUser(ctx, deleted.ID, repo.AnyVersion)
+		live := makeTestUser()
+		live.Email = "live@example.com"
+		_, _ = r.CreateUser(ctx, live)
+
+		purged, err := r.PurgeDeletedUsers(ctx, time.Now().Add(-time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, purged)
+
+		purged, err = r.PurgeDeletedUsers(ctx, time.Now().Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, purged)
+
+		_, err = r.RestoreUser(ctx, deleted.ID, repo.AnyVersion)
+		assert.ErrorIs(t, err, repo.ErrNotFound)
+		_, err = r.GetUser(ctx, live.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Scrubs the details of purged users from their history", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		testUser := makeTestUser()
+		_, _ = r.CreateUser(ctx, testUser)
+		_ = r.DeleteUser(ctx, testUser.ID, repo.AnyVersion)
+
+		_, err := r.PurgeDeletedUsers(ctx, time.Now().Add(time.Hour))
+		assert.NoError(t, err)
+
+		page, err := r.ListUserHistory(ctx, testUser.ID, repo.ListOptions{Limit: 10})
+		assert.NoError(t, err)
+		assert.Len(t, page.Records, 2)
+		for _, record := range page.Records {
+			assert.True(t, record.Scrubbed)
+			assert.Nil(t, record.User)
+			for _, change := range record.Changes {
+				assert.Empty(t, change.Before)
+				assert.Empty(t, change.After)
+			}
+		}
+	})
+}
+
+func TestListUserHistory(t *testing.T) {
+	t.Run("Records every write, newest first", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := history.WithActor(context.Background(), "fred")
+		testUser := makeTestUser()
+		_, _ = r.CreateUser(ctx, testUser)
+		lastName := "Rubble"
+		_, _ = r.PatchUser(ctx, testUser.ID, repo.UserChanges{LastName: &lastName}, repo.AnyVersion)
+		_ = r.DeleteUser(ctx, testUser.ID, repo.AnyVersion)
+		_, _ = r.RestoreUser(ctx, testUser.ID, repo.AnyVersion)
+
+		page, err := r.ListUserHistory(ctx, testUser.ID, repo.ListOptions{Limit: 10})
+
+		assert.NoError(t, err)
+		var operations []history.Operation
+		for _, record := range page.Records {
+			operations = append(operations, record.Operation)
+			assert.Equal(t, "fred", record.Actor)
+		}
+		assert.Equal(t, []history.Operation{history.Restore, history.Delete, history.Update, history.Create}, operations)
+		assert.Equal(t, []history.Change{{Field: "lastName", Before: "lastName", After: "Rubble"}}, page.Records[2].Changes)
+	})
+
+	t.Run("Pages through the history", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		testUser := makeTestUser()
+		_, _ = r.CreateUser(ctx, testUser)
+		for i := 0; i < 4; i++ {
+			_, _ = r.UpdateUser(ctx, testUser, repo.AnyVersion)
+		}
+
+		var versions []int64
+		opts := repo.ListOptions{Limit: 2}
+		for {
+			page, err := r.ListUserHistory(ctx, testUser.ID, opts)
+			assert.NoError(t, err)
+			for _, record := range page.Records {
+				versions = append(versions, record.Version)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			opts.Cursor = page.NextCursor
+		}
+
+		assert.Equal(t, []int64{5, 4, 3, 2, 1}, versions)
+
+		_, err := r.ListUserHistory(ctx, "other", opts)
+		assert.ErrorIs(t, err, cursor.ErrInvalid)
+	})
+
+	t.Run("Returns ErrNotFound when user does not exist", func(t *testing.T) {
+		r, _ := memory.New()
+
+		_, err := r.ListUserHistory(context.Background(), "missing", repo.ListOptions{Limit: 10})
+
+		assert.ErrorIs(t, err, repo.ErrNotFound)
+	})
+}
+
+func TestGetUserAsOf(t *testing.T) {
+	t.Run("Returns the user as it was at the time", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		testUser := makeTestUser()
+		_, _ = r.CreateUser(ctx, testUser)
+		lastName := "Rubble"
+		_, _ = r.PatchUser(ctx, testUser.ID, repo.UserChanges{LastName: &lastName}, repo.AnyVersion)
+
+		// The test user was created in 1979 and patched just now
+		then, err := r.GetUserAsOf(ctx, testUser.ID, time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+		assert.NoError(t, err)
+		assert.Equal(t, "lastName", then.LastName)
+		assert.Equal(t, int64(1), then.Version)
+
+		now, err := r.GetUserAsOf(ctx, testUser.ID, time.Now().Add(time.Minute))
+		assert.NoError(t, err)
+		assert.Equal(t, "Rubble", now.LastName)
+	})
+
+	t.Run("Returns ErrNotFound before the user was created or while it was deleted", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		testUser := makeTestUser()
+		_, _ = r.CreateUser(ctx, testUser)
+		_ = r.DeleteUser(ctx, testUser.ID, repo.AnyVersion)
+
+		_, err := r.GetUserAsOf(ctx, testUser.ID, time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC))
+		assert.ErrorIs(t, err, repo.ErrNotFound)
+
+		_, err = r.GetUserAsOf(ctx, testUser.ID, time.Now().Add(time.Minute))
+		assert.ErrorIs(t, err, repo.ErrNotFound)
+	})
+}
+
+func TestRevertUser(t *testing.T) {
+	t.Run("Writes the earlier version as a new version", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		testUser := makeTestUser()
+		_, _ = r.CreateUser(ctx, testUser)
+		lastName := "Rubble"
+		email := "barney@example.com"
+		_, _ = r.PatchUser(ctx, testUser.ID, repo.UserChanges{LastName: &lastName, Email: &email}, repo.AnyVersion)
+
+		res, err := r.RevertUser(ctx, testUser.ID, 1, 2)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "lastName", res.LastName)
+		assert.Equal(t, testUser.Email, res.Email)
+		assert.Equal(t, testUser.CreatedAt, res.CreatedAt)
+		assert.Equal(t, int64(3), res.Version)
+
+		page, _ := r.ListUserHistory(ctx, testUser.ID, repo.ListOptions{Limit: 1})
+		assert.Equal(t, history.Revert, page.Records[0].Operation)
+	})
+
+	t.Run("Returns ErrConflict when the user changed since the expected version", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		testUser := makeTestUser()
+		_, _ = r.CreateUser(ctx, testUser)
+		_, _ = r.UpdateUser(ctx, testUser, repo.AnyVersion)
+
+		_, err := r.RevertUser(ctx, testUser.ID, 1, 1)
+
+		assert.ErrorIs(t, err, repo.ErrConflict)
+	})
+
+	t.Run("Returns ErrVersionNotFound for versions the user never had", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		testUser := makeTestUser()
+		_, _ = r.CreateUser(ctx, testUser)
+
+		_, err := r.RevertUser(ctx, testUser.ID, 5, repo.AnyVersion)
+
+		assert.ErrorIs(t, err, repo.ErrVersionNotFound)
+	})
+
+	t.Run("Properly detects when the earlier email was taken", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		testUser := makeTestUser()
+		_, _ = r.CreateUser(ctx, testUser)
+		email := "barney@example.com"
+		_, _ = r.PatchUser(ctx, testUser.ID, repo.UserChanges{Email: &email}, repo.AnyVersion)
+		_, _ = r.CreateUser(ctx, makeTestUser())
+
+		_, err := r.RevertUser(ctx, testUser.ID, 1, repo.AnyVersion)
+
+		var unique *repo.ErrUnique
+		assert.ErrorAs(t, err, &unique)
+	})
+}
+
+func TestListUsers(t *testing.T) {
+	t.Run("Pages through every user exactly once", func(t *testing.T) {
+		r, _ := memory.New()
+		ctx := context.Background()
+		for i := 0; i < 5; i++ {
+			testUser := makeTestUser()
+			testUser.Email = testUser.ID + "@example.com"
+			_, _ = r.CreateUser(ctx, testUser)
+		}
+
+		seen := map[string]bool{}
+		opts := repo.ListOptions{Limit: 2}
+		pages := 0
+		for {
+			page, err := r.ListUsers(ctx, opts)
+			assert.NoError(t, err)
+			pages++
+			for _, u := range page.Users {
+				assert.False(t, seen[u.ID])
+				seen[u.ID] = true
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			opts.Cursor = page.NextCursor
+		}
+
+		assert.Len(t, seen, 5)
+		assert.Equal(t, 3, pages)
+	})
+
+	t.Run("Rejects forged cursors", func(t *testing.T) {
+		r, _ := memory.New()
+
+		_, err := r.ListUsers(context.Background(), repo.ListOptions{Limit: 1, Cursor: "forged.token"})
+
+		assert.ErrorIs(t, err, cursor.ErrInvalid)
+	})
+}
@@ -7,6 +7,10 @@ import (
 
 	mock "github.com/stretchr/testify/mock"
 
+	repo "github.com/crestenstclair/crud/internal/repo"
+
+	time "time"
+
 	user "github.com/crestenstclair/crud/internal/user"
 )
 
@@ -41,13 +45,13 @@ func (_m *Repo) CreateUser(_a0 context.Context, _a1 user.User) (*user.User, erro
 	return r0, r1
 }
 
-// DeleteUser provides a mock function with given fields: ctx, userID
-func (_m *Repo) DeleteUser(ctx context.Context, userID string) error {
-	ret := _m.Called(ctx, userID)
+// DeleteUser provides a mock function with given fields: ctx, userID, expectedVersion
+func (_m *Repo) DeleteUser(ctx context.Context, userID string, expectedVersion int64) error {
+	ret := _m.Called(ctx, userID, expectedVersion)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
-		r0 = rf(ctx, userID)
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) error); ok {
+		r0 = rf(ctx, userID, expectedVersion)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -81,25 +85,227 @@ func (_m *Repo) GetUser(_a0 context.Context, _a1 string) (*user.User, error) {
 	return r0, r1
 }
 
-// UpdateUser provides a mock function with given fields: _a0, _a1
-func (_m *Repo) UpdateUser(_a0 context.Context, _a1 user.User) (*user.User, error) {
-	ret := _m.Called(_a0, _a1)
+// UpdateUser provides a mock function with given fields: ctx, u, expectedVersion
+func (_m *Repo) UpdateUser(ctx context.Context, u user.User, expectedVersion int64) (*user.User, error) {
+	ret := _m.Called(ctx, u, expectedVersion)
 
 	var r0 *user.User
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, user.User) (*user.User, error)); ok {
-		return rf(_a0, _a1)
+	if rf, ok := ret.Get(0).(func(context.Context, user.User, int64) (*user.User, error)); ok {
+		return rf(ctx, u, expectedVersion)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, user.User) *user.User); ok {
-		r0 = rf(_a0, _a1)
+	if rf, ok := ret.Get(0).(func(context.Context, user.User, int64) *user.User); ok {
+		r0 = rf(ctx, u, expectedVersion)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*user.User)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, user.User) error); ok {
-		r1 = rf(_a0, _a1)
+	if rf, ok := ret.Get(1).(func(context.Context, user.User, int64) error); ok {
+		r1 = rf(ctx, u, expectedVersion)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PatchUser provides a mock function with given fields: ctx, userID, changes, expectedVersion
+func (_m *Repo) PatchUser(ctx context.Context, userID string, changes repo.UserChanges, expectedVersion int64) (*user.User, error) {
+	ret := _m.Called(ctx, userID, changes, expectedVersion)
+
+	var r0 *user.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, repo.UserChanges, int64) (*user.User, error)); ok {
+		return rf(ctx, userID, changes, expectedVersion)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, repo.UserChanges, int64) *user.User); ok {
+		r0 = rf(ctx, userID, changes, expectedVersion)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*user.User)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, repo.UserChanges, int64) error); ok {
+		r1 = rf(ctx, userID, changes, expectedVersion)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserAsOf provides a mock function with given fields: ctx, userID, asOf
+func (_m *Repo) GetUserAsOf(ctx context.Context, userID string, asOf time.Time) (*user.User, error) {
+	ret := _m.Called(ctx, userID, asOf)
+
+	var r0 *user.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) (*user.User, error)); ok {
+		return rf(ctx, userID, asOf)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) *user.User); ok {
+		r0 = rf(ctx, userID, asOf)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*user.User)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time) error); ok {
+		r1 = rf(ctx, userID, asOf)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserByEmail provides a mock function with given fields: ctx, email
+func (_m *Repo) GetUserByEmail(ctx context.Context, email string) (*user.User, error) {
+	ret := _m.Called(ctx, email)
+
+	var r0 *user.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (*user.User, error)); ok {
+		return rf(ctx, email)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) *user.User); ok {
+		r0 = rf(ctx, email)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*user.User)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, email)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListUserHistory provides a mock function with given fields: ctx, userID, opts
+func (_m *Repo) ListUserHistory(ctx context.Context, userID string, opts repo.ListOptions) (repo.HistoryPage, error) {
+	ret := _m.Called(ctx, userID, opts)
+
+	var r0 repo.HistoryPage
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, repo.ListOptions) (repo.HistoryPage, error)); ok {
+		return rf(ctx, userID, opts)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, repo.ListOptions) repo.HistoryPage); ok {
+		r0 = rf(ctx, userID, opts)
+	} else {
+		r0 = ret.Get(0).(repo.HistoryPage)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, repo.ListOptions) error); ok {
+		r1 = rf(ctx, userID, opts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListUsers provides a mock function with given fields: ctx, opts
+func (_m *Repo) ListUsers(ctx context.Context, opts repo.ListOptions) (repo.Page, error) {
+	ret := _m.Called(ctx, opts)
+
+	var r0 repo.Page
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, repo.ListOptions) (repo.Page, error)); ok {
+		return rf(ctx, opts)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, repo.ListOptions) repo.Page); ok {
+		r0 = rf(ctx, opts)
+	} else {
+		r0 = ret.Get(0).(repo.Page)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, repo.ListOptions) error); ok {
+		r1 = rf(ctx, opts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PurgeDeletedUsers provides a mock function with given fields: ctx, deletedBefore
+func (_m *Repo) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int, error) {
+	ret := _m.Called(ctx, deletedBefore)
+
+	var r0 int
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) (int, error)); ok {
+		return rf(ctx, deletedBefore)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) int); ok {
+		r0 = rf(ctx, deletedBefore)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, deletedBefore)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestoreUser provides a mock function with given fields: ctx, userID, expectedVersion
+func (_m *Repo) RestoreUser(ctx context.Context, userID string, expectedVersion int64) (*user.User, error) {
+	ret := _m.Called(ctx, userID, expectedVersion)
+
+	var r0 *user.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) (*user.User, error)); ok {
+		return rf(ctx, userID, expectedVersion)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) *user.User); ok {
+		r0 = rf(ctx, userID, expectedVersion)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*user.User)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64) error); ok {
+		r1 = rf(ctx, userID, expectedVersion)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RevertUser provides a mock function with given fields: ctx, userID, version, expectedVersion
+func (_m *Repo) RevertUser(ctx context.Context, userID string, version int64, expectedVersion int64) (*user.User, error) {
+	ret := _m.Called(ctx, userID, version, expectedVersion)
+
+	var r0 *user.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int64) (*user.User, error)); ok {
+		return rf(ctx, userID, version, expectedVersion)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int64) *user.User); ok {
+		r0 = rf(ctx, userID, version, expectedVersion)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*user.User)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64, int64) error); ok {
+		r1 = rf(ctx, userID, version, expectedVersion)
 	} else {
 		r1 = ret.Error(1)
 	}
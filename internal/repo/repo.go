@@ -2,14 +2,120 @@ package repo
 
 import (
 	"context"
+	"time"
 
+	"github.com/crestenstclair/crud/internal/history"
 	"github.com/crestenstclair/crud/internal/user"
 )
 
+// AnyVersion may be passed as the expected version to UpdateUser, PatchUser,
+// RevertUser and DeleteUser to skip the optimistic concurrency check. It is
+// not 0, since users written before versioning was introduced are at version
+// 0 and can be expected to still be.
+const AnyVersion int64 = -1
+
+type ListOptions struct {
+	// Limit is the maximum number of users to return in the page
+	Limit int
+	// Cursor resumes listing after the page that returned it
+	Cursor string
+}
+
+type Page struct {
+	Users []user.User
+	// NextCursor is empty when there are no more users to list
+	NextCursor string
+}
+
+// HistoryPage lists a user's history records, newest first
+type HistoryPage struct {
+	Records []history.Record
+	// NextCursor is empty when there are no older records
+	NextCursor string
+}
+
+// UserChanges lists the attributes PatchUser writes. Nil fields are left as
+// they are.
+type UserChanges struct {
+	FirstName *string
+	LastName  *string
+	Email     *string
+	DOB       *string
+}
+
+// IsEmpty reports whether the changes would leave a user untouched
+func (c UserChanges) IsEmpty() bool {
+	return c.FirstName == nil && c.LastName == nil && c.Email == nil && c.DOB == nil
+}
+
+// Apply returns u with the changes made to it
+func (c UserChanges) Apply(u user.User) user.User {
+	if c.FirstName != nil {
+		u.FirstName = *c.FirstName
+	}
+	if c.LastName != nil {
+		u.LastName = *c.LastName
+	}
+	if c.Email != nil {
+		u.Email = *c.Email
+	}
+	if c.DOB != nil {
+		u.DOB = *c.DOB
+	}
+
+	return u
+}
+
+type consistentReadKey struct{}
+
+// WithConsistentRead marks reads made with the returned context as needing
+// the user as last written, such as the read before a read-modify-write.
+// Caches pass these reads through to the store, which reads consistently.
+func WithConsistentRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, consistentReadKey{}, true)
+}
+
+// ConsistentRead reports whether ctx was made by WithConsistentRead
+func ConsistentRead(ctx context.Context) bool {
+	consistent, _ := ctx.Value(consistentReadKey{}).(bool)
+	return consistent
+}
+
+// Every write to a user is recorded in its history, in the same write as the
+// user itself, so a user cannot change without a record of it.
+//
+// Users are deleted softly. A deleted user is hidden from every method except
+// RestoreUser, and is kept until PurgeDeletedUsers removes it. Its email stays
+// in use by it for a while after it is deleted, so it can be restored.
+//
 //go:generate mockery --name Repo
 type Repo interface {
 	GetUser(context.Context, string) (*user.User, error)
-	DeleteUser(ctx context.Context, userID string) error
-	UpdateUser(context.Context, user.User) (*user.User, error)
+	// GetUserAsOf reads the user as it was at asOf from its history.
+	// ErrNotFound is returned when it did not exist or was deleted then.
+	GetUserAsOf(ctx context.Context, userID string, asOf time.Time) (*user.User, error)
+	// GetUserByEmail matches email case insensitively
+	GetUserByEmail(ctx context.Context, email string) (*user.User, error)
+	DeleteUser(ctx context.Context, userID string, expectedVersion int64) error
+	// RestoreUser undoes DeleteUser. Users that are not deleted are returned
+	// as they are. ErrUnique is returned when another user has taken the
+	// deleted user's email.
+	RestoreUser(ctx context.Context, userID string, expectedVersion int64) (*user.User, error)
+	// PurgeDeletedUsers permanently removes users deleted before
+	// deletedBefore, returning how many were removed
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int, error)
+	UpdateUser(ctx context.Context, u user.User, expectedVersion int64) (*user.User, error)
+	// RevertUser writes the fields of an earlier version of the user as a new
+	// version. ErrVersionNotFound is returned when the user's history has no
+	// such version, and ErrUnique when another user has taken its email.
+	RevertUser(ctx context.Context, userID string, version int64, expectedVersion int64) (*user.User, error)
+	// PatchUser writes only the attributes in changes, leaving the rest of the
+	// user as stored
+	PatchUser(ctx context.Context, userID string, changes UserChanges, expectedVersion int64) (*user.User, error)
 	CreateUser(context.Context, user.User) (*user.User, error)
+	ListUsers(ctx context.Context, opts ListOptions) (Page, error)
+	// ListUserHistory pages through the history of a user, including users
+	// that are deleted or purged. ErrNotFound is returned when the user has
+	// neither history nor a stored user.
+	ListUserHistory(ctx context.Context, userID string, opts ListOptions) (HistoryPage, error)
 }
@@ -0,0 +1,110 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/crestenstclair/crud/internal/logging"
+	"github.com/crestenstclair/crud/internal/repo"
+	"go.uber.org/zap"
+)
+
+// ErrCircuitOpen is returned without calling the backend while it is failing.
+// It wraps repo.ErrUnavailable, so callers treat it as any other outage.
+var ErrCircuitOpen = fmt.Errorf("%w: circuit breaker open", repo.ErrUnavailable)
+
+type breakerState int
+
+const (
+	closed breakerState = iota
+	// open rejects every call until the cooldown has passed
+	open
+	// halfOpen lets a single call through to find out if the backend recovered
+	halfOpen
+)
+
+// breaker opens after threshold consecutive transient failures. Once the
+// cooldown has passed one call is let through, which closes the breaker if it
+// succeeds and opens it again if it fails.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// newBreaker returns a breaker that never opens when threshold is zero
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// allow returns ErrCircuitOpen if the backend should not be called
+func (b *breaker) allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case open:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = halfOpen
+		b.probing = true
+	case halfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+
+	return nil
+}
+
+// record updates the breaker with the outcome of a call it allowed. Errors
+// other than transient ones mean the backend is working, as does success.
+func (b *breaker) record(ctx context.Context, err error) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case transient(err):
+		b.failures++
+		if b.state == halfOpen || (b.state == closed && b.failures >= b.threshold) {
+			logging.FromContext(ctx).Warn("Repo circuit breaker opened",
+				zap.Int("failures", b.failures), zap.Duration("cooldown", b.cooldown), zap.Error(err))
+			b.state = open
+			b.openedAt = b.now()
+			b.probing = false
+		}
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		// The caller gave up, which says nothing about the backend, so let
+		// another call find out whether it recovered
+		b.probing = false
+	case b.state == open:
+		// Calls allowed before the breaker opened are still finishing, and
+		// should not close it early
+	default:
+		if b.state == halfOpen {
+			logging.FromContext(ctx).Info("Repo circuit breaker closed")
+		}
+		b.state = closed
+		b.failures = 0
+		b.probing = false
+	}
+}
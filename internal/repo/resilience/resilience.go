@@ -0,0 +1,201 @@
+// Package resilience decorates a repo.Repo so transient backend failures are
+// retried, and a backend that keeps failing is given time to recover instead
+// of being sent more requests.
+package resilience
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/user"
+)
+
+type resilientRepo struct {
+	next        repo.Repo
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	breaker     *breaker
+	jitter      func(ceiling time.Duration) time.Duration
+}
+
+// Option configures the repo returned by WrapRepo
+type Option func(*resilientRepo)
+
+// WithJitter replaces how a backoff delay is picked from up to ceiling, which
+// is otherwise at random
+func WithJitter(jitter func(ceiling time.Duration) time.Duration) Option {
+	return func(r *resilientRepo) {
+		r.jitter = jitter
+	}
+}
+
+// WrapRepo retries operations on r that were throttled or hit an unavailable
+// backend, and fails fast with ErrCircuitOpen while r keeps failing. Retries
+// back off exponentially with jitter, and stop early rather than wait past the
+// context's deadline.
+//
+// Reads are retried on any transient failure. Writes are only retried when
+// throttled, since a write that failed with a 5xx may still have been applied.
+func WrapRepo(r repo.Repo, cfg *config.Config, opts ...Option) repo.Repo {
+	wrapped := &resilientRepo{
+		next:        r,
+		maxAttempts: cfg.RepoRetryMaxAttempts,
+		baseDelay:   time.Duration(cfg.RepoRetryBaseDelayMS) * time.Millisecond,
+		maxDelay:    time.Duration(cfg.RepoRetryMaxDelayMS) * time.Millisecond,
+		breaker: newBreaker(
+			cfg.RepoBreakerThreshold,
+			time.Duration(cfg.RepoBreakerCooldownMS)*time.Millisecond,
+		),
+		jitter: func(ceiling time.Duration) time.Duration {
+			return time.Duration(rand.Int63n(int64(ceiling) + 1))
+		},
+	}
+	for _, opt := range opts {
+		opt(wrapped)
+	}
+
+	return wrapped
+}
+
+// transient reports whether err may succeed if tried again
+func transient(err error) bool {
+	return errors.Is(err, repo.ErrThrottled) || errors.Is(err, repo.ErrUnavailable)
+}
+
+func throttled(err error) bool {
+	return errors.Is(err, repo.ErrThrottled)
+}
+
+// do calls fn until it succeeds, fails with an error retryable rejects, or
+// runs out of attempts or time
+func do[T any](ctx context.Context, r *resilientRepo, retryable func(error) bool, fn func() (T, error)) (T, error) {
+	for attempt := 1; ; attempt++ {
+		if err := r.breaker.allow(); err != nil {
+			var zero T
+			return zero, err
+		}
+
+		result, err := fn()
+		r.breaker.record(ctx, err)
+
+		if err == nil || attempt >= r.maxAttempts || !retryable(err) {
+			return result, err
+		}
+
+		if !wait(ctx, r.backoff(attempt)) {
+			return result, err
+		}
+	}
+}
+
+// backoff picks a delay at random up to an exponentially growing ceiling, so
+// callers that failed together do not retry together
+func (r *resilientRepo) backoff(attempt int) time.Duration {
+	ceiling := r.maxDelay
+	if shift := attempt - 1; shift < 32 && r.baseDelay<<shift < r.maxDelay {
+		ceiling = r.baseDelay << shift
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+
+	return r.jitter(ceiling)
+}
+
+// wait sleeps for d, returning false instead when ctx would end first
+func wait(ctx context.Context, d time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return false
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (r *resilientRepo) GetUser(ctx context.Context, userID string) (*user.User, error) {
+	return do(ctx, r, transient, func() (*user.User, error) {
+		return r.next.GetUser(ctx, userID)
+	})
+}
+
+func (r *resilientRepo) GetUserByEmail(ctx context.Context, email string) (*user.User, error) {
+	return do(ctx, r, transient, func() (*user.User, error) {
+		return r.next.GetUserByEmail(ctx, email)
+	})
+}
+
+func (r *resilientRepo) ListUsers(ctx context.Context, opts repo.ListOptions) (repo.Page, error) {
+	return do(ctx, r, transient, func() (repo.Page, error) {
+		return r.next.ListUsers(ctx, opts)
+	})
+}
+
+func (r *resilientRepo) ListUserHistory(ctx context.Context, userID string, opts repo.ListOptions) (repo.HistoryPage, error) {
+	return do(ctx, r, transient, func() (repo.HistoryPage, error) {
+		return r.next.ListUserHistory(ctx, userID, opts)
+	})
+}
+
+func (r *resilientRepo) GetUserAsOf(ctx context.Context, userID string, asOf time.Time) (*user.User, error) {
+	return do(ctx, r, transient, func() (*user.User, error) {
+		return r.next.GetUserAsOf(ctx, userID, asOf)
+	})
+}
+
+func (r *resilientRepo) CreateUser(ctx context.Context, u user.User) (*user.User, error) {
+	return do(ctx, r, throttled, func() (*user.User, error) {
+		return r.next.CreateUser(ctx, u)
+	})
+}
+
+func (r *resilientRepo) UpdateUser(ctx context.Context, u user.User, expectedVersion int64) (*user.User, error) {
+	return do(ctx, r, throttled, func() (*user.User, error) {
+		return r.next.UpdateUser(ctx, u, expectedVersion)
+	})
+}
+
+func (r *resilientRepo) PatchUser(ctx context.Context, userID string, changes repo.UserChanges, expectedVersion int64) (*user.User, error) {
+	return do(ctx, r, throttled, func() (*user.User, error) {
+		return r.next.PatchUser(ctx, userID, changes, expectedVersion)
+	})
+}
+
+func (r *resilientRepo) DeleteUser(ctx context.Context, userID string, expectedVersion int64) error {
+	_, err := do(ctx, r, throttled, func() (struct{}, error) {
+		return struct{}{}, r.next.DeleteUser(ctx, userID, expectedVersion)
+	})
+
+	return err
+}
+
+func (r *resilientRepo) RestoreUser(ctx context.Context, userID string, expectedVersion int64) (*user.User, error) {
+	return do(ctx, r, throttled, func() (*user.User, error) {
+		return r.next.RestoreUser(ctx, userID, expectedVersion)
+	})
+}
+
+func (r *resilientRepo) RevertUser(ctx context.Context, userID string, version int64, expectedVersion int64) (*user.User, error) {
+	return do(ctx, r, throttled, func() (*user.User, error) {
+		return r.next.RevertUser(ctx, userID, version, expectedVersion)
+	})
+}
+
+// PurgeDeletedUsers is not retried, since a purge that fails part way has
+// already removed some users and is run again on its next schedule anyway
+func (r *resilientRepo) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int, error) {
+	return do(ctx, r, func(error) bool { return false }, func() (int, error) {
+		return r.next.PurgeDeletedUsers(ctx, deletedBefore)
+	})
+}
@@ -0,0 +1,165 @@
+package resilience_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/repo"
+	"github.com/crestenstclair/crud/internal/repo/mocks"
+	"github.com/crestenstclair/crud/internal/repo/resilience"
+	"github.com/crestenstclair/crud/internal/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestConfig() *config.Config {
+	return &config.Config{
+		RepoRetryMaxAttempts: 3,
+		RepoRetryBaseDelayMS: 1,
+		RepoRetryMaxDelayMS:  5,
+	}
+}
+
+func TestRetry(t *testing.T) {
+	t.Run("Retries reads until they succeed", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(nil, repo.ErrThrottled).Once()
+		r.On("GetUser", mock.Anything, "123").Return(nil, repo.ErrUnavailable).Once()
+		r.On("GetUser", mock.Anything, "123").Return(&user.User{ID: "123"}, nil).Once()
+
+		u, err := resilience.WrapRepo(r, newTestConfig()).GetUser(context.Background(), "123")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "123", u.ID)
+	})
+
+	t.Run("Gives up after the configured attempts", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("ListUsers", mock.Anything, repo.ListOptions{Limit: 10}).Return(repo.Page{}, repo.ErrThrottled).Times(3)
+
+		_, err := resilience.WrapRepo(r, newTestConfig()).ListUsers(context.Background(), repo.ListOptions{Limit: 10})
+
+		assert.ErrorIs(t, err, repo.ErrThrottled)
+	})
+
+	t.Run("Does not retry errors that would fail again", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(nil, repo.ErrNotFound).Once()
+
+		_, err := resilience.WrapRepo(r, newTestConfig()).GetUser(context.Background(), "123")
+
+		assert.ErrorIs(t, err, repo.ErrNotFound)
+	})
+
+	t.Run("Retries writes only when throttled", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("DeleteUser", mock.Anything, "123", int64(1)).Return(repo.ErrThrottled).Once()
+		r.On("DeleteUser", mock.Anything, "123", int64(1)).Return(repo.ErrUnavailable).Once()
+
+		err := resilience.WrapRepo(r, newTestConfig()).DeleteUser(context.Background(), "123", 1)
+
+		assert.ErrorIs(t, err, repo.ErrUnavailable)
+	})
+
+	t.Run("Stops instead of waiting past the deadline", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.RepoRetryBaseDelayMS = 1000
+		cfg.RepoRetryMaxDelayMS = 1000
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(nil, repo.ErrThrottled).Once()
+		// Always back off for the whole ceiling, which outlasts the deadline
+		fullJitter := resilience.WithJitter(func(ceiling time.Duration) time.Duration { return ceiling })
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := resilience.WrapRepo(r, cfg, fullJitter).GetUser(ctx, "123")
+
+		assert.ErrorIs(t, err, repo.ErrThrottled)
+		assert.Less(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("Tries once when retries are disabled", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.RepoRetryMaxAttempts = 0
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(nil, repo.ErrThrottled).Once()
+
+		_, err := resilience.WrapRepo(r, cfg).GetUser(context.Background(), "123")
+
+		assert.ErrorIs(t, err, repo.ErrThrottled)
+	})
+}
+
+func TestBreaker(t *testing.T) {
+	newBreakerConfig := func() *config.Config {
+		cfg := newTestConfig()
+		cfg.RepoRetryMaxAttempts = 1
+		cfg.RepoBreakerThreshold = 2
+		cfg.RepoBreakerCooldownMS = 20
+		return cfg
+	}
+
+	t.Run("Fails fast once the backend keeps failing", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(nil, repo.ErrUnavailable).Twice()
+		wrapped := resilience.WrapRepo(r, newBreakerConfig())
+
+		_, _ = wrapped.GetUser(context.Background(), "123")
+		_, _ = wrapped.GetUser(context.Background(), "123")
+		_, err := wrapped.GetUser(context.Background(), "123")
+
+		assert.ErrorIs(t, err, resilience.ErrCircuitOpen)
+		assert.ErrorIs(t, err, repo.ErrUnavailable)
+	})
+
+	t.Run("Closes again once the backend recovers", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(nil, repo.ErrUnavailable).Twice()
+		r.On("GetUser", mock.Anything, "123").Return(&user.User{ID: "123"}, nil).Twice()
+		wrapped := resilience.WrapRepo(r, newBreakerConfig())
+
+		_, _ = wrapped.GetUser(context.Background(), "123")
+		_, _ = wrapped.GetUser(context.Background(), "123")
+		time.Sleep(30 * time.Millisecond)
+
+		_, err := wrapped.GetUser(context.Background(), "123")
+		assert.NoError(t, err)
+		_, err = wrapped.GetUser(context.Background(), "123")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Opens again when the backend has not recovered", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(nil, repo.ErrThrottled).Times(3)
+		wrapped := resilience.WrapRepo(r, newBreakerConfig())
+
+		_, _ = wrapped.GetUser(context.Background(), "123")
+		_, _ = wrapped.GetUser(context.Background(), "123")
+		time.Sleep(30 * time.Millisecond)
+
+		_, err := wrapped.GetUser(context.Background(), "123")
+		assert.ErrorIs(t, err, repo.ErrThrottled)
+		_, err = wrapped.GetUser(context.Background(), "123")
+		assert.ErrorIs(t, err, resilience.ErrCircuitOpen)
+	})
+
+	t.Run("Counts only backend failures", func(t *testing.T) {
+		r := mocks.NewRepo(t)
+		r.On("GetUser", mock.Anything, "123").Return(nil, repo.ErrUnavailable).Once()
+		r.On("GetUser", mock.Anything, "123").Return(nil, repo.ErrNotFound).Once()
+		r.On("GetUser", mock.Anything, "123").Return(nil, repo.ErrUnavailable).Once()
+		r.On("GetUser", mock.Anything, "123").Return(&user.User{ID: "123"}, nil).Once()
+		wrapped := resilience.WrapRepo(r, newBreakerConfig())
+
+		for i := 0; i < 3; i++ {
+			_, _ = wrapped.GetUser(context.Background(), "123")
+		}
+		_, err := wrapped.GetUser(context.Background(), "123")
+
+		assert.NoError(t, err)
+	})
+}
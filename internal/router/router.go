@@ -0,0 +1,180 @@
+// Package router dispatches API Gateway requests to the handlers by HTTP
+// method and route template, so a single Lambda can serve the whole API.
+package router
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/handlers"
+	"github.com/crestenstclair/crud/internal/middleware"
+	"github.com/crestenstclair/crud/internal/problem"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Route binds a handler to a method and a route template. Templates use the
+// API Gateway syntax, e.g. /user/{id}, and each {name} segment is passed to
+// the handler as a path parameter. Middleware only applies to this route, and
+// runs inside any given to the router.
+type Route struct {
+	Method     string
+	Path       string
+	Handler    middleware.HandlerFunc
+	Middleware []middleware.Middleware
+}
+
+// Routes is every route the API serves
+var Routes = []Route{
+	{Method: http.MethodGet, Path: "/user", Handler: handlers.ListUsers},
+	{Method: http.MethodPost, Path: "/user", Handler: handlers.CreateUser, Middleware: []middleware.Middleware{middleware.Idempotency()}},
+	{Method: http.MethodGet, Path: "/user/{id}", Handler: handlers.GetUser},
+	{Method: http.MethodPut, Path: "/user/{id}", Handler: handlers.UpdateUser},
+	{Method: http.MethodPatch, Path: "/user/{id}", Handler: handlers.PatchUser},
+	{Method: http.MethodDelete, Path: "/user/{id}", Handler: handlers.DeleteUser},
+	{Method: http.MethodPost, Path: "/user/{id}/restore", Handler: handlers.RestoreUser},
+	{Method: http.MethodPost, Path: "/user/{id}/revert", Handler: handlers.RevertUser},
+	{Method: http.MethodGet, Path: "/user/{id}/history", Handler: handlers.GetUserHistory},
+}
+
+type template struct {
+	path     string
+	segments []string
+	methods  map[string]middleware.HandlerFunc
+}
+
+type Router struct {
+	crud      *crud.Crud
+	templates []*template
+	handler   middleware.HandlerFunc
+}
+
+// New builds a router serving routes. Routes sharing a template are matched
+// together, so a request for a known path with an unknown method gets a 405
+// rather than a 404. Middleware wraps every request, including those the
+// router answers itself.
+func New(c *crud.Crud, routes []Route, mw ...middleware.Middleware) *Router {
+	r := &Router{crud: c}
+	r.handler = middleware.Chain(r.dispatch, mw...)
+
+	byPath := map[string]*template{}
+	for _, route := range routes {
+		t, ok := byPath[route.Path]
+		if !ok {
+			t = &template{
+				path:     route.Path,
+				segments: split(route.Path),
+				methods:  map[string]middleware.HandlerFunc{},
+			}
+			byPath[route.Path] = t
+			r.templates = append(r.templates, t)
+		}
+		t.methods[route.Method] = middleware.Chain(route.Handler, route.Middleware...)
+	}
+
+	return r
+}
+
+// Handle dispatches request to the handler registered for its method and
+// path. Path parameters are taken from the matched template, replacing any
+// API Gateway supplied, so the router works behind a catch-all route too.
+func (r *Router) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return r.handler(ctx, request, r.crud)
+}
+
+func (r *Router) dispatch(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+	t, pathParameters := r.match(request.Path)
+	if t == nil {
+		return problem.New(ctx, 404, problem.CodeNotFound, "No route matches "+request.Path).Response(), nil
+	}
+
+	handler, ok := t.methods[request.HTTPMethod]
+	if !ok {
+		if request.HTTPMethod == http.MethodOptions {
+			return events.APIGatewayProxyResponse{
+				StatusCode: 204,
+				Headers:    map[string]string{"Allow": t.allow()},
+			}, nil
+		}
+
+		response := problem.New(ctx, 405, problem.CodeMethodNotAllowed, request.HTTPMethod+" is not allowed on "+request.Path).Response()
+		response.Headers["Allow"] = t.allow()
+		return response, nil
+	}
+
+	request.PathParameters = pathParameters
+	request.Resource = t.path
+
+	middleware.SetRoute(ctx, t.path)
+
+	span := trace.SpanFromContext(ctx)
+	span.SetName(request.HTTPMethod + " " + t.path)
+	span.SetAttributes(semconv.HTTPRoute(t.path))
+
+	return handler(ctx, request, c)
+}
+
+// match finds the template for path, along with the parameters taken from it
+func (r *Router) match(path string) (*template, map[string]string) {
+	segments := split(path)
+
+	for _, t := range r.templates {
+		if pathParameters, ok := t.match(segments); ok {
+			return t, pathParameters
+		}
+	}
+
+	return nil, nil
+}
+
+func (t *template) match(segments []string) (map[string]string, bool) {
+	if len(segments) != len(t.segments) {
+		return nil, false
+	}
+
+	pathParameters := map[string]string{}
+	for i, segment := range t.segments {
+		if name, ok := parameterName(segment); ok {
+			if segments[i] == "" {
+				return nil, false
+			}
+			pathParameters[name] = segments[i]
+			continue
+		}
+
+		if segment != segments[i] {
+			return nil, false
+		}
+	}
+
+	return pathParameters, true
+}
+
+// allow lists the methods the template accepts, for the Allow header
+func (t *template) allow() string {
+	methods := []string{http.MethodOptions}
+	for method := range t.methods {
+		if method != http.MethodOptions {
+			methods = append(methods, method)
+		}
+	}
+	sort.Strings(methods)
+
+	return strings.Join(methods, ", ")
+}
+
+func split(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+func parameterName(segment string) (string, bool) {
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+
+	return "", false
+}
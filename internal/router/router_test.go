@@ -0,0 +1,193 @@
+package router_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/middleware"
+	"github.com/crestenstclair/crud/internal/router"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap/zaptest"
+)
+
+// recorder is a handler that remembers the request it was called with
+type recorder struct {
+	name    string
+	request *events.APIGatewayProxyRequest
+}
+
+func (r *recorder) handle(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+	r.request = &request
+	return events.APIGatewayProxyResponse{StatusCode: 200, Body: r.name}, nil
+}
+
+func newTestRouter(t *testing.T, handlers map[string]*recorder) *router.Router {
+	testCrud := &crud.Crud{
+		Logger: zaptest.NewLogger(t),
+		Config: &config.Config{},
+	}
+
+	return router.New(testCrud, []router.Route{
+		{Method: "GET", Path: "/user", Handler: handlers["list"].handle},
+		{Method: "POST", Path: "/user", Handler: handlers["create"].handle},
+		{Method: "GET", Path: "/user/{id}", Handler: handlers["get"].handle},
+		{Method: "DELETE", Path: "/user/{id}", Handler: handlers["delete"].handle},
+	})
+}
+
+func newRecorders() map[string]*recorder {
+	recorders := map[string]*recorder{}
+	for _, name := range []string{"list", "create", "get", "delete"} {
+		recorders[name] = &recorder{name: name}
+	}
+
+	return recorders
+}
+
+func code(t *testing.T, res events.APIGatewayProxyResponse) string {
+	var body map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(res.Body), &body))
+
+	return body["code"].(string)
+}
+
+func TestRouter(t *testing.T) {
+	t.Run("Dispatches on method and route template", func(t *testing.T) {
+		recorders := newRecorders()
+		r := newTestRouter(t, recorders)
+
+		tests := []struct {
+			method string
+			path   string
+			want   string
+		}{
+			{"GET", "/user", "list"},
+			{"POST", "/user", "create"},
+			{"GET", "/user/123", "get"},
+			{"DELETE", "/user/123", "delete"},
+			{"GET", "/user/", "list"},
+		}
+
+		for _, tt := range tests {
+			res, err := r.Handle(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: tt.method, Path: tt.path})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, res.Body, "%s %s", tt.method, tt.path)
+		}
+	})
+
+	t.Run("Passes path parameters from the template to the handler", func(t *testing.T) {
+		recorders := newRecorders()
+		r := newTestRouter(t, recorders)
+
+		_, err := r.Handle(context.Background(), events.APIGatewayProxyRequest{
+			HTTPMethod:     "GET",
+			Path:           "/user/123",
+			PathParameters: map[string]string{"proxy": "user/123"},
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, map[string]string{"id": "123"}, recorders["get"].request.PathParameters)
+		assert.Equal(t, "/user/{id}", recorders["get"].request.Resource)
+	})
+
+	t.Run("Returns 404 for unknown paths", func(t *testing.T) {
+		r := newTestRouter(t, newRecorders())
+
+		for _, path := range []string{"/", "/users", "/user/123/extra", "/profile/123"} {
+			res, err := r.Handle(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: path})
+			assert.NoError(t, err)
+			assert.Equal(t, 404, res.StatusCode, path)
+			assert.Equal(t, "NOT_FOUND", code(t, res))
+		}
+	})
+
+	t.Run("Returns 405 with the allowed methods", func(t *testing.T) {
+		r := newTestRouter(t, newRecorders())
+
+		res, err := r.Handle(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "PUT", Path: "/user/123"})
+		assert.NoError(t, err)
+
+		assert.Equal(t, 405, res.StatusCode)
+		assert.Equal(t, "DELETE, GET, OPTIONS", res.Headers["Allow"])
+		assert.Equal(t, "METHOD_NOT_ALLOWED", code(t, res))
+	})
+
+	t.Run("Answers OPTIONS with the allowed methods", func(t *testing.T) {
+		r := newTestRouter(t, newRecorders())
+
+		res, err := r.Handle(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "OPTIONS", Path: "/user"})
+		assert.NoError(t, err)
+
+		assert.Equal(t, 204, res.StatusCode)
+		assert.Equal(t, "GET, OPTIONS, POST", res.Headers["Allow"])
+		assert.Empty(t, res.Body)
+	})
+
+	t.Run("Wraps every request in the router's middleware and each route in its own", func(t *testing.T) {
+		var order []string
+		tag := func(name string) middleware.Middleware {
+			return func(next middleware.HandlerFunc) middleware.HandlerFunc {
+				return func(ctx context.Context, request events.APIGatewayProxyRequest, c *crud.Crud) (events.APIGatewayProxyResponse, error) {
+					order = append(order, name)
+					return next(ctx, request, c)
+				}
+			}
+		}
+
+		get := &recorder{name: "get"}
+		r := router.New(&crud.Crud{Logger: zaptest.NewLogger(t), Config: &config.Config{}}, []router.Route{
+			{Method: "GET", Path: "/user/{id}", Handler: get.handle, Middleware: []middleware.Middleware{tag("route")}},
+		}, tag("router"))
+
+		_, err := r.Handle(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/user/123"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"router", "route"}, order)
+		assert.Equal(t, "123", get.request.PathParameters["id"])
+
+		order = nil
+		res, err := r.Handle(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/missing"})
+		assert.NoError(t, err)
+		assert.Equal(t, 404, res.StatusCode)
+		assert.Equal(t, []string{"router"}, order)
+	})
+
+	t.Run("Names the request's span after the route", func(t *testing.T) {
+		spanRecorder := tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+		t.Cleanup(func() {
+			otel.SetTracerProvider(noop.NewTracerProvider())
+		})
+
+		get := &recorder{name: "get"}
+		r := router.New(&crud.Crud{Logger: zaptest.NewLogger(t), Config: &config.Config{}}, []router.Route{
+			{Method: "GET", Path: "/user/{id}", Handler: get.handle},
+		}, middleware.Tracing())
+
+		_, err := r.Handle(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "GET", Path: "/user/123"})
+		assert.NoError(t, err)
+
+		spans := spanRecorder.Ended()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, "GET /user/{id}", spans[0].Name())
+	})
+
+	t.Run("Routes every handler in the API", func(t *testing.T) {
+		seen := map[string]bool{}
+		for _, route := range router.Routes {
+			key := route.Method + " " + route.Path
+			assert.False(t, seen[key], "duplicate route %s", key)
+			assert.NotNil(t, route.Handler, key)
+			seen[key] = true
+		}
+
+		assert.Len(t, seen, 9)
+	})
+}
@@ -0,0 +1,118 @@
+// Package server serves the API over net/http, so it can run locally or in a
+// container without Lambda or API Gateway. Requests are adapted into the API
+// Gateway events the handlers already understand, and dispatched by the same
+// router the Lambda uses.
+package server
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/metrics"
+	"github.com/crestenstclair/crud/internal/middleware"
+	"github.com/crestenstclair/crud/internal/problem"
+	"github.com/crestenstclair/crud/internal/router"
+	"go.uber.org/zap"
+)
+
+// MetricsPath serves Prometheus metrics when that is the metrics backend
+const MetricsPath = "/metrics"
+
+type server struct {
+	crud    *crud.Crud
+	router  *router.Router
+	metrics http.Handler
+}
+
+func New(c *crud.Crud) http.Handler {
+	s := &server{crud: c, router: router.New(c, router.Routes, middleware.Defaults()...)}
+	if p, ok := c.Metrics.(*metrics.Prometheus); ok {
+		s.metrics = p.Handler()
+	}
+	return s
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if s.metrics != nil && r.URL.Path == MetricsPath {
+		s.metrics.ServeHTTP(w, r)
+		return
+	}
+
+	request, err := toProxyRequest(r, s.crud.Config.MaxRequestBodyBytes)
+	if err != nil {
+		s.crud.Logger.Error("Failed to read request body", zap.Error(err))
+		writeResponse(w, problem.New(ctx, 400, problem.CodeMalformedBody, "Failed to read request body").Response())
+		return
+	}
+
+	response, err := s.router.Handle(ctx, request)
+	if err != nil {
+		s.crud.Logger.Error("Handler failed", zap.Error(err))
+		response = problem.New(ctx, 500, problem.CodeInternal, "An internal error occured").Response()
+	}
+
+	writeResponse(w, response)
+}
+
+// toProxyRequest adapts r into the event API Gateway would have sent for it.
+// At most maxBodyBytes+1 bytes of the body are read, which is enough for the
+// handlers to reject bodies over the limit.
+func toProxyRequest(r *http.Request, maxBodyBytes int) (events.APIGatewayProxyRequest, error) {
+	var reader io.Reader = r.Body
+	if maxBodyBytes > 0 {
+		reader = io.LimitReader(r.Body, int64(maxBodyBytes)+1)
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return events.APIGatewayProxyRequest{}, err
+	}
+
+	headers := map[string]string{}
+	for name, values := range r.Header {
+		headers[name] = strings.Join(values, ",")
+	}
+
+	query := map[string]string{}
+	for name, values := range r.URL.Query() {
+		query[name] = values[0]
+	}
+
+	return events.APIGatewayProxyRequest{
+		HTTPMethod:                      r.Method,
+		Path:                            r.URL.Path,
+		Headers:                         headers,
+		MultiValueHeaders:               r.Header,
+		QueryStringParameters:           query,
+		MultiValueQueryStringParameters: r.URL.Query(),
+		Body:                            string(body),
+	}, nil
+}
+
+func writeResponse(w http.ResponseWriter, response events.APIGatewayProxyResponse) {
+	for name, value := range response.Headers {
+		w.Header().Set(name, value)
+	}
+	for name, values := range response.MultiValueHeaders {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+
+	body := []byte(response.Body)
+	if response.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(response.Body)
+		if err == nil {
+			body = decoded
+		}
+	}
+
+	w.WriteHeader(response.StatusCode)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,192 @@
+package server_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/crud"
+	"github.com/crestenstclair/crud/internal/idempotency"
+	"github.com/crestenstclair/crud/internal/metrics"
+	"github.com/crestenstclair/crud/internal/repo/memory"
+	"github.com/crestenstclair/crud/internal/server"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	r, err := memory.New()
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server.New(&crud.Crud{
+		Repo:   r,
+		Logger: zaptest.NewLogger(t),
+		Config: &config.Config{
+			ListDefaultPageSize: 25,
+			ListMaxPageSize:     100,
+			MaxRequestBodyBytes: 1024,
+		},
+		Idempotency: idempotency.NewMemoryStore(time.Hour, time.Minute),
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func do(t *testing.T, method string, url string, contentType string, body string) (*http.Response, map[string]any) {
+	return doWithHeaders(t, method, url, map[string]string{"Content-Type": contentType}, body)
+}
+
+func doWithHeaders(t *testing.T, method string, url string, headers map[string]string, body string) (*http.Response, map[string]any) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	assert.NoError(t, err)
+	for k, v := range headers {
+		if v != "" {
+			req.Header.Set(k, v)
+		}
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	var result map[string]any
+	_ = json.NewDecoder(res.Body).Decode(&result)
+
+	return res, result
+}
+
+func TestServer(t *testing.T) {
+	t.Run("Serves Prometheus metrics", func(t *testing.T) {
+		r, err := memory.New()
+		assert.NoError(t, err)
+		recorder, err := metrics.NewPrometheus(prometheus.NewRegistry())
+		assert.NoError(t, err)
+
+		srv := httptest.NewServer(server.New(&crud.Crud{
+			Repo:    metrics.WrapRepo(r, recorder),
+			Logger:  zaptest.NewLogger(t),
+			Config:  &config.Config{ListDefaultPageSize: 25, ListMaxPageSize: 100},
+			Metrics: recorder,
+		}))
+		t.Cleanup(srv.Close)
+
+		res, _ := do(t, http.MethodGet, srv.URL+"/user/123", "", "")
+		assert.Equal(t, 404, res.StatusCode)
+
+		res, err = http.Get(srv.URL + server.MetricsPath)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Contains(t, string(body), `crud_requests_total{method="GET",route="/user/{id}",status_class="4xx"} 1`)
+		assert.Contains(t, string(body), `crud_repo_operations_total{operation="GetUser",outcome="not_found"} 1`)
+	})
+
+	t.Run("Serves the user lifecycle through the handlers", func(t *testing.T) {
+		srv := newTestServer(t)
+
+		res, created := do(t, http.MethodPost, srv.URL+"/user", "application/json",
+			`{"firstName":"Fred","lastName":"Flintstone","email":"fred@example.com","dob":"1979-12-09T00:00:00Z"}`)
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, `"1"`, res.Header.Get("ETag"))
+		id := created["id"].(string)
+
+		res, fetched := do(t, http.MethodGet, srv.URL+"/user/"+id, "", "")
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, "Fred", fetched["firstName"])
+
+		res, patched := do(t, http.MethodPatch, srv.URL+"/user/"+id, "application/merge-patch+json", `{"lastName":"Rubble"}`)
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, "Rubble", patched["lastName"])
+
+		res, page := do(t, http.MethodGet, srv.URL+"/user?limit=10", "", "")
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Len(t, page["users"], 1)
+
+		res, _ = do(t, http.MethodDelete, srv.URL+"/user/"+id, "", "")
+		assert.Equal(t, 200, res.StatusCode)
+
+		res, _ = do(t, http.MethodGet, srv.URL+"/user/"+id, "", "")
+		assert.Equal(t, 404, res.StatusCode)
+
+		res, restored := do(t, http.MethodPost, srv.URL+"/user/"+id+"/restore", "", "")
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, "Rubble", restored["lastName"])
+
+		res, _ = do(t, http.MethodGet, srv.URL+"/user/"+id, "", "")
+		assert.Equal(t, 200, res.StatusCode)
+
+		res, history := do(t, http.MethodGet, srv.URL+"/user/"+id+"/history?limit=10", "", "")
+		assert.Equal(t, 200, res.StatusCode)
+		records := history["history"].([]any)
+		assert.Len(t, records, 4)
+		patch := records[2].(map[string]any)
+		assert.Equal(t, "update", patch["operation"])
+		assert.Equal(t, "anonymous", patch["actor"])
+		assert.Equal(t, []any{map[string]any{"field": "lastName", "before": "Flintstone", "after": "Rubble"}}, patch["changes"])
+
+		res, reverted := doWithHeaders(t, http.MethodPost, srv.URL+"/user/"+id+"/revert",
+			map[string]string{"Content-Type": "application/json", "If-Match": `"4"`}, `{"version":1}`)
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, `"5"`, res.Header.Get("ETag"))
+		assert.Equal(t, "Flintstone", reverted["lastName"])
+
+		res, _ = do(t, http.MethodGet, srv.URL+"/user/"+id+"?asOf=2000-01-01T00:00:00Z", "", "")
+		assert.Equal(t, 404, res.StatusCode)
+	})
+
+	t.Run("Returns 404 for unknown paths", func(t *testing.T) {
+		srv := newTestServer(t)
+
+		res, body := do(t, http.MethodGet, srv.URL+"/users/123/extra", "", "")
+
+		assert.Equal(t, 404, res.StatusCode)
+		assert.Equal(t, "NOT_FOUND", body["code"])
+		assert.NotEmpty(t, res.Header.Get("X-Request-Id"))
+		assert.Equal(t, res.Header.Get("X-Request-Id"), body["traceId"])
+	})
+
+	t.Run("Returns 405 with the allowed methods", func(t *testing.T) {
+		srv := newTestServer(t)
+
+		res, body := do(t, http.MethodPut, srv.URL+"/user", "", "")
+
+		assert.Equal(t, 405, res.StatusCode)
+		assert.Equal(t, "GET, OPTIONS, POST", res.Header.Get("Allow"))
+		assert.Equal(t, "METHOD_NOT_ALLOWED", body["code"])
+	})
+
+	t.Run("Lets handlers reject bodies over the limit", func(t *testing.T) {
+		srv := newTestServer(t)
+
+		res, _ := do(t, http.MethodPost, srv.URL+"/user", "application/json", strings.Repeat(" ", 4096))
+
+		assert.Equal(t, 413, res.StatusCode)
+	})
+	t.Run("Creates one user for retried requests with an idempotency key", func(t *testing.T) {
+		srv := newTestServer(t)
+		headers := map[string]string{"Content-Type": "application/json", "Idempotency-Key": "create-fred"}
+		body := `{"firstName":"Fred","lastName":"Flintstone","email":"fred@example.com","dob":"1979-12-09T00:00:00Z"}`
+
+		res, first := doWithHeaders(t, http.MethodPost, srv.URL+"/user", headers, body)
+		assert.Equal(t, 200, res.StatusCode)
+		assert.NotEmpty(t, first["id"])
+
+		res, second := doWithHeaders(t, http.MethodPost, srv.URL+"/user", headers, body)
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, "true", res.Header.Get("Idempotent-Replayed"))
+		assert.Equal(t, first["id"], second["id"])
+
+		res, _ = doWithHeaders(t, http.MethodPost, srv.URL+"/user", headers, strings.Replace(body, "Fred", "Wilma", 1))
+		assert.Equal(t, 422, res.StatusCode)
+	})
+}
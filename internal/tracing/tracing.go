@@ -0,0 +1,98 @@
+// Package tracing sets up OpenTelemetry. Spans are sent to the exporter named
+// by TRACING_EXPORTER, and trace context is propagated with W3C traceparent
+// headers.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/crestenstclair/crud/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/crestenstclair/crud"
+
+// ExporterFactory builds the exporter spans are sent to
+type ExporterFactory func(ctx context.Context) (sdktrace.SpanExporter, error)
+
+var (
+	mu        sync.RWMutex
+	exporters = map[string]ExporterFactory{
+		// stdout writes one JSON span per line, for checking traces locally
+		"stdout": func(ctx context.Context) (sdktrace.SpanExporter, error) {
+			return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		},
+		// otlp is configured with the standard OTEL_EXPORTER_OTLP_* variables
+		"otlp": func(ctx context.Context) (sdktrace.SpanExporter, error) {
+			return otlptracehttp.New(ctx)
+		},
+	}
+)
+
+// RegisterExporter makes an exporter available to TRACING_EXPORTER under name
+func RegisterExporter(name string, factory ExporterFactory) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	exporters[name] = factory
+}
+
+// Setup installs the tracer provider for cfg.TracingExporter. With no
+// exporter, spans are not recorded but trace context is still propagated.
+// The returned function flushes and stops the provider.
+func Setup(ctx context.Context, cfg *config.Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if cfg.TracingExporter == "" || cfg.TracingExporter == "none" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	mu.RLock()
+	factory, ok := exporters[cfg.TracingExporter]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown TRACING_EXPORTER %q", cfg.TracingExporter)
+	}
+
+	exporter, err := factory(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", cfg.TracingExporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(cfg.TracingServiceName),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Flush exports any spans still buffered. Lambda freezes the function between
+// invocations, so spans are flushed before each invocation returns rather than
+// left for the batcher.
+func Flush(ctx context.Context) {
+	if provider, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); ok {
+		_ = provider.ForceFlush(ctx)
+	}
+}
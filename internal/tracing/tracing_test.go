@@ -0,0 +1,75 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/crestenstclair/crud/internal/config"
+	"github.com/crestenstclair/crud/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestSetup(t *testing.T) {
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+
+	t.Run("Propagates W3C trace context without an exporter", func(t *testing.T) {
+		shutdown, err := tracing.Setup(context.Background(), &config.Config{TracingExporter: "none"})
+		assert.NoError(t, err)
+		assert.NoError(t, shutdown(context.Background()))
+
+		assert.Contains(t, otel.GetTextMapPropagator().Fields(), "traceparent")
+	})
+
+	t.Run("Sends spans to a registered exporter", func(t *testing.T) {
+		exporter := tracetest.NewInMemoryExporter()
+		tracing.RegisterExporter("memory", func(ctx context.Context) (sdktrace.SpanExporter, error) {
+			return exporter, nil
+		})
+
+		shutdown, err := tracing.Setup(context.Background(), &config.Config{
+			TracingExporter:    "memory",
+			TracingServiceName: "crud-test",
+		})
+		assert.NoError(t, err)
+
+		_, span := tracing.Tracer().Start(context.Background(), "test")
+		span.End()
+		tracing.Flush(context.Background())
+
+		spans := exporter.GetSpans()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, "test", spans[0].Name)
+		assert.Contains(t, spans[0].Resource.String(), "service.name=crud-test")
+
+		assert.NoError(t, shutdown(context.Background()))
+	})
+
+	t.Run("Builds the stdout exporter", func(t *testing.T) {
+		shutdown, err := tracing.Setup(context.Background(), &config.Config{TracingExporter: "stdout"})
+		assert.NoError(t, err)
+		assert.NoError(t, shutdown(context.Background()))
+	})
+
+	t.Run("Returns an error for unknown exporters", func(t *testing.T) {
+		_, err := tracing.Setup(context.Background(), &config.Config{TracingExporter: "zipkin"})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Returns an error when the exporter cannot be created", func(t *testing.T) {
+		tracing.RegisterExporter("broken", func(ctx context.Context) (sdktrace.SpanExporter, error) {
+			return nil, errors.New("no collector")
+		})
+
+		_, err := tracing.Setup(context.Background(), &config.Config{TracingExporter: "broken"})
+
+		assert.ErrorContains(t, err, "no collector")
+	})
+}
@@ -0,0 +1,106 @@
+package transport
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// FromALB converts an ALB target group event. Target groups send either
+// single or multi-value headers and query parameters depending on their
+// configuration, and both are filled in from whichever was sent. ALB passes
+// query parameters through still percent-encoded, so they are decoded here.
+func FromALB(event events.ALBTargetGroupRequest) (events.APIGatewayProxyRequest, error) {
+	request := events.APIGatewayProxyRequest{
+		HTTPMethod:      event.HTTPMethod,
+		Path:            event.Path,
+		Body:            event.Body,
+		IsBase64Encoded: event.IsBase64Encoded,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Path:       event.Path,
+			HTTPMethod: event.HTTPMethod,
+		},
+	}
+
+	if event.MultiValueHeaders != nil {
+		request.MultiValueHeaders = event.MultiValueHeaders
+		request.Headers = make(map[string]string, len(event.MultiValueHeaders))
+		for name, values := range event.MultiValueHeaders {
+			request.Headers[name] = strings.Join(values, ",")
+		}
+	} else {
+		request.Headers = event.Headers
+		request.MultiValueHeaders = make(map[string][]string, len(event.Headers))
+		for name, value := range event.Headers {
+			request.MultiValueHeaders[name] = []string{value}
+		}
+	}
+
+	multiValueQuery := event.MultiValueQueryStringParameters
+	if multiValueQuery == nil {
+		multiValueQuery = make(map[string][]string, len(event.QueryStringParameters))
+		for name, value := range event.QueryStringParameters {
+			multiValueQuery[name] = []string{value}
+		}
+	}
+
+	request.QueryStringParameters = make(map[string]string, len(multiValueQuery))
+	request.MultiValueQueryStringParameters = make(map[string][]string, len(multiValueQuery))
+	for name, values := range multiValueQuery {
+		decodedName, err := url.QueryUnescape(name)
+		if err != nil {
+			return events.APIGatewayProxyRequest{}, fmt.Errorf("invalid query parameter %q: %w", name, err)
+		}
+
+		decodedValues := make([]string, 0, len(values))
+		for _, value := range values {
+			decoded, err := url.QueryUnescape(value)
+			if err != nil {
+				return events.APIGatewayProxyRequest{}, fmt.Errorf("invalid value for query parameter %q: %w", decodedName, err)
+			}
+			decodedValues = append(decodedValues, decoded)
+		}
+
+		request.MultiValueQueryStringParameters[decodedName] = decodedValues
+		if len(decodedValues) > 0 {
+			request.QueryStringParameters[decodedName] = decodedValues[len(decodedValues)-1]
+		}
+	}
+
+	return decodeBody(request), nil
+}
+
+// ToALB renders a response for an ALB target group. Target groups with
+// multi-value headers enabled ignore the single-value headers in responses,
+// so multiValue should match what the request was sent with.
+func ToALB(response events.APIGatewayProxyResponse, multiValue bool) events.ALBTargetGroupResponse {
+	alb := events.ALBTargetGroupResponse{
+		StatusCode:        response.StatusCode,
+		StatusDescription: fmt.Sprintf("%d %s", response.StatusCode, http.StatusText(response.StatusCode)),
+		Body:              response.Body,
+		IsBase64Encoded:   response.IsBase64Encoded,
+	}
+
+	if !multiValue {
+		headers, cookies := flattenHeaders(response)
+		// Only one cookie can be set without multi-value headers
+		if len(cookies) > 0 {
+			headers["Set-Cookie"] = cookies[len(cookies)-1]
+		}
+		alb.Headers = headers
+		return alb
+	}
+
+	alb.MultiValueHeaders = make(map[string][]string, len(response.Headers)+len(response.MultiValueHeaders))
+	for name, value := range response.Headers {
+		alb.MultiValueHeaders[name] = append(alb.MultiValueHeaders[name], value)
+	}
+	for name, values := range response.MultiValueHeaders {
+		alb.MultiValueHeaders[name] = append(alb.MultiValueHeaders[name], values...)
+	}
+
+	return alb
+}
@@ -0,0 +1,189 @@
+// Package transport lets the handlers sit behind any of the HTTP front doors
+// Lambda supports. API Gateway REST (v1) and HTTP API (v2) events, ALB target
+// group events and Function URL events are all normalised into the
+// events.APIGatewayProxyRequest the handlers take, and responses are rendered
+// back in the format of the event that was received.
+package transport
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/problem"
+)
+
+type Handler func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+type Format int
+
+const (
+	FormatUnknown Format = iota
+	FormatAPIGatewayV1
+	FormatAPIGatewayV2
+	FormatALB
+	FormatFunctionURL
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatAPIGatewayV1:
+		return "API Gateway v1"
+	case FormatAPIGatewayV2:
+		return "API Gateway v2"
+	case FormatALB:
+		return "ALB"
+	case FormatFunctionURL:
+		return "Function URL"
+	default:
+		return "unknown"
+	}
+}
+
+var ErrUnknownFormat = errors.New("unrecognised event format")
+
+// probe holds just enough of an event to tell the formats apart
+type probe struct {
+	Version        string `json:"version"`
+	HTTPMethod     string `json:"httpMethod"`
+	RequestContext struct {
+		ELB        json.RawMessage `json:"elb"`
+		DomainName string          `json:"domainName"`
+	} `json:"requestContext"`
+}
+
+// Detect works out which front door sent payload
+func Detect(payload []byte) (Format, error) {
+	var p probe
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return FormatUnknown, fmt.Errorf("%w: %s", ErrUnknownFormat, err)
+	}
+
+	switch {
+	case len(p.RequestContext.ELB) > 0:
+		return FormatALB, nil
+	case p.Version == "2.0" && strings.Contains(p.RequestContext.DomainName, ".lambda-url."):
+		return FormatFunctionURL, nil
+	case p.Version == "2.0":
+		return FormatAPIGatewayV2, nil
+	case p.HTTPMethod != "":
+		return FormatAPIGatewayV1, nil
+	default:
+		return FormatUnknown, ErrUnknownFormat
+	}
+}
+
+// Adapt wraps h into a Lambda handler accepting any supported event. Use it
+// with lambda.Start in place of h.
+func Adapt(h Handler) func(context.Context, json.RawMessage) (any, error) {
+	return func(ctx context.Context, payload json.RawMessage) (any, error) {
+		format, err := Detect(payload)
+		if err != nil {
+			return nil, err
+		}
+
+		switch format {
+		case FormatAPIGatewayV2:
+			var event events.APIGatewayV2HTTPRequest
+			if err := json.Unmarshal(payload, &event); err != nil {
+				return nil, err
+			}
+			response, err := h(ctx, FromV2(event))
+			if err != nil {
+				return nil, err
+			}
+			return ToV2(response), nil
+		case FormatALB:
+			var event events.ALBTargetGroupRequest
+			if err := json.Unmarshal(payload, &event); err != nil {
+				return nil, err
+			}
+			request, err := FromALB(event)
+			if err != nil {
+				// The client sent a query string that cannot be decoded, which
+				// the ALB would otherwise answer with a 502
+				response := problem.New(ctx, 400, problem.CodeInvalidParameter, err.Error()).Response()
+				return ToALB(response, event.MultiValueHeaders != nil), nil
+			}
+			response, err := h(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+			return ToALB(response, event.MultiValueHeaders != nil), nil
+		case FormatFunctionURL:
+			var event events.LambdaFunctionURLRequest
+			if err := json.Unmarshal(payload, &event); err != nil {
+				return nil, err
+			}
+			response, err := h(ctx, FromFunctionURL(event))
+			if err != nil {
+				return nil, err
+			}
+			return ToFunctionURL(response), nil
+		default:
+			var event events.APIGatewayProxyRequest
+			if err := json.Unmarshal(payload, &event); err != nil {
+				return nil, err
+			}
+			response, err := h(ctx, decodeBody(event))
+			if err != nil {
+				return nil, err
+			}
+			return response, nil
+		}
+	}
+}
+
+// decodeBody undoes the base64 encoding front doors apply to some bodies, so
+// handlers always see the raw body
+func decodeBody(request events.APIGatewayProxyRequest) events.APIGatewayProxyRequest {
+	if !request.IsBase64Encoded {
+		return request
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(request.Body)
+	if err != nil {
+		// Left encoded, the handlers reject it as a malformed body
+		return request
+	}
+
+	request.Body = string(decoded)
+	request.IsBase64Encoded = false
+
+	return request
+}
+
+// flattenHeaders merges a response's headers into a single map, for formats
+// without multi-value headers. Repeated values are comma separated, except
+// Set-Cookie which is returned separately as it cannot be.
+func flattenHeaders(response events.APIGatewayProxyResponse) (map[string]string, []string) {
+	headers := map[string]string{}
+	var cookies []string
+
+	add := func(name string, value string) {
+		if strings.EqualFold(name, "Set-Cookie") {
+			cookies = append(cookies, value)
+			return
+		}
+		if existing, ok := headers[name]; ok {
+			headers[name] = existing + ", " + value
+			return
+		}
+		headers[name] = value
+	}
+
+	for name, value := range response.Headers {
+		add(name, value)
+	}
+	for name, values := range response.MultiValueHeaders {
+		for _, value := range values {
+			add(name, value)
+		}
+	}
+
+	return headers, cookies
+}
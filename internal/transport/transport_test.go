@@ -0,0 +1,264 @@
+package transport_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/crestenstclair/crud/internal/problem"
+	"github.com/crestenstclair/crud/internal/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+const v1Event = `{
+	"resource": "/user/{id}",
+	"path": "/user/123",
+	"httpMethod": "GET",
+	"headers": {"Accept-Language": "fr"},
+	"pathParameters": {"id": "123"},
+	"requestContext": {"requestId": "v1-request"}
+}`
+
+const v2Event = `{
+	"version": "2.0",
+	"routeKey": "PATCH /user/{id}",
+	"rawPath": "/user/123",
+	"rawQueryString": "tag=a&tag=b",
+	"cookies": ["a=1", "b=2"],
+	"headers": {"content-type": "application/merge-patch+json", "if-match": "\"3\""},
+	"queryStringParameters": {"tag": "a,b"},
+	"pathParameters": {"id": "123"},
+	"requestContext": {
+		"requestId": "v2-request",
+		"domainName": "abc123.execute-api.us-west-2.amazonaws.com",
+		"http": {"method": "PATCH", "path": "/user/123", "sourceIp": "10.0.0.1"}
+	},
+	"body": "eyJsYXN0TmFtZSI6IlJ1YmJsZSJ9",
+	"isBase64Encoded": true
+}`
+
+const albEvent = `{
+	"httpMethod": "GET",
+	"path": "/user",
+	"multiValueQueryStringParameters": {"cursor": ["a%2Bb%3D"], "limit": ["10"]},
+	"multiValueHeaders": {"accept": ["application/json"]},
+	"requestContext": {"elb": {"targetGroupArn": "arn:aws:elasticloadbalancing:us-west-2:123456789012:targetgroup/crud/abc"}},
+	"body": "",
+	"isBase64Encoded": false
+}`
+
+const functionURLEvent = `{
+	"version": "2.0",
+	"rawPath": "/user",
+	"rawQueryString": "",
+	"headers": {"content-type": "application/json"},
+	"requestContext": {
+		"requestId": "url-request",
+		"domainName": "abc123.lambda-url.us-west-2.on.aws",
+		"http": {"method": "POST", "path": "/user"}
+	},
+	"body": "{\"firstName\":\"Fred\"}",
+	"isBase64Encoded": false
+}`
+
+// echo records the request it was called with and returns a fixed response
+func echo(received *events.APIGatewayProxyRequest) transport.Handler {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		*received = request
+		return events.APIGatewayProxyResponse{
+			StatusCode:        201,
+			Headers:           map[string]string{"Content-Type": "application/json"},
+			MultiValueHeaders: map[string][]string{"Set-Cookie": {"session=1"}, "Vary": {"Accept", "Origin"}},
+			Body:              `{"ok":true}`,
+		}, nil
+	}
+}
+
+func TestDetect(t *testing.T) {
+	t.Run("Tells each event format apart", func(t *testing.T) {
+		tests := []struct {
+			event string
+			want  transport.Format
+		}{
+			{v1Event, transport.FormatAPIGatewayV1},
+			{v2Event, transport.FormatAPIGatewayV2},
+			{albEvent, transport.FormatALB},
+			{functionURLEvent, transport.FormatFunctionURL},
+		}
+
+		for _, tt := range tests {
+			format, err := transport.Detect([]byte(tt.event))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, format, tt.want.String())
+		}
+	})
+
+	t.Run("Returns an error for events that are not HTTP requests", func(t *testing.T) {
+		_, err := transport.Detect([]byte(`{"Records": []}`))
+		assert.ErrorIs(t, err, transport.ErrUnknownFormat)
+
+		_, err = transport.Detect([]byte(`not json`))
+		assert.ErrorIs(t, err, transport.ErrUnknownFormat)
+	})
+}
+
+func TestAdapt(t *testing.T) {
+	t.Run("Passes API Gateway v1 events through unchanged", func(t *testing.T) {
+		var received events.APIGatewayProxyRequest
+
+		res, err := transport.Adapt(echo(&received))(context.Background(), json.RawMessage(v1Event))
+		assert.NoError(t, err)
+
+		assert.Equal(t, "GET", received.HTTPMethod)
+		assert.Equal(t, "123", received.PathParameters["id"])
+		assert.Equal(t, "v1-request", received.RequestContext.RequestID)
+		assert.Equal(t, 201, res.(events.APIGatewayProxyResponse).StatusCode)
+	})
+
+	t.Run("Normalises API Gateway v2 events", func(t *testing.T) {
+		var received events.APIGatewayProxyRequest
+
+		res, err := transport.Adapt(echo(&received))(context.Background(), json.RawMessage(v2Event))
+		assert.NoError(t, err)
+
+		assert.Equal(t, "PATCH", received.HTTPMethod)
+		assert.Equal(t, "/user/123", received.Path)
+		assert.Equal(t, "/user/{id}", received.Resource)
+		assert.Equal(t, "123", received.PathParameters["id"])
+		assert.Equal(t, `"3"`, received.Headers["if-match"])
+		assert.Equal(t, "a=1; b=2", received.Headers["cookie"])
+		assert.Equal(t, []string{"a", "b"}, received.MultiValueQueryStringParameters["tag"])
+		assert.Equal(t, `{"lastName":"Rubble"}`, received.Body)
+		assert.False(t, received.IsBase64Encoded)
+		assert.Equal(t, "v2-request", received.RequestContext.RequestID)
+		assert.Equal(t, "10.0.0.1", received.RequestContext.Identity.SourceIP)
+
+		v2, ok := res.(events.APIGatewayV2HTTPResponse)
+		assert.True(t, ok)
+		assert.Equal(t, 201, v2.StatusCode)
+		assert.Equal(t, `{"ok":true}`, v2.Body)
+		assert.Equal(t, "application/json", v2.Headers["Content-Type"])
+		assert.Equal(t, "Accept, Origin", v2.Headers["Vary"])
+		assert.Equal(t, []string{"session=1"}, v2.Cookies)
+	})
+
+	t.Run("Passes on what API Gateway v2 authorizers verified", func(t *testing.T) {
+		var received events.APIGatewayProxyRequest
+		event := events.APIGatewayV2HTTPRequest{
+			Version:  "2.0",
+			RouteKey: "GET /user/{id}",
+			RequestContext: events.APIGatewayV2HTTPRequestContext{
+				HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{Method: "GET"},
+				Authorizer: &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+					JWT:    &events.APIGatewayV2HTTPRequestContextAuthorizerJWTDescription{Claims: map[string]string{"sub": "auth0|fred"}},
+					Lambda: map[string]interface{}{"tenant": "bedrock"},
+					IAM:    &events.APIGatewayV2HTTPRequestContextAuthorizerIAMDescription{UserARN: "arn:aws:iam::123456789012:user/fred"},
+				},
+			},
+		}
+		raw, err := json.Marshal(event)
+		assert.NoError(t, err)
+
+		_, err = transport.Adapt(echo(&received))(context.Background(), raw)
+		assert.NoError(t, err)
+
+		assert.Equal(t, map[string]interface{}{"sub": "auth0|fred"}, received.RequestContext.Authorizer["claims"])
+		assert.Equal(t, "bedrock", received.RequestContext.Authorizer["tenant"])
+		assert.Equal(t, "arn:aws:iam::123456789012:user/fred", received.RequestContext.Identity.UserArn)
+	})
+
+	t.Run("Normalises ALB events", func(t *testing.T) {
+		var received events.APIGatewayProxyRequest
+
+		res, err := transport.Adapt(echo(&received))(context.Background(), json.RawMessage(albEvent))
+		assert.NoError(t, err)
+
+		assert.Equal(t, "GET", received.HTTPMethod)
+		assert.Equal(t, "/user", received.Path)
+		assert.Equal(t, "a+b=", received.QueryStringParameters["cursor"])
+		assert.Equal(t, "10", received.QueryStringParameters["limit"])
+		assert.Equal(t, "application/json", received.Headers["accept"])
+
+		alb, ok := res.(events.ALBTargetGroupResponse)
+		assert.True(t, ok)
+		assert.Equal(t, 201, alb.StatusCode)
+		assert.Equal(t, "201 Created", alb.StatusDescription)
+		assert.Nil(t, alb.Headers)
+		assert.Equal(t, []string{"application/json"}, alb.MultiValueHeaders["Content-Type"])
+		assert.Equal(t, []string{"Accept", "Origin"}, alb.MultiValueHeaders["Vary"])
+	})
+
+	t.Run("Renders single-value headers for ALB target groups without multi-value headers", func(t *testing.T) {
+		request, err := transport.FromALB(events.ALBTargetGroupRequest{
+			HTTPMethod:            "GET",
+			Path:                  "/user",
+			QueryStringParameters: map[string]string{"limit": "5"},
+			Headers:               map[string]string{"accept": "application/json"},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "5", request.QueryStringParameters["limit"])
+		assert.Equal(t, []string{"application/json"}, request.MultiValueHeaders["accept"])
+
+		alb := transport.ToALB(events.APIGatewayProxyResponse{
+			StatusCode:        200,
+			Headers:           map[string]string{"Content-Type": "application/json"},
+			MultiValueHeaders: map[string][]string{"Vary": {"Accept", "Origin"}},
+		}, false)
+
+		assert.Nil(t, alb.MultiValueHeaders)
+		assert.Equal(t, "application/json", alb.Headers["Content-Type"])
+		assert.Equal(t, "Accept, Origin", alb.Headers["Vary"])
+	})
+
+	t.Run("Rejects ALB query parameters that are not percent-encoded correctly", func(t *testing.T) {
+		_, err := transport.FromALB(events.ALBTargetGroupRequest{
+			HTTPMethod:            "GET",
+			Path:                  "/user",
+			QueryStringParameters: map[string]string{"cursor": "%zz"},
+		})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Answers ALB query parameters that are not percent-encoded correctly with a 400", func(t *testing.T) {
+		var received events.APIGatewayProxyRequest
+		event := strings.Replace(albEvent, "a%2Bb%3D", "%zz", 1)
+
+		res, err := transport.Adapt(echo(&received))(context.Background(), json.RawMessage(event))
+		assert.NoError(t, err)
+
+		alb, ok := res.(events.ALBTargetGroupResponse)
+		assert.True(t, ok)
+		assert.Equal(t, 400, alb.StatusCode)
+		assert.Equal(t, []string{problem.ContentType}, alb.MultiValueHeaders["Content-Type"])
+		assert.Contains(t, alb.Body, problem.CodeInvalidParameter)
+		assert.Empty(t, received.HTTPMethod)
+	})
+
+	t.Run("Normalises Function URL events", func(t *testing.T) {
+		var received events.APIGatewayProxyRequest
+
+		res, err := transport.Adapt(echo(&received))(context.Background(), json.RawMessage(functionURLEvent))
+		assert.NoError(t, err)
+
+		assert.Equal(t, "POST", received.HTTPMethod)
+		assert.Equal(t, "/user", received.Path)
+		assert.Equal(t, `{"firstName":"Fred"}`, received.Body)
+		assert.Equal(t, "url-request", received.RequestContext.RequestID)
+
+		url, ok := res.(events.LambdaFunctionURLResponse)
+		assert.True(t, ok)
+		assert.Equal(t, 201, url.StatusCode)
+		assert.Equal(t, []string{"session=1"}, url.Cookies)
+	})
+
+	t.Run("Returns an error for unknown events", func(t *testing.T) {
+		var received events.APIGatewayProxyRequest
+
+		_, err := transport.Adapt(echo(&received))(context.Background(), json.RawMessage(`{"Records": []}`))
+
+		assert.ErrorIs(t, err, transport.ErrUnknownFormat)
+	})
+}
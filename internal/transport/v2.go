@@ -0,0 +1,166 @@
+package transport
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// FromV2 converts an API Gateway HTTP API event, payload format 2.0
+func FromV2(event events.APIGatewayV2HTTPRequest) events.APIGatewayProxyRequest {
+	httpInfo := event.RequestContext.HTTP
+
+	request := fromHTTPEvent(event.RawPath, httpInfo.Method, event.Headers, event.Cookies, event.RawQueryString, event.QueryStringParameters)
+	request.Resource = routePath(event.RouteKey)
+	request.PathParameters = event.PathParameters
+	request.StageVariables = event.StageVariables
+	request.Body = event.Body
+	request.IsBase64Encoded = event.IsBase64Encoded
+	request.RequestContext = events.APIGatewayProxyRequestContext{
+		AccountID:        event.RequestContext.AccountID,
+		Stage:            event.RequestContext.Stage,
+		DomainName:       event.RequestContext.DomainName,
+		DomainPrefix:     event.RequestContext.DomainPrefix,
+		RequestID:        event.RequestContext.RequestID,
+		Protocol:         httpInfo.Protocol,
+		Identity:         events.APIGatewayRequestIdentity{SourceIP: httpInfo.SourceIP, UserAgent: httpInfo.UserAgent},
+		ResourcePath:     request.Resource,
+		Path:             httpInfo.Path,
+		HTTPMethod:       httpInfo.Method,
+		RequestTime:      event.RequestContext.Time,
+		RequestTimeEpoch: event.RequestContext.TimeEpoch,
+		APIID:            event.RequestContext.APIID,
+	}
+	fromV2Authorizer(event.RequestContext.Authorizer, &request.RequestContext)
+
+	return decodeBody(request)
+}
+
+// fromV2Authorizer fills in what the authorizer verified about the caller in
+// the places the 1.0 format puts it. JWT claims are nested under "claims",
+// like a Cognito authorizer's, and a Lambda authorizer's context is merged in
+// at the top level.
+func fromV2Authorizer(authorizer *events.APIGatewayV2HTTPRequestContextAuthorizerDescription, requestContext *events.APIGatewayProxyRequestContext) {
+	if authorizer == nil {
+		return
+	}
+
+	result := map[string]interface{}{}
+	if authorizer.JWT != nil {
+		claims := make(map[string]interface{}, len(authorizer.JWT.Claims))
+		for name, value := range authorizer.JWT.Claims {
+			claims[name] = value
+		}
+		result["claims"] = claims
+	}
+	for name, value := range authorizer.Lambda {
+		result[name] = value
+	}
+	if len(result) > 0 {
+		requestContext.Authorizer = result
+	}
+
+	if iam := authorizer.IAM; iam != nil {
+		requestContext.Identity.AccessKey = iam.AccessKey
+		requestContext.Identity.AccountID = iam.AccountID
+		requestContext.Identity.Caller = iam.CallerID
+		requestContext.Identity.User = iam.UserID
+		requestContext.Identity.UserArn = iam.UserARN
+	}
+}
+
+// ToV2 renders a response for an API Gateway HTTP API, payload format 2.0
+func ToV2(response events.APIGatewayProxyResponse) events.APIGatewayV2HTTPResponse {
+	headers, cookies := flattenHeaders(response)
+
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode:      response.StatusCode,
+		Headers:         headers,
+		Body:            response.Body,
+		IsBase64Encoded: response.IsBase64Encoded,
+		Cookies:         cookies,
+	}
+}
+
+// FromFunctionURL converts a Lambda Function URL event. These use the same
+// shape as payload format 2.0, without routes or path parameters.
+func FromFunctionURL(event events.LambdaFunctionURLRequest) events.APIGatewayProxyRequest {
+	httpInfo := event.RequestContext.HTTP
+
+	request := fromHTTPEvent(event.RawPath, httpInfo.Method, event.Headers, event.Cookies, event.RawQueryString, event.QueryStringParameters)
+	request.Body = event.Body
+	request.IsBase64Encoded = event.IsBase64Encoded
+	request.RequestContext = events.APIGatewayProxyRequestContext{
+		AccountID:        event.RequestContext.AccountID,
+		DomainName:       event.RequestContext.DomainName,
+		DomainPrefix:     event.RequestContext.DomainPrefix,
+		RequestID:        event.RequestContext.RequestID,
+		Protocol:         httpInfo.Protocol,
+		Identity:         events.APIGatewayRequestIdentity{SourceIP: httpInfo.SourceIP, UserAgent: httpInfo.UserAgent},
+		Path:             httpInfo.Path,
+		HTTPMethod:       httpInfo.Method,
+		RequestTime:      event.RequestContext.Time,
+		RequestTimeEpoch: event.RequestContext.TimeEpoch,
+		APIID:            event.RequestContext.APIID,
+	}
+
+	return decodeBody(request)
+}
+
+// ToFunctionURL renders a response for a Lambda Function URL
+func ToFunctionURL(response events.APIGatewayProxyResponse) events.LambdaFunctionURLResponse {
+	headers, cookies := flattenHeaders(response)
+
+	return events.LambdaFunctionURLResponse{
+		StatusCode:      response.StatusCode,
+		Headers:         headers,
+		Body:            response.Body,
+		IsBase64Encoded: response.IsBase64Encoded,
+		Cookies:         cookies,
+	}
+}
+
+// fromHTTPEvent fills in the parts of a request common to the 2.0 formats.
+// Cookies are sent separately from the headers, and are put back into a
+// Cookie header. Repeated query parameters are comma separated in the 2.0
+// formats, so the multi-value parameters come from the raw query string.
+func fromHTTPEvent(path string, method string, headers map[string]string, cookies []string, rawQuery string, query map[string]string) events.APIGatewayProxyRequest {
+	h := make(map[string]string, len(headers)+1)
+	multiValueHeaders := make(map[string][]string, len(headers)+1)
+	for name, value := range headers {
+		h[name] = value
+		multiValueHeaders[name] = strings.Split(value, ",")
+	}
+	if len(cookies) > 0 {
+		h["cookie"] = strings.Join(cookies, "; ")
+		multiValueHeaders["cookie"] = []string{h["cookie"]}
+	}
+
+	multiValueQuery, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		multiValueQuery = url.Values{}
+		for name, value := range query {
+			multiValueQuery[name] = strings.Split(value, ",")
+		}
+	}
+
+	return events.APIGatewayProxyRequest{
+		HTTPMethod:                      method,
+		Path:                            path,
+		Headers:                         h,
+		MultiValueHeaders:               multiValueHeaders,
+		QueryStringParameters:           query,
+		MultiValueQueryStringParameters: multiValueQuery,
+	}
+}
+
+// routePath takes the path from a route key such as "GET /user/{id}"
+func routePath(routeKey string) string {
+	_, path, ok := strings.Cut(routeKey, " ")
+	if !ok {
+		return ""
+	}
+
+	return path
+}
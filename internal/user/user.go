@@ -1,7 +1,6 @@
 package user
 
 import (
-	"encoding/json"
 	"fmt"
 	"time"
 
@@ -17,25 +16,18 @@ type User struct {
 	DOB          string `validate:"required,RFC3339Date"`
 	CreatedAt    string `validate:"RFC3339Date"`
 	LastModified string `validate:"RFC3339Date"`
+	// Version is incremented by the repo on every write and is used for
+	// optimistic concurrency control.
+	Version int64
+	// DeletedAt is when the user was deleted, and is empty for users that
+	// have not been. Deleted users are kept until they are purged, so they can
+	// be restored.
+	DeletedAt string `dynamodbav:",omitempty"`
 }
 
-func Parse(jsonString string, userID string) (*User, error) {
-	result := &User{}
-	err := json.Unmarshal([]byte(jsonString), &result)
-	if err != nil {
-		return nil, err
-	}
-
-	if userID != "" {
-		result.ID = userID
-	}
-
-	err = validator.GetValidator().Struct(result)
-	if err != nil {
-		return nil, fmt.Errorf("User validation failed. %s", err)
-	}
-
-	return result, nil
+// IsDeleted reports whether the user was deleted and not restored
+func (u User) IsDeleted() bool {
+	return u.DeletedAt != ""
 }
 
 func New(FirstName string, LastName string, Email string, DOB string) (*User, error) {
@@ -52,7 +44,7 @@ func New(FirstName string, LastName string, Email string, DOB string) (*User, er
 
 	err := validator.GetValidator().Struct(result)
 	if err != nil {
-		return nil, fmt.Errorf("User validation failed. %s", err)
+		return nil, fmt.Errorf("User validation failed. %w", err)
 	}
 
 	return result, nil
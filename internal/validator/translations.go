@@ -0,0 +1,131 @@
+package validator
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/es"
+	"github.com/go-playground/locales/fr"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	es_translations "github.com/go-playground/validator/v10/translations/es"
+	fr_translations "github.com/go-playground/validator/v10/translations/fr"
+	"golang.org/x/text/language"
+)
+
+// Language describes how to translate validation errors into a language
+type Language struct {
+	Tag    language.Tag
+	Locale locales.Translator
+	// RegisterDefaults registers translations for validator's built in rules,
+	// usually one of the RegisterDefaultTranslations functions it ships
+	RegisterDefaults func(*validator.Validate, ut.Translator) error
+	// Custom holds translations for rules registered by this package, keyed
+	// by rule. {0} is replaced with the field name.
+	Custom map[string]string
+}
+
+// English is the fallback for requests that accept no supported language
+var English = Language{
+	Tag:              language.English,
+	Locale:           en.New(),
+	RegisterDefaults: en_translations.RegisterDefaultTranslations,
+	Custom: map[string]string{
+		"RFC3339Date": "{0} must be an RFC 3339 date, e.g. 1979-12-09T00:00:00Z",
+	},
+}
+
+var Spanish = Language{
+	Tag:              language.Spanish,
+	Locale:           es.New(),
+	RegisterDefaults: es_translations.RegisterDefaultTranslations,
+	Custom: map[string]string{
+		"RFC3339Date": "{0} debe ser una fecha RFC 3339, p. ej. 1979-12-09T00:00:00Z",
+	},
+}
+
+var French = Language{
+	Tag:              language.French,
+	Locale:           fr.New(),
+	RegisterDefaults: fr_translations.RegisterDefaultTranslations,
+	Custom: map[string]string{
+		"RFC3339Date": "{0} doit être une date RFC 3339, par ex. 1979-12-09T00:00:00Z",
+	},
+}
+
+// registry holds the languages validation errors can be translated into. The
+// first language registered is the fallback.
+var registry = struct {
+	sync.RWMutex
+	uni         *ut.UniversalTranslator
+	tags        []language.Tag
+	translators []ut.Translator
+	matcher     language.Matcher
+}{
+	uni: ut.New(English.Locale, English.Locale),
+}
+
+// RegisterLanguage makes a language available to Translator
+func RegisterLanguage(l Language) error {
+	registry.Lock()
+	defer registry.Unlock()
+
+	trans, found := registry.uni.GetTranslator(l.Locale.Locale())
+	if !found {
+		if err := registry.uni.AddTranslator(l.Locale, false); err != nil {
+			return err
+		}
+		trans, _ = registry.uni.GetTranslator(l.Locale.Locale())
+	}
+
+	if err := l.RegisterDefaults(validate, trans); err != nil {
+		return fmt.Errorf("registering %s translations: %w", l.Tag, err)
+	}
+
+	for rule, text := range l.Custom {
+		err := validate.RegisterTranslation(rule, trans, func(ut ut.Translator) error {
+			return ut.Add(rule, text, true)
+		}, func(ut ut.Translator, fe validator.FieldError) string {
+			translated, _ := ut.T(fe.Tag(), fe.Field())
+			return translated
+		})
+		if err != nil {
+			return fmt.Errorf("registering %s translation for %s: %w", l.Tag, rule, err)
+		}
+	}
+
+	registry.tags = append(registry.tags, l.Tag)
+	registry.translators = append(registry.translators, trans)
+	registry.matcher = language.NewMatcher(registry.tags)
+
+	return nil
+}
+
+// Translator picks the best supported language for an Accept-Language header,
+// falling back to English when the header is missing, malformed or names no
+// supported language.
+func Translator(acceptLanguage string) ut.Translator {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return registry.translators[0]
+	}
+
+	_, index, confidence := registry.matcher.Match(tags...)
+	if confidence == language.No {
+		return registry.translators[0]
+	}
+
+	return registry.translators[index]
+}
+
+// Message describes a failed validation in a sentence suitable for end users,
+// in the language of trans
+func Message(fe validator.FieldError, trans ut.Translator) string {
+	return fe.Translate(trans)
+}
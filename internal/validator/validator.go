@@ -1,6 +1,8 @@
 package validator
 
 import (
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
@@ -22,10 +24,33 @@ func IsRFC3339Date(fl validator.FieldLevel) bool {
 	return err == nil
 }
 
+// fieldName reports fields by their JSON name, so errors name fields the way
+// clients sent them
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	default:
+		return name
+	}
+}
+
 func init() {
 	// Singleton validation is the recommended way to do validation according to validator
 	// https://pkg.go.dev/github.com/go-playground/validator/v10#hdr-Singleton
 	validate = validator.New(validator.WithRequiredStructEnabled())
 
+	validate.RegisterTagNameFunc(fieldName)
 	_ = validate.RegisterValidation("RFC3339Date", IsRFC3339Date)
+
+	// Translations are registered on the validator, so they can only be added
+	// once it exists
+	for _, l := range []Language{English, Spanish, French} {
+		if err := RegisterLanguage(l); err != nil {
+			panic(err)
+		}
+	}
 }
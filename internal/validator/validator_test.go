@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/crestenstclair/crud/internal/validator"
+	playground "github.com/go-playground/validator/v10"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -35,3 +36,46 @@ func TestValidator(t *testing.T) {
 		assert.NoError(t, err)
 	})
 }
+
+type namedStruct struct {
+	FirstName string `json:"firstName" validate:"required"`
+	Email     string `validate:"required,email"`
+}
+
+func TestMessage(t *testing.T) {
+	t.Run("Names fields by their JSON name", func(t *testing.T) {
+		err := validator.GetValidator().Struct(&namedStruct{Email: "not-an-email"})
+
+		var invalid playground.ValidationErrors
+		assert.ErrorAs(t, err, &invalid)
+		assert.Len(t, invalid, 2)
+
+		trans := validator.Translator("")
+		assert.Equal(t, "firstName is a required field", validator.Message(invalid[0], trans))
+		assert.Equal(t, "Email must be a valid email address", validator.Message(invalid[1], trans))
+	})
+	t.Run("Translates into the preferred supported language", func(t *testing.T) {
+		err := validator.GetValidator().Struct(&namedStruct{Email: "fred@example.com"})
+
+		var invalid playground.ValidationErrors
+		assert.ErrorAs(t, err, &invalid)
+
+		trans := validator.Translator("de-DE, fr-CA;q=0.9, es;q=0.8")
+		assert.Equal(t, "firstName est un champ obligatoire", validator.Message(invalid[0], trans))
+	})
+	t.Run("Translates the RFC3339Date rule", func(t *testing.T) {
+		err := validator.GetValidator().Struct(&testStruct{DOB: "INVALID"})
+
+		var invalid playground.ValidationErrors
+		assert.ErrorAs(t, err, &invalid)
+
+		assert.Equal(t, "DOB must be an RFC 3339 date, e.g. 1979-12-09T00:00:00Z", validator.Message(invalid[0], validator.Translator("en")))
+		assert.Equal(t, "DOB debe ser una fecha RFC 3339, p. ej. 1979-12-09T00:00:00Z", validator.Message(invalid[0], validator.Translator("es-MX")))
+		assert.Equal(t, "DOB doit être une date RFC 3339, par ex. 1979-12-09T00:00:00Z", validator.Message(invalid[0], validator.Translator("fr")))
+	})
+	t.Run("Falls back to English", func(t *testing.T) {
+		for _, header := range []string{"", "de", "not a header;;"} {
+			assert.Equal(t, "en", validator.Translator(header).Locale(), header)
+		}
+	})
+}